@@ -0,0 +1,270 @@
+package bind
+
+import (
+ "fmt"
+ "reflect"
+ "strings"
+ "sync"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/sources"
+)
+
+//The struct tag that binds a field to a parameter, ie. `figure:"sql.max_connections,default=32"`. The default must
+//be the last option since it extends to the end of the tag, ie. `figure:"hosts,default=alpha,beta"`. Untagged fields
+//of struct type are bound recursively and share the prefix of their parent. Embedded structs that are not registered
+//parameters are bound recursively as well, their tag is the prefix of the parameter names of their fields.
+const TAG = "figure"
+
+//Returned for every field that could not be bound
+type FieldError struct {
+ //The path of the field within the bound struct, ie. 'Sql.MaxConnections'
+ Field string
+ //The name of the parameter
+ Name string
+ Err  error
+}
+
+func (err *FieldError) Error() string {
+ return fmt.Sprintf("Failed to bind field '%s' to parameter '%s':\n%s\n", err.Field, err.Name, err.Err.Error())
+}
+
+func (err *FieldError) Unwrap() error {
+ return err.Err
+}
+
+type field struct {
+ path  string
+ name  string
+ key   config.IParameterKey
+ value reflect.Value
+ //nil if the parameter has no default
+ def      *string
+ required bool
+}
+
+//A struct bound to the parameters of a config bus. Listeners installed by Watch update the struct while holding the
+//write lock, hold the read lock while reading the struct if the bus is written concurrently.
+type Binding struct {
+ sync.RWMutex
+ fields  []*field
+ handles []config.IListenerHandle
+}
+
+//Parses a tag into a parameter name and its options
+func parseTag(tag string) (name string, def *string, required bool, err error) {
+ name = tag
+ options := ""
+ if i := strings.IndexByte(tag, ','); i >= 0 {
+  name, options = tag[:i], tag[i + 1:]
+ }
+ for options != "" {
+  if strings.HasPrefix(options, "default=") {
+   value := strings.TrimPrefix(options, "default=")
+   def = &value
+   break
+  }
+  option := options
+  if i := strings.IndexByte(options, ','); i >= 0 {
+   option, options = options[:i], options[i + 1:]
+  } else {
+   options = ""
+  }
+  switch option {
+  case "required":
+   required = true
+  default:
+   return "", nil, false, fmt.Errorf("Unknown tag option '%s'", option)
+  }
+ }
+ return name, def, required, nil
+}
+
+func joinName(prefix, name string) string {
+ if prefix == "" {
+  return name
+ }
+ return prefix + sources.PathSeparator + name
+}
+
+func joinField(parent, name string) string {
+ if parent == "" {
+  return name
+ }
+ return parent + "." + name
+}
+
+//Collects the tagged fields of a struct. Untagged and embedded fields of struct type are bound recursively, tagged
+//fields are always parameters, so a misspelled name is reported instead of binding the fields of ie. a time.Time.
+func collectFields(registry *sources.Registry, value reflect.Value, path, prefix string, visiting map[reflect.Type]bool, fields []*field, errs sources.Errors) ([]*field, sources.Errors) {
+ t := value.Type()
+ for i := 0; i < t.NumField(); i++ {
+  structField := t.Field(i)
+  fieldValue := value.Field(i)
+  fieldPath := joinField(path, structField.Name)
+  tag, tagged := structField.Tag.Lookup(TAG)
+  if tag == "-" {
+   continue
+  }
+  name, def, required, err := parseTag(tag)
+  if err != nil {
+   errs = append(errs, &FieldError{fieldPath, joinName(prefix, name), err})
+   continue
+  }
+  fullName := joinName(prefix, name)
+  if structField.PkgPath != "" {
+   //unexported fields cannot be set, untagged ones are skipped silently
+   if tagged {
+    errs = append(errs, &FieldError{fieldPath, fullName, fmt.Errorf("Field is unexported")})
+   }
+   continue
+  }
+  binding, registered := registry.Lookup(fullName)
+  registered = registered && tagged && name != ""
+  if !tagged || (structField.Anonymous && !registered && def == nil) {
+   //the tag of an embedded struct is the prefix of the parameter names of its fields
+   fields, errs = collectNested(registry, fieldValue, fieldPath, fullName, visiting, fields, errs)
+   continue
+  }
+  if name == "" {
+   errs = append(errs, &FieldError{fieldPath, fullName, fmt.Errorf("Tag does not name a parameter")})
+   continue
+  }
+  if !registered {
+   errs = append(errs, &FieldError{fieldPath, fullName, &sources.UnknownParameterError{Path: fullName}})
+   continue
+  }
+  fields = append(fields, &field{fieldPath, fullName, binding.Key, fieldValue, def, required})
+ }
+ return fields, errs
+}
+
+//Collects the fields of a nested struct or struct pointer, ignores values of other types and structs that are already
+//being collected. Nil pointers are only allocated if the struct has bound fields.
+func collectNested(registry *sources.Registry, value reflect.Value, path, prefix string, visiting map[reflect.Type]bool, fields []*field, errs sources.Errors) ([]*field, sources.Errors) {
+ structType := value.Type()
+ if structType.Kind() == reflect.Ptr {
+  structType = structType.Elem()
+ }
+ if structType.Kind() != reflect.Struct || visiting[structType] {
+  return fields, errs
+ }
+ visiting[structType] = true
+ defer delete(visiting, structType)
+ switch {
+ case value.Kind() != reflect.Ptr:
+  return collectFields(registry, value, path, prefix, visiting, fields, errs)
+ case !value.IsNil():
+  return collectFields(registry, value.Elem(), path, prefix, visiting, fields, errs)
+ }
+ nested := reflect.New(structType)
+ count := len(fields)
+ fields, errs = collectFields(registry, nested.Elem(), path, prefix, visiting, fields, errs)
+ if len(fields) > count {
+  value.Set(nested)
+ }
+ return fields, errs
+}
+
+//Binds a single field to its parameter value, or its default if the parameter is not defined
+func (f *field) bind(value config.IParameterValue, ok bool) error {
+ var err error
+ switch {
+ case ok:
+  err = assignParameter(f.value, value)
+ case f.def != nil:
+  err = parse(f.value, *f.def)
+ case f.required:
+  err = fmt.Errorf("Parameter is required")
+ default:
+  f.value.Set(reflect.Zero(f.value.Type()))
+ }
+ if err != nil {
+  return &FieldError{f.path, f.name, err}
+ }
+ return nil
+}
+
+//Collects the fields of the struct that target points to
+func newBinding(registry *sources.Registry, target interface{}) (*Binding, sources.Errors, error) {
+ value := reflect.ValueOf(target)
+ if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+  return nil, nil, fmt.Errorf("Expected a non-nil pointer to a struct, received: %T\n", target)
+ }
+ binding := &Binding{}
+ var errs sources.Errors
+ binding.fields, errs = collectNested(registry, value.Elem(), "", "", map[reflect.Type]bool{}, nil, nil)
+ return binding, errs, nil
+}
+
+//Binds every field to the current value of its parameter, holding the write lock for each field
+func (binding *Binding) bind(bus config.IConfigBus, errs sources.Errors) error {
+ for _, f := range binding.fields {
+  parameter, ok := bus.GetParameter(f.key)
+  binding.Lock()
+  err := f.bind(parameter, ok)
+  binding.Unlock()
+  if err != nil {
+   errs = append(errs, err)
+  }
+ }
+ if len(errs) > 0 {
+  return errs
+ }
+ return nil
+}
+
+//Populates the tagged fields of the struct that target points to from the bus; parameter names are resolved to keys
+//through the registry. Fields of undefined parameters are set to their default, or their zero value. Every field that
+//could not be bound is reported as a *FieldError in the returned sources.Errors, and keeps its value.
+func Bind(bus config.IConfigBus, registry *sources.Registry, target interface{}) (*Binding, error) {
+ binding, errs, err := newBinding(registry, target)
+ if err != nil {
+  return nil, err
+ }
+ return binding, binding.bind(bus, errs)
+}
+
+//Like Bind, and keeps the struct updated by installing a WRITE listener for every bound field. Fields that fail to
+//rebind keep their value, the error is returned from the listener, so it is reported to the bus's
+//CallbackErrorHandler. Close the binding to remove its listeners.
+func Watch(bus config.IConfigBus, registry *sources.Registry, target interface{}) (*Binding, error) {
+ binding, errs, err := newBinding(registry, target)
+ if err != nil {
+  return nil, err
+ }
+ //listeners are installed before the fields are bound, so writes in between are not missed
+ for _, f := range binding.fields {
+  f := f
+  handle := bus.AddParameterListener(
+   f.key,
+   config.PARAMETER_ACCESS_WRITE,
+   func(context config.IListenerContext, prev config.IParameterValue) error {
+    //the value that was written, re-reading the bus could return a later one
+    event := context.Event()
+    binding.Lock()
+    defer binding.Unlock()
+    return f.bind(event.Value, event.Value != nil)
+   },
+  )
+  binding.handles = append(binding.handles, handle)
+ }
+ return binding, binding.bind(bus, errs)
+}
+
+//Returns the names of the bound parameters, in field order
+func (binding *Binding) Names() []string {
+ names := make([]string, len(binding.fields))
+ for i, f := range binding.fields {
+  names[i] = f.name
+ }
+ return names
+}
+
+//Removes the listeners installed by Watch
+func (binding *Binding) Close() {
+ for _, handle := range binding.handles {
+  handle.Unsubscribe()
+ }
+ binding.handles = nil
+}
@@ -0,0 +1,268 @@
+package bind
+
+import (
+ "encoding"
+ "fmt"
+ "net/url"
+ "reflect"
+ "strconv"
+ "strings"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+var (
+ durationType        = reflect.TypeOf(time.Duration(0))
+ urlType             = reflect.TypeOf(url.URL{})
+ textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+ stringerType        = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+//Assigns a parameter value to a field. Values that are assignable to the field, ie. the concrete value type or
+//config.IParameterValue, are assigned as-is; otherwise the field is converted from IParameterValue.Value(), falling
+//back to parsing IParameterValue.String().
+func assignParameter(field reflect.Value, value config.IParameterValue) error {
+ if value == nil {
+  field.Set(reflect.Zero(field.Type()))
+  return nil
+ }
+ if reflect.TypeOf(value).AssignableTo(field.Type()) {
+  field.Set(reflect.ValueOf(value))
+  return nil
+ }
+ err := assign(field, value.Value())
+ if err != nil {
+  if _, ok := value.Value().(string); !ok {
+   if parseErr := parse(field, value.String()); parseErr == nil {
+    return nil
+   }
+  }
+ }
+ return err
+}
+
+func isInt(kind reflect.Kind) bool {
+ return kind >= reflect.Int && kind <= reflect.Int64
+}
+
+func isUint(kind reflect.Kind) bool {
+ return kind >= reflect.Uint && kind <= reflect.Uintptr
+}
+
+func isFloat(kind reflect.Kind) bool {
+ return kind == reflect.Float32 || kind == reflect.Float64
+}
+
+func isNumber(kind reflect.Kind) bool {
+ return isInt(kind) || isUint(kind) || isFloat(kind)
+}
+
+//Converts a raw value, ie. from IParameterValue.Value() or an element of a list, to the type of the field
+func assign(field reflect.Value, raw interface{}) error {
+ if raw == nil {
+  field.Set(reflect.Zero(field.Type()))
+  return nil
+ }
+ value := reflect.ValueOf(raw)
+ if value.Type().AssignableTo(field.Type()) {
+  field.Set(value)
+  return nil
+ }
+ if field.Kind() == reflect.Ptr {
+  elem := reflect.New(field.Type().Elem())
+  if err := assign(elem.Elem(), raw); err != nil {
+   return err
+  }
+  field.Set(elem)
+  return nil
+ }
+ kind := value.Kind()
+ switch {
+ case isNumber(kind) && isNumber(field.Kind()):
+  return assignNumber(field, value)
+ case kind == reflect.Bool && field.Kind() == reflect.Bool:
+  field.SetBool(value.Bool())
+  return nil
+ case kind == reflect.String:
+  return parse(field, value.String())
+ case (kind == reflect.Slice || kind == reflect.Array) && field.Kind() == reflect.Slice:
+  slice := reflect.MakeSlice(field.Type(), value.Len(), value.Len())
+  for i := 0; i < value.Len(); i++ {
+   if err := assign(slice.Index(i), value.Index(i).Interface()); err != nil {
+    return fmt.Errorf("Element %d: %s", i, err.Error())
+   }
+  }
+  field.Set(slice)
+  return nil
+ case kind == reflect.Map && field.Kind() == reflect.Map:
+  m := reflect.MakeMapWithSize(field.Type(), value.Len())
+  for _, k := range value.MapKeys() {
+   key := reflect.New(field.Type().Key()).Elem()
+   if err := assign(key, k.Interface()); err != nil {
+    return fmt.Errorf("Key '%v': %s", k.Interface(), err.Error())
+   }
+   elem := reflect.New(field.Type().Elem()).Elem()
+   if err := assign(elem, value.MapIndex(k).Interface()); err != nil {
+    return fmt.Errorf("Entry '%v': %s", k.Interface(), err.Error())
+   }
+   m.SetMapIndex(key, elem)
+  }
+  field.Set(m)
+  return nil
+ case value.Type().Implements(stringerType):
+  //ie. json.Number
+  return parse(field, raw.(fmt.Stringer).String())
+ }
+ return fmt.Errorf("Cannot assign a value of type %T to a field of type %s", raw, field.Type())
+}
+
+func assignNumber(field, value reflect.Value) error {
+ kind := value.Kind()
+ switch {
+ case isInt(field.Kind()):
+  var i int64
+  switch {
+  case isInt(kind):
+   i = value.Int()
+  case isUint(kind):
+   if value.Uint() > uint64(1 << 63 - 1) {
+    return fmt.Errorf("%d overflows %s", value.Uint(), field.Type())
+   }
+   i = int64(value.Uint())
+  default:
+   f := value.Float()
+   if f != float64(int64(f)) {
+    return fmt.Errorf("%v is not an integer", f)
+   }
+   i = int64(f)
+  }
+  if field.OverflowInt(i) {
+   return fmt.Errorf("%d overflows %s", i, field.Type())
+  }
+  field.SetInt(i)
+ case isUint(field.Kind()):
+  var u uint64
+  switch {
+  case isInt(kind):
+   if value.Int() < 0 {
+    return fmt.Errorf("%d is negative", value.Int())
+   }
+   u = uint64(value.Int())
+  case isUint(kind):
+   u = value.Uint()
+  default:
+   f := value.Float()
+   if f < 0 || f != float64(uint64(f)) {
+    return fmt.Errorf("%v is not an unsigned integer", f)
+   }
+   u = uint64(f)
+  }
+  if field.OverflowUint(u) {
+   return fmt.Errorf("%d overflows %s", u, field.Type())
+  }
+  field.SetUint(u)
+ default:
+  field.SetFloat(value.Convert(reflect.TypeOf(float64(0))).Float())
+ }
+ return nil
+}
+
+//Parses text into a field. Lists are comma separated, ie. "a,b", and maps are comma separated pairs, ie. "a=1,b=2".
+func parse(field reflect.Value, text string) error {
+ switch field.Type() {
+ case durationType:
+  d, err := time.ParseDuration(text)
+  if err != nil {
+   return err
+  }
+  field.SetInt(int64(d))
+  return nil
+ case urlType:
+  u, err := url.Parse(text)
+  if err != nil {
+   return err
+  }
+  field.Set(reflect.ValueOf(*u))
+  return nil
+ }
+ if field.CanAddr() && field.Addr().Type().Implements(textUnmarshalerType) {
+  //ie. time.Time or net.IP
+  return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+ }
+ switch kind := field.Kind(); {
+ case kind == reflect.Ptr:
+  elem := reflect.New(field.Type().Elem())
+  if err := parse(elem.Elem(), text); err != nil {
+   return err
+  }
+  field.Set(elem)
+ case kind == reflect.String:
+  field.SetString(text)
+ case kind == reflect.Bool:
+  b, err := strconv.ParseBool(text)
+  if err != nil {
+   return err
+  }
+  field.SetBool(b)
+ case isInt(kind):
+  i, err := strconv.ParseInt(text, 0, field.Type().Bits())
+  if err != nil {
+   return err
+  }
+  field.SetInt(i)
+ case isUint(kind):
+  u, err := strconv.ParseUint(text, 0, field.Type().Bits())
+  if err != nil {
+   return err
+  }
+  field.SetUint(u)
+ case isFloat(kind):
+  f, err := strconv.ParseFloat(text, field.Type().Bits())
+  if err != nil {
+   return err
+  }
+  field.SetFloat(f)
+ case kind == reflect.Slice:
+  items := splitList(text)
+  slice := reflect.MakeSlice(field.Type(), len(items), len(items))
+  for i, item := range items {
+   if err := parse(slice.Index(i), item); err != nil {
+    return fmt.Errorf("Element %d: %s", i, err.Error())
+   }
+  }
+  field.Set(slice)
+ case kind == reflect.Map:
+  m := reflect.MakeMap(field.Type())
+  for _, item := range splitList(text) {
+   i := strings.IndexByte(item, '=')
+   if i < 0 {
+    return fmt.Errorf("Expected a 'key=value' pair, received: '%s'", item)
+   }
+   key := reflect.New(field.Type().Key()).Elem()
+   if err := parse(key, strings.TrimSpace(item[:i])); err != nil {
+    return fmt.Errorf("Key '%s': %s", item[:i], err.Error())
+   }
+   elem := reflect.New(field.Type().Elem()).Elem()
+   if err := parse(elem, strings.TrimSpace(item[i + 1:])); err != nil {
+    return fmt.Errorf("Entry '%s': %s", item[:i], err.Error())
+   }
+   m.SetMapIndex(key, elem)
+  }
+  field.Set(m)
+ default:
+  return fmt.Errorf("Cannot parse '%s' into a field of type %s", text, field.Type())
+ }
+ return nil
+}
+
+func splitList(text string) []string {
+ if strings.TrimSpace(text) == "" {
+  return nil
+ }
+ items := strings.Split(text, ",")
+ for i, item := range items {
+  items[i] = strings.TrimSpace(item)
+ }
+ return items
+}
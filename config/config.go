@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 //Interface type for environments
 type IEnvironment interface {
  SetConfig(cfg IConfigBus)
@@ -20,27 +22,92 @@ type IParameterValue interface {
  String() string
 }
 
+//Optional interface for keys that describe their parameter, ie. for the usage of generated command-line flags
+type IDescribedKey interface {
+ IParameterKey
+ Description() string
+}
+
+//Optional interface for keys that have a default value
+type IDefaultedKey interface {
+ IParameterKey
+ Default() IParameterValue
+}
+
 type Parameters map[IParameterKey]IParameterValue
 
+//Listeners subscribe to any combination of access types. Writes raise a CREATE, UPDATE or DELETE event depending on
+//how they changed the parameter, WRITE is their union.
 type ParameterAccess uint8
 const (
  PARAMETER_ACCESS_RESERVED,
  PARAMETER_ACCESS_READ,
+ PARAMETER_ACCESS_CREATE,
+ PARAMETER_ACCESS_UPDATE,
+ PARAMETER_ACCESS_DELETE,
  PARAMETER_ACCESS_WRITE,
  PARAMETER_ACCESS_ANY ParameterAccess =
  0,
  1 << 0,
  1 << 1,
+ 1 << 2,
+ 1 << 3,
+ PARAMETER_ACCESS_CREATE | PARAMETER_ACCESS_UPDATE | PARAMETER_ACCESS_DELETE,
  PARAMETER_ACCESS_READ | PARAMETER_ACCESS_WRITE
 )
 
+//How a change affected the definition of a parameter
+type ChangeKind uint8
+const (
+ CHANGE_NONE,
+ CHANGE_CREATE,
+ CHANGE_UPDATE,
+ CHANGE_REMOVE ChangeKind =
+ 0,
+ 1,
+ 2,
+ 3
+)
+
+//A single change of a parameter, values are nil when the parameter is not defined
+type ParameterChange struct {
+ Key         IParameterKey
+ Prev, Value IParameterValue
+ Kind        ChangeKind
+ //The origin of the write that made the change, nil if the writer attached none
+ Origin *WriteOrigin
+ //Increases with every change of the bus and every read that raises an event, see ParameterEvent
+ Sequence uint64
+ //When the change was stored
+ Time time.Time
+}
+
+//A single event raised to listeners, see IListenerContext.Event. The events of READ accesses hold the value that was
+//read as both their Prev and Value, with a Kind of CHANGE_NONE. Every listener notified of the same change or read
+//receives the same Sequence.
+type ParameterEvent struct {
+ ParameterChange
+ Access ParameterAccess
+}
+
+//The changes stored together by a single write, ordered by key
+type ChangeSet []ParameterChange
+
 type IListenerContext interface {
  Key() IParameterKey
  Value() (IParameterValue, bool)
  ValueOr(or IParameterValue) IParameterValue
  SetValue(value IParameterValue)
  Config() IConfigBus
+ //Reports CREATE, UPDATE and DELETE events as PARAMETER_ACCESS_WRITE, the precise access type is in Event().Access
  AccessType() ParameterAccess
+ //Returns every change stored together with the change of a WRITE event, including the change itself, so listeners
+ //of multi-key writes can see the whole change set. Empty for READ events.
+ Changes() ChangeSet
+ //Returns the origin of the write that raised a WRITE event, nil for READ events and writes without an origin
+ Origin() *WriteOrigin
+ //Returns the event the listener is notified of, reading it does not raise a READ event like Value does
+ Event() ParameterEvent
 }
 type ParameterListener func(context IListenerContext, prev IParameterValue) error
 type ParameterListenerEntry struct {
@@ -49,20 +116,176 @@ type ParameterListenerEntry struct {
 }
 type ParameterListeners map[IParameterKey]*[]ParameterListenerEntry
 
+//Selects the keys a group listener is notified of, see IConfigBus.AddGroupListener and the match package
+type IKeyMatcher interface {
+ Match(key IParameterKey) bool
+ //Describes the selected keys, ie. "sql.*"
+ String() string
+}
+
+//Subscription handle for a single listener registration
+type IListenerHandle interface {
+ Key() IParameterKey
+ //Returns the access types the listener is subscribed to, 0 once it has been unsubscribed
+ Access() ParameterAccess
+ //Replaces the access types the listener is subscribed to, an access of 0 unsubscribes the listener. Has no effect
+ //once the listener has been unsubscribed.
+ Update(access ParameterAccess)
+ Unsubscribe()
+}
+
+//Vets a value before it is stored, a non-nil error rejects the write
+type ParameterValidator func(key IParameterKey, value IParameterValue) error
+
+//Registration handle for a single validator
+type IValidatorHandle interface {
+ Key() IParameterKey
+ //Has no effect once the validator has been removed
+ Remove()
+}
+
+//How a config bus handles the errors returned by WRITE listeners
+type ListenerErrorPolicy uint8
+const (
+ //Falls back to the policy of the bus, only meaningful for the policies of keys
+ LISTENER_ERROR_INHERIT,
+ //Reports the error to the CallbackErrorHandler, the write stays in place
+ LISTENER_ERROR_REPORT,
+ //Reverts the write and returns a *RollbackError to the writer, see RollbackError
+ LISTENER_ERROR_ROLLBACK ListenerErrorPolicy =
+ 0,
+ 1,
+ 2
+)
+
 type CallbackErrorHandler func(active ParameterListener, access ParameterAccess, key IParameterKey, err error)
 //The panic handler should cover all functions EXCEPT: SetCallbackErrorHandler, SetUnexpectedPanicHandler
 type PanicHandler func(p interface{})
 
 type IConfigBus interface {
- AddParameterListener(key IParameterKey, access ParameterAccess, listener ParameterListener)
+ //Every call registers a new listener entry, use the returned handle to modify or remove it
+ AddParameterListener(key IParameterKey, access ParameterAccess, listener ParameterListener) IListenerHandle
+ //Registers a listener for every key the matcher selects, including keys that are first written after the listener
+ //was added. Keys are matched after the key registry resolved them. The key of the returned handle stands for the
+ //group, group listeners are notified after the listeners of the key itself.
+ AddGroupListener(matcher IKeyMatcher, access ParameterAccess, listener ParameterListener) IListenerHandle
+ //Removes the access from the first listener of the key that was registered with the same function value, ie. a
+ //copy of the function passed to AddParameterListener; separately created closures never match.
+ //
+ //Deprecated: use the IListenerHandle returned by AddParameterListener instead
  RemoveParameterListener(key IParameterKey, access ParameterAccess, listener ParameterListener)
  GetParameterListeners(key IParameterKey) []ParameterListenerEntry
  SetCallbackErrorHandler(handler CallbackErrorHandler) CallbackErrorHandler
  SetUnexpectedPanicHandler(handler PanicHandler) PanicHandler
+ //Sets the maximum number of nested listener invocations, a depth of 0 disables the limit
+ SetMaxListenerDepth(depth int) int
+ //Sets the registry that resolves every key passed to the bus, a nil registry accesses every key as is. Keys the
+ //registry rejects cause a panic, through the PanicHandler.
+ SetKeyRegistry(registry IKeyRegistry) IKeyRegistry
  GetParameter(key IParameterKey) (IParameterValue, bool)
  GetParameterOr(key IParameterKey, value IParameterValue) IParameterValue
  GetParameters() Parameters
  SetParameter(key IParameterKey, value IParameterValue)
+ //Stores every value at once before notifying any listener, see IListenerContext.Changes
  SetParameters(params map[IParameterKey]IParameterValue)
  RemoveParameter(key IParameterKey) (IParameterValue, bool)
+ //Validators run in registration order before any of the set methods stores a value, the first error rejects it.
+ //SetParameter and SetParameters panic with the rejection, through the PanicHandler.
+ AddParameterValidator(key IParameterKey, validator ParameterValidator) IValidatorHandle
+ //Returns a *ValidationError, and leaves the bus untouched, if a validator rejects the value
+ TrySetParameter(key IParameterKey, value IParameterValue) error
+ //Returns ValidationErrors, and leaves the bus untouched, if a validator rejects any of the values
+ TrySetParameters(params map[IParameterKey]IParameterValue) error
+ //Starts a transaction that stages writes until it is committed
+ Begin() ITransaction
+ //Sets the policy for the errors of WRITE listeners of keys without a policy of their own, defaults to
+ //LISTENER_ERROR_REPORT. Under LISTENER_ERROR_ROLLBACK, TrySetParameter, TrySetParameters and ITransaction.Commit
+ //return the *RollbackError while the other write methods panic with it, through the PanicHandler.
+ SetListenerErrorPolicy(policy ListenerErrorPolicy) ListenerErrorPolicy
+ //Sets the policy for the errors of WRITE listeners of a single key, LISTENER_ERROR_INHERIT falls back to the policy
+ //of the bus
+ SetKeyListenerErrorPolicy(key IParameterKey, policy ListenerErrorPolicy) ListenerErrorPolicy
+ //Captures the parameters without raising READ events, later writes do not affect the snapshot
+ Snapshot() Snapshot
+ //Resets the parameters to the snapshot with a single write that only changes the parameters that differ, so WRITE
+ //events are only raised for those. Returns the same errors as TrySetParameters.
+ Restore(snapshot Snapshot) error
+ //Sets the history that records every change applied to the bus, a nil history disables recording
+ SetHistory(history IHistory) IHistory
+ //Sets whether writes of values equal to the ones they replace, see ValuesEqual, are dropped: nothing is stored and
+ //no WRITE event is raised. Returns the previous setting, writes are not suppressed by default.
+ SetSuppressUnchanged(suppress bool) bool
+ //Returns a view of the bus that attaches the origin to every write made through it, including its transactions and
+ //restores. Writes made by listeners do not inherit the origin of the write that notified them.
+ WithOrigin(origin WriteOrigin) IConfigBus
+ //Reports the current value of the parameter, without raising a READ event, and the write that stored it
+ Explain(key IParameterKey) Explanation
+}
+
+//Writes staged against a config bus. Committing validates every staged value, then stores all of them at once and
+//only notifies listeners afterwards, so no listener observes a partially applied transaction. A transaction is
+//finished by Commit, even when the commit is rejected, or Rollback and panics when used afterwards. Safe for
+//concurrent use.
+type ITransaction interface {
+ //Later writes of a key replace its earlier staged writes
+ SetParameter(key IParameterKey, value IParameterValue)
+ SetParameters(params map[IParameterKey]IParameterValue)
+ RemoveParameter(key IParameterKey)
+ //Attaches the origin to the writes staged after the call, nil detaches it
+ SetOrigin(origin *WriteOrigin)
+ //Returns ValidationErrors, and stores nothing, if a validator rejects any of the staged values. Returns a
+ //*RollbackError if a listener rejects the commit.
+ Commit() error
+ //Discards the staged writes
+ Rollback()
+}
+
+//Interface type for config buses that dispatch listeners from a dedicated event loop
+type IAsynchronousConfigBus interface {
+ IConfigBus
+ //Blocks until every pending event, including those raised by listeners while draining, has been dispatched
+ Drain()
+ //Drains all pending events and stops the event loop; the bus rejects writes afterwards
+ Close()
+}
+
+//Conventional layer names for layered config buses, lowest precedence first
+const (
+ LAYER_DEFAULTS,
+ LAYER_FILE,
+ LAYER_ENVIRONMENT,
+ LAYER_FLAGS,
+ LAYER_OVERRIDES =
+ "defaults",
+ "file",
+ "environment",
+ "flags",
+ "overrides"
+)
+
+//A single layer of a layered config bus. Reads only see the parameters defined in the layer and raise no events;
+//writes raise WRITE events on the bus when they change the effective value of a parameter.
+type IConfigLayer interface {
+ Name() string
+ GetParameter(key IParameterKey) (IParameterValue, bool)
+ GetParameters() Parameters
+ SetParameter(key IParameterKey, value IParameterValue)
+ SetParameters(params map[IParameterKey]IParameterValue)
+ RemoveParameter(key IParameterKey) (IParameterValue, bool)
+ //Writes to layers are validated by the validators of the bus
+ TrySetParameter(key IParameterKey, value IParameterValue) error
+ TrySetParameters(params map[IParameterKey]IParameterValue) error
+}
+
+//Interface type for config buses that resolve every parameter from the highest precedence layer that defines it.
+//Writes made through the IConfigBus methods go to the highest precedence layer, and WRITE listeners only fire when
+//the effective value of a parameter changes.
+type ILayeredConfigBus interface {
+ IConfigBus
+ //Returns the layer with the given name, nil if there is no such layer
+ Layer(name string) IConfigLayer
+ //Returns the names of the layers, lowest precedence first
+ Layers() []string
+ //Returns the name of the layer that supplies the effective value of the key
+ ResolveLayer(key IParameterKey) (string, bool)
 }
@@ -0,0 +1,29 @@
+package config
+
+import "reflect"
+
+//Optional interface for values that define their own equality, ie. the built-in values of the values package
+type IEqualValue interface {
+ IParameterValue
+ Equal(other IParameterValue) bool
+}
+
+//Reports whether two parameter values are equal. Values that implement IEqualValue decide for themselves, other
+//values are equal if they have the same type and are equal under == or, for incomparable types such as slices and
+//maps, deep equal. Undefined (nil) values are only equal to each other.
+func ValuesEqual(a, b IParameterValue) bool {
+ if a == nil || b == nil {
+  return a == b
+ }
+ if equal, ok := a.(IEqualValue); ok {
+  return equal.Equal(b)
+ }
+ typeA := reflect.TypeOf(a)
+ if typeA != reflect.TypeOf(b) {
+  return false
+ }
+ if typeA.Comparable() {
+  return a == b
+ }
+ return reflect.DeepEqual(a, b)
+}
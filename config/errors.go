@@ -0,0 +1,95 @@
+package config
+
+import (
+ "fmt"
+ "strings"
+)
+
+//The default maximum number of nested listener invocations, see IConfigBus.SetMaxListenerDepth
+const DEFAULT_MAX_LISTENER_DEPTH = 64
+
+//A single listener invocation in a chain of listeners
+type ListenerChainEntry struct {
+ Key IParameterKey
+ ParameterAccess
+ *ParameterListener
+}
+
+//A chain of nested listener invocations, outermost first. Listeners are nested when they access the bus through
+//their IListenerContext (or the bus returned by IListenerContext.Config).
+type ListenerChain []ListenerChainEntry
+
+func (chain ListenerChain) String() string {
+ entries := make([]string, len(chain))
+ for i, entry := range chain {
+  entries[i] = fmt.Sprintf("0x%x on 0x%x access of [%v]", entry.ParameterListener, entry.ParameterAccess, entry.Key.Key())
+ }
+ return strings.Join(entries, " -> ")
+}
+
+//Reported to the CallbackErrorHandler instead of invoking a listener that is already active further up the chain,
+//the last entry of the chain is the listener that was not invoked
+type ListenerCycleError struct {
+ Chain ListenerChain
+}
+
+func (err *ListenerCycleError) Error() string {
+ return fmt.Sprintf("Detected a listener cycle: %s\n", err.Chain.String())
+}
+
+//Reported to the CallbackErrorHandler instead of invoking a listener that would nest deeper than the max listener
+//depth, the last entry of the chain is the listener that was not invoked
+type ListenerDepthError struct {
+ Chain    ListenerChain
+ MaxDepth int
+}
+
+func (err *ListenerDepthError) Error() string {
+ return fmt.Sprintf("Listener chain exceeded the max depth of %d: %s\n", err.MaxDepth, err.Chain.String())
+}
+
+//Returned when a validator rejects a value, the value is not stored
+type ValidationError struct {
+ Key   IParameterKey
+ Value IParameterValue
+ Err   error
+}
+
+func (err *ValidationError) Error() string {
+ return fmt.Sprintf("Rejected value '%v' of parameter [%v]:\n%s", err.Value, err.Key.Key(), err.Err.Error())
+}
+
+func (err *ValidationError) Unwrap() error {
+ return err.Err
+}
+
+//Returned when validators reject any of several values, none of the values are stored
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+ messages := make([]string, len(errs))
+ for i, err := range errs {
+  messages[i] = err.Error()
+ }
+ return strings.Join(messages, "")
+}
+
+//Returned to the writer when a WRITE listener of a key under the LISTENER_ERROR_ROLLBACK policy fails. Every change
+//stored by the write is reverted, unless it has been changed again since, and the listeners that were already
+//notified of the write are notified of the revert. Nothing is returned to the writer of an asynchronous bus, the
+//error is reported to the CallbackErrorHandler instead.
+type RollbackError struct {
+ //The key of the failing listener
+ Key IParameterKey
+ Err error
+ //The changes that reverted the write
+ Reverted ChangeSet
+}
+
+func (err *RollbackError) Error() string {
+ return fmt.Sprintf("Reverted the write of parameter [%v] after a listener failed:\n%s", err.Key.Key(), err.Err.Error())
+}
+
+func (err *RollbackError) Unwrap() error {
+ return err.Err
+}
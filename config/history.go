@@ -0,0 +1,15 @@
+package config
+
+//A change applied to a config bus
+type HistoryEntry struct {
+ ParameterChange
+ //The listener that made the change through its IListenerContext, nil for any other writer
+ Listener *ParameterListener
+}
+
+//Records the changes applied to a config bus, see IConfigBus.SetHistory
+type IHistory interface {
+ //Called with the changes of every write, in the order they are stored. The bus holds its lock while recording, so
+ //implementations must not access the bus.
+ Record(entries []HistoryEntry)
+}
@@ -0,0 +1,33 @@
+package config
+
+//Declaration of a parameter key and its metadata
+type KeyMetadata struct {
+ Key         IParameterKey
+ Description string
+ //Optional, the value of the parameter when no source defines it
+ Default IParameterValue
+ //The team or component that owns the parameter
+ Owner string
+ //Names of the environments, as returned by IEnvironment.String, the key may be used in. Empty for all environments.
+ Environments []string
+ //Set for deprecated keys, explains the deprecation
+ Deprecation string
+ //Optional, accesses of a deprecated key are forwarded to its replacement
+ ReplacedBy IParameterKey
+}
+
+func (metadata *KeyMetadata) Deprecated() bool {
+ return metadata.Deprecation != "" || metadata.ReplacedBy != nil
+}
+
+//Pluggable logger, compatible with *log.Logger
+type ILogger interface {
+ Printf(format string, v ...interface{})
+}
+
+//Consulted by config buses before every access of a key, see IConfigBus.SetKeyRegistry
+type IKeyRegistry interface {
+ //Returns the key to access in place of the given key, ie. the replacement of a deprecated key, or an error if the
+ //key must not be accessed
+ Resolve(key IParameterKey) (IParameterKey, error)
+}
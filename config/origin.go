@@ -0,0 +1,63 @@
+package config
+
+import (
+ "fmt"
+ "strings"
+ "time"
+)
+
+//Who made a write and why, see IConfigBus.WithOrigin. Every field is optional.
+type WriteOrigin struct {
+ //The source the value was loaded from, ie. the String() of a sources.ISource
+ Source    string
+ Component string
+ Reason    string
+ RequestID string
+}
+
+func (origin *WriteOrigin) String() string {
+ if origin == nil {
+  return "unknown"
+ }
+ fields := []string{}
+ for _, field := range [][2]string{
+  {"source", origin.Source},
+  {"component", origin.Component},
+  {"reason", origin.Reason},
+  {"request", origin.RequestID},
+ } {
+  if field[1] != "" {
+   fields = append(fields, fmt.Sprintf("%s '%s'", field[0], field[1]))
+  }
+ }
+ if len(fields) == 0 {
+  return "unknown"
+ }
+ return strings.Join(fields, ", ")
+}
+
+//The current value of a parameter and the write that stored it, see IConfigBus.Explain
+type Explanation struct {
+ Key     IParameterKey
+ Value   IParameterValue
+ Defined bool
+ //The last change of the parameter, nil if it has not been written since the bus was created
+ Change *HistoryEntry
+}
+
+func (explanation Explanation) String() string {
+ value := "undefined"
+ if explanation.Defined {
+  value = fmt.Sprintf("'%v'", explanation.Value)
+ }
+ if explanation.Change == nil {
+  return fmt.Sprintf("[%v] is %s, it has never been written", explanation.Key.Key(), value)
+ }
+ return fmt.Sprintf(
+  "[%v] is %s, written at %s by %s",
+  explanation.Key.Key(),
+  value,
+  explanation.Change.Time.Format(time.RFC3339Nano),
+  explanation.Change.Origin.String(),
+ )
+}
@@ -0,0 +1,54 @@
+package config
+
+//An immutable copy of the parameters of a config bus, cheap to copy and safe for concurrent use. Snapshots of layered
+//buses also hold the parameters of every layer.
+type Snapshot struct {
+ parameters Parameters
+ layers     map[string]Parameters
+}
+
+func copyParameters(params Parameters) Parameters {
+ copied := make(Parameters, len(params))
+ for key, value := range params {
+  copied[key] = value
+ }
+ return copied
+}
+
+func NewSnapshot(params Parameters) Snapshot {
+ return Snapshot{parameters: copyParameters(params)}
+}
+
+//The parameters are the effective parameters of the layered bus, layers maps the name of every layer to its
+//parameters
+func NewLayeredSnapshot(params Parameters, layers map[string]Parameters) Snapshot {
+ snapshot := NewSnapshot(params)
+ snapshot.layers = make(map[string]Parameters, len(layers))
+ for name, layer := range layers {
+  snapshot.layers[name] = copyParameters(layer)
+ }
+ return snapshot
+}
+
+func (snapshot Snapshot) GetParameter(key IParameterKey) (IParameterValue, bool) {
+ value, ok := snapshot.parameters[key]
+ return value, ok
+}
+
+//Returns a copy of the parameters
+func (snapshot Snapshot) GetParameters() Parameters {
+ return copyParameters(snapshot.parameters)
+}
+
+func (snapshot Snapshot) Len() int {
+ return len(snapshot.parameters)
+}
+
+//Returns a copy of the parameters of a layer, only snapshots of layered buses have layers
+func (snapshot Snapshot) Layer(name string) (Parameters, bool) {
+ layer, ok := snapshot.layers[name]
+ if !ok {
+  return nil, false
+ }
+ return copyParameters(layer), true
+}
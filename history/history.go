@@ -0,0 +1,214 @@
+package history
+
+import (
+ "fmt"
+ "sync"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//The default number of changes a history keeps
+const DEFAULT_CAPACITY = 1024
+
+//Returned when the value of a parameter at a point in time can no longer be determined, because changes made after
+//it were evicted from the history
+type TruncatedError struct {
+ Key config.IParameterKey
+ At  time.Time
+ //The time of the latest evicted change
+ Horizon time.Time
+}
+
+func (err *TruncatedError) Error() string {
+ return fmt.Sprintf(
+  "The history of parameter [%v] at %s was evicted, changes are kept since %s!\n",
+  err.Key.Key(),
+  err.At.Format(time.RFC3339Nano),
+  err.Horizon.Format(time.RFC3339Nano),
+ )
+}
+
+//A bounded ring buffer of the changes applied to a config bus, install it with IConfigBus.SetHistory. Once full, the
+//oldest change is evicted for every change that is recorded. Safe for concurrent use.
+type History struct {
+ mutex   sync.RWMutex
+ entries []config.HistoryEntry
+ start   int
+ size    int
+ //the time of the latest evicted change
+ horizon time.Time
+ //keys written by an undo in progress, their changes are not recorded until the undo finishes, including the changes
+ //of a rollback of the undo
+ undoing map[config.IParameterKey]bool
+ //serializes undos, so they neither revert the same changes nor replace each others keys in undoing
+ undoMutex sync.Mutex
+}
+
+//Keeps the last capacity changes, or DEFAULT_CAPACITY changes if capacity is not positive
+func NewHistory(capacity int) *History {
+ if capacity <= 0 {
+  capacity = DEFAULT_CAPACITY
+ }
+ return &History{entries: make([]config.HistoryEntry, capacity)}
+}
+
+//config.IHistory
+func (history *History) Record(entries []config.HistoryEntry) {
+ history.mutex.Lock()
+ defer history.mutex.Unlock()
+ for _, entry := range entries {
+  if history.undoing[entry.Key] {
+   continue
+  }
+  history.push(entry)
+ }
+}
+
+//Must be called while holding the mutex
+func (history *History) push(entry config.HistoryEntry) {
+ capacity := len(history.entries)
+ if history.size == capacity {
+  history.horizon = history.entries[history.start].Time
+  history.entries[history.start] = entry
+  history.start = (history.start + 1) % capacity
+  return
+ }
+ history.entries[(history.start + history.size) % capacity] = entry
+ history.size++
+}
+
+//Must be called while holding the mutex
+func (history *History) at(i int) config.HistoryEntry {
+ return history.entries[(history.start + i) % len(history.entries)]
+}
+
+//Returns the number of recorded changes
+func (history *History) Len() int {
+ history.mutex.RLock()
+ defer history.mutex.RUnlock()
+ return history.size
+}
+
+//Returns every recorded change, oldest first
+func (history *History) Entries() []config.HistoryEntry {
+ history.mutex.RLock()
+ defer history.mutex.RUnlock()
+ entries := make([]config.HistoryEntry, history.size)
+ for i := range entries {
+  entries[i] = history.at(i)
+ }
+ return entries
+}
+
+//Returns the recorded changes of the key, oldest first
+func (history *History) ForKey(key config.IParameterKey) []config.HistoryEntry {
+ history.mutex.RLock()
+ defer history.mutex.RUnlock()
+ entries := []config.HistoryEntry{}
+ for i := 0; i < history.size; i++ {
+  if entry := history.at(i); entry.Key == key {
+   entries = append(entries, entry)
+  }
+ }
+ return entries
+}
+
+//Returns the value the parameter had at the given time, and whether it was defined then. The value before the first
+//change made after that time is returned, or the current value of the bus, without raising a READ event, if nothing
+//has changed the parameter since. Keys are compared as recorded, so keys forwarded by a key registry must be queried
+//by their replacement.
+func (history *History) AsOf(bus config.IConfigBus, key config.IParameterKey, at time.Time) (config.IParameterValue, bool, error) {
+ history.mutex.RLock()
+ if at.Before(history.horizon) {
+  history.mutex.RUnlock()
+  return nil, false, &TruncatedError{key, at, history.horizon}
+ }
+ for i := 0; i < history.size; i++ {
+  if entry := history.at(i); entry.Key == key && entry.Time.After(at) {
+   history.mutex.RUnlock()
+   return entry.Prev, entry.Prev != nil, nil
+  }
+ }
+ history.mutex.RUnlock()
+ value, ok := bus.Snapshot().GetParameter(key)
+ return value, ok, nil
+}
+
+//Reverts the last n recorded changes, or every recorded change if there are fewer, with a single transaction on the
+//bus. The reverted changes are dropped from the history and the writes of the undo are not recorded, so consecutive
+//undos step further back. Parameters that had no value before the reverted changes are removed. Returns the reverted
+//changes, newest first. If the transaction fails, ie. because a listener rolled it back, the history is left as it was
+//and the error is returned. Undos must not race other writers of the same keys, as their changes are not recorded
+//while the undo is in progress. Concurrent undos run one after another, so Undo must not be called from a listener of
+//the bus.
+func (history *History) Undo(bus config.IConfigBus, n int) ([]config.HistoryEntry, error) {
+ history.undoMutex.Lock()
+ defer history.undoMutex.Unlock()
+ history.mutex.Lock()
+ if n > history.size {
+  n = history.size
+ }
+ reverted := make([]config.HistoryEntry, n)
+ targets := config.Parameters{}
+ for i := range reverted {
+  entry := history.at(history.size - 1 - i)
+  reverted[i] = entry
+  //the oldest reverted change of every key holds the value to restore
+  targets[entry.Key] = entry.Prev
+ }
+ history.mutex.Unlock()
+ if n == 0 {
+  return reverted, nil
+ }
+ skip := map[config.IParameterKey]bool{}
+ tx := bus.Begin()
+ for key, value := range targets {
+  if value == nil {
+   tx.RemoveParameter(key)
+  } else {
+   tx.SetParameter(key, value)
+  }
+  skip[key] = true
+ }
+ history.mutex.Lock()
+ history.undoing = skip
+ history.mutex.Unlock()
+ err := tx.Commit()
+ history.mutex.Lock()
+ defer history.mutex.Unlock()
+ history.undoing = nil
+ if err != nil {
+  return nil, err
+ }
+ //changes of other keys may have been recorded, or evicted, during the commit
+ history.drop(reverted)
+ return reverted, nil
+}
+
+//Removes the entries from the history, the remaining entries keep their order. Must be called while holding the mutex
+func (history *History) drop(entries []config.HistoryEntry) {
+ type change struct {
+  key      config.IParameterKey
+  sequence uint64
+ }
+ dropped := map[change]bool{}
+ for _, entry := range entries {
+  dropped[change{entry.Key, entry.Sequence}] = true
+ }
+ capacity := len(history.entries)
+ kept := 0
+ for i := 0; i < history.size; i++ {
+  entry := history.at(i)
+  if dropped[change{entry.Key, entry.Sequence}] {
+   continue
+  }
+  history.entries[(history.start + kept) % capacity] = entry
+  kept++
+ }
+ //release the values of the dropped entries
+ for i := kept; i < history.size; i++ {
+  history.entries[(history.start + i) % capacity] = config.HistoryEntry{}
+ }
+ history.size = kept
+}
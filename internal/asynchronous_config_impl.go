@@ -1,8 +1,819 @@
 package internal
 
-import "github.com/Matthewacon/go-figure/config"
+import (
+ "fmt"
+ "sync"
+ "sync/atomic"
 
-//TODO
-func NewAsynchronousConfigBus() config.IConfigBus {
+ "github.com/Matthewacon/gas"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+const closedBus = "Configuration bus has been closed!\n"
+
+//A parameter event waiting to be dispatched by the event loop
+type asyncEvent struct {
+ key    config.IParameterKey
+ access config.ParameterAccess
+ prev   config.IParameterValue
+ event  config.ParameterEvent
+ //the listener invocation that raised this event through its IListenerContext, the listener will not be notified of
+ //its own change and the event is subject to cycle detection
+ origin *listenerFrame
+ //the write that raised this event, WRITE events only
+ write *asyncWrite
+ //restricts the event to these listeners if not nil, ie. for the notifications of a rollback
+ listeners []config.ParameterListenerEntry
+}
+
+//The writes stored together by a single call, shared by the events they raised
+type asyncWrite struct {
+ writes, undo []stagedWrite
+ changes      config.ChangeSet
+ //set for the notifications of a rollback, which cannot be rolled back themselves
+ compensating bool
+ //only accessed from the event loop
+ invoked  map[config.IParameterKey][]config.ParameterListenerEntry
+ reverted bool
+}
+
+//Listener context handed to a single listener invocation on the event loop, doubles as a view of the bus bound to
+//that invocation
+type asyncListenerContext struct {
+ cfg *AsynchronousConfigImpl
+ listenerFrame
+ *listenerEvent
+}
+
+//Ordering guarantees:
+// - SetParameter, SetParameters, RemoveParameter and GetParameter store or read the value immediately and return
+//   without waiting for any listener
+// - all events are dispatched from a single event loop in the order they were raised, so events for any given key
+//   are always delivered first in, first out
+// - listeners registered for the same key are invoked in registration order
+// - events raised by a listener are queued behind every event that was already pending
+// - events are delivered in the order of their config.ParameterEvent Sequence
+//
+//Events raised through a listener context carry the listener chain that raised them, so cycles and overly deep chains
+//are reported to the CallbackErrorHandler just like on the synchronous bus.
+type AsynchronousConfigImpl struct {
+ parameters     config.Parameters
+ parameterMutex sync.RWMutex
+ listeners      config.ParameterListeners
+ //guards the listeners and both handlers
+ listenerMutex sync.Mutex
+ errorHandler  config.CallbackErrorHandler
+ panicHandler  config.PanicHandler
+ //guards everything below
+ queueMutex sync.Mutex
+ queued     *sync.Cond
+ drained    *sync.Cond
+ queue      []asyncEvent
+ //accessed atomically
+ maxDepth int32
+ //accessed atomically, the number of keys and key groups with registered listeners
+ listenerCount int32
+ keys          keyResolver
+ //guarded by their own lock
+ validators validatorRegistry
+ //guarded by listenerMutex
+ errorPolicies errorPolicies
+ groups        []*keyGroup
+ //guarded by parameterMutex
+ changeLog         changeLog
+ suppressUnchanged bool
+ //number of events that are queued or being dispatched
+ pending int
+ closed  bool
+ stopped chan struct{}
+ //panics that escaped the panic handler on the event loop, re-raised by Drain and Close
+ escaped []interface{}
+}
+
+func (cfg *AsynchronousConfigImpl) getPanicHandler() config.PanicHandler {
+ cfg.listenerMutex.Lock()
+ defer cfg.listenerMutex.Unlock()
+ return cfg.panicHandler
+}
+
+func (cfg *AsynchronousConfigImpl) detectPanic() {
+ if p := recover(); p != nil {
+  cfg.getPanicHandler()(p)
+ }
+}
+
+//Recovers panics raised on the event loop; anything the panic handler lets through is held until the next Drain or
+//Close so the event loop survives it
+func (cfg *AsynchronousConfigImpl) detectLoopPanic() {
+ if p := recover(); p != nil {
+  defer func() {
+   if escaped := recover(); escaped != nil {
+    cfg.queueMutex.Lock()
+    cfg.escaped = append(cfg.escaped, escaped)
+    cfg.queueMutex.Unlock()
+   }
+  }()
+  cfg.getPanicHandler()(p)
+ }
+}
+
+func (cfg *AsynchronousConfigImpl) raiseEscapedPanic() {
+ cfg.queueMutex.Lock()
+ escaped := cfg.escaped
+ cfg.escaped = nil
+ cfg.queueMutex.Unlock()
+ if len(escaped) > 0 {
+  panic(escaped[0])
+ }
+}
+
+//Whether any listener is registered, events raised while there is none are not queued and reads are not stamped
+func (cfg *AsynchronousConfigImpl) listening() bool {
+ return atomic.LoadInt32(&cfg.listenerCount) != 0
+}
+
+//Must be called while holding listenerMutex
+func (cfg *AsynchronousConfigImpl) countListeners() {
+ atomic.StoreInt32(&cfg.listenerCount, int32(len(cfg.listeners)))
+}
+
+func (cfg *AsynchronousConfigImpl) pushParameterEvent(key config.IParameterKey, access config.ParameterAccess, prevValue config.IParameterValue, origin *listenerFrame, write *asyncWrite) {
+ var event config.ParameterEvent
+ if write != nil {
+  event = writeEvent(write.changes, key)
+ } else {
+  event = readEvent(key, prevValue)
+ }
+ cfg.pushEvent(asyncEvent{key, access, prevValue, event, origin, write, nil})
+}
+
+//Reads are stamped while holding queueMutex and writes while holding the parameterMutex write lock, which their
+//events are queued under, so events are queued in the order of their sequence numbers. Once closed, only the events
+//raised by listeners and rollbacks are queued while the event loop drains; reads are still served after closing and
+//writes that raced Close are still stored, they just no longer raise events, the event loop may already have stopped.
+func (cfg *AsynchronousConfigImpl) pushEvent(event asyncEvent) {
+ cfg.queueMutex.Lock()
+ defer cfg.queueMutex.Unlock()
+ if cfg.closed && event.origin == nil && (event.write == nil || !event.write.compensating) {
+  return
+ }
+ if event.access == config.PARAMETER_ACCESS_READ {
+  cfg.changeLog.stampRead(&event.event)
+ }
+ cfg.queue = append(cfg.queue, event)
+ cfg.pending++
+ cfg.queued.Signal()
+}
+
+//Events raised by listeners are still accepted while the event loop drains after Close
+func (cfg *AsynchronousConfigImpl) ensureOpen(origin *listenerFrame) {
+ cfg.queueMutex.Lock()
+ closed := cfg.closed
+ cfg.queueMutex.Unlock()
+ if closed && origin == nil {
+  panic(fmt.Errorf(closedBus))
+ }
+}
+
+func (cfg *AsynchronousConfigImpl) eventLoop() {
+ defer close(cfg.stopped)
+ for {
+  cfg.queueMutex.Lock()
+  for len(cfg.queue) == 0 && !cfg.closed {
+   cfg.queued.Wait()
+  }
+  if len(cfg.queue) == 0 {
+   //closed and fully drained
+   cfg.queueMutex.Unlock()
+   return
+  }
+  event := cfg.queue[0]
+  cfg.queue[0] = asyncEvent{}
+  cfg.queue = cfg.queue[1:]
+  cfg.queueMutex.Unlock()
+
+  cfg.dispatch(event)
+
+  cfg.queueMutex.Lock()
+  cfg.pending--
+  if cfg.pending == 0 {
+   cfg.drained.Broadcast()
+  }
+  cfg.queueMutex.Unlock()
+ }
+}
+
+//The events of a write that has been rolled back are dropped, the listeners that were notified of the write before
+//the rollback are notified of the rollback instead
+func (cfg *AsynchronousConfigImpl) dispatch(event asyncEvent) {
+ if event.write != nil && event.write.reverted {
+  return
+ }
+ cfg.listenerMutex.Lock()
+ accessListeners := event.listeners
+ if accessListeners == nil {
+  accessListeners = keyListeners(cfg.listeners, cfg.groups, event.key)
+ }
+ errorHandler := cfg.errorHandler
+ rollback := event.write != nil && !event.write.compensating && cfg.errorPolicies.rollback(event.key)
+ cfg.listenerMutex.Unlock()
+ var shared *listenerEvent
+ for _, listener := range accessListeners {
+  //don't notify a listener of a change it made itself
+  if listener.ParameterAccess & event.access != 0 {
+   if event.origin == nil || event.origin.ParameterListener != listener.ParameterListener {
+    if shared == nil {
+     shared = &listenerEvent{event: event.event}
+     if event.write != nil {
+      shared.changes = event.write.changes
+     }
+    }
+    if err := cfg.invoke(errorHandler, event, shared, listener.ParameterListener, rollback); err != nil {
+     cfg.rollbackWrite(errorHandler, event, listener.ParameterListener, err)
+     return
+    }
+    if event.write != nil && !event.write.compensating {
+     event.write.invoked[event.key] = append(event.write.invoked[event.key], listener)
+    }
+   }
+  }
+ }
+}
+
+//With rollback set, the error of the listener is returned instead of being reported
+func (cfg *AsynchronousConfigImpl) invoke(errorHandler config.CallbackErrorHandler, event asyncEvent, shared *listenerEvent, listener *config.ParameterListener, rollback bool) error {
+ defer cfg.detectLoopPanic()
+ active := activeListener{event.key, listener, event.access}
+ invoke := *listener
+ if err := checkListenerChain(event.origin, active, int(atomic.LoadInt32(&cfg.maxDepth))); err != nil {
+  errorHandler(invoke, event.access, event.key, err)
+  return nil
+ }
+ context := &asyncListenerContext{cfg, newListenerFrame(active, event.origin), shared}
+ if err := invoke(context, event.prev); err != nil {
+  if rollback {
+   return err
+  }
+  errorHandler(invoke, event.access, event.key, err)
+ }
+ return nil
+}
+
+//Reverts the write of the event, queues the notifications of the rollback for the listeners that were already
+//notified of the write and reports the *config.RollbackError, the writer has long returned
+func (cfg *AsynchronousConfigImpl) rollbackWrite(errorHandler config.CallbackErrorHandler, event asyncEvent, listener *config.ParameterListener, err error) {
+ write := event.write
+ write.reverted = true
+ cfg.parameterMutex.Lock()
+ reverted := revertWrites(mapStore(cfg.parameters), write.writes, write.undo)
+ cfg.changeLog.record(event.origin, reverted)
+ compensation := &asyncWrite{changes: reverted, compensating: true}
+ for _, change := range reverted {
+  if invoked := write.invoked[change.Key]; len(invoked) > 0 {
+   compensating := writeEvent(reverted, change.Key)
+   cfg.pushEvent(asyncEvent{change.Key, writeAccess(change.Kind), change.Prev, compensating, event.origin, compensation, invoked})
+  }
+ }
+ cfg.parameterMutex.Unlock()
+ errorHandler(*listener, event.access, event.key, &config.RollbackError{Key: event.key, Err: err, Reverted: reverted})
+}
+
+func (cfg *AsynchronousConfigImpl) getParameter(origin *listenerFrame, key config.IParameterKey) (config.IParameterValue, bool) {
+ key = cfg.keys.resolve(key)
+ cfg.parameterMutex.RLock()
+ value, ok := cfg.parameters[key]
+ //queued before a writer can replace the value
+ if cfg.listening() {
+  cfg.pushParameterEvent(key, config.PARAMETER_ACCESS_READ, value, origin, nil)
+ }
+ cfg.parameterMutex.RUnlock()
+ if !ok {
+  return nil, false
+ }
+ return value, true
+}
+
+//Stores every write under a single lock acquisition and queues their WRITE events with the full change set before
+//releasing it, so concurrent writers queue their events in the order they stored their values. Keys must already be
+//resolved and values validated. Fills undo with the previous contents of the bus for every write.
+func (cfg *AsynchronousConfigImpl) applyWrites(origin *listenerFrame, writes, undo []stagedWrite) {
+ //the change of a single write stays on the stack unless listeners are notified of it
+ var buffer [1]config.ParameterChange
+ cfg.parameterMutex.Lock()
+ defer cfg.parameterMutex.Unlock()
+ stored := storeWrites(mapStore(cfg.parameters), writes, undo, buffer[:0], cfg.suppressUnchanged)
+ cfg.changeLog.record(origin, stored)
+ if len(stored) == 0 || !cfg.listening() {
+  return
+ }
+ //the events outlive the call
+ write := &asyncWrite{
+  writes: append([]stagedWrite(nil), writes...),
+  undo: append([]stagedWrite(nil), undo...),
+  changes: append(config.ChangeSet(nil), stored...),
+  invoked: map[config.IParameterKey][]config.ParameterListenerEntry{},
+ }
+ for _, change := range write.changes {
+  cfg.pushParameterEvent(change.Key, writeAccess(change.Kind), change.Prev, origin, write)
+ }
+}
+
+func (cfg *AsynchronousConfigImpl) trySetParameter(origin *listenerFrame, key config.IParameterKey, value config.IParameterValue) error {
+ key = cfg.keys.resolve(key)
+ cfg.ensureOpen(origin)
+ if err := cfg.validators.validate(key, value); err != nil {
+  return err
+ }
+ var undo [1]stagedWrite
+ cfg.applyWrites(origin, []stagedWrite{{key: key, value: value}}, undo[:])
  return nil
 }
+
+func (cfg *AsynchronousConfigImpl) setParameter(origin *listenerFrame, key config.IParameterKey, value config.IParameterValue) {
+ if err := cfg.trySetParameter(origin, key, value); err != nil {
+  panic(err)
+ }
+}
+
+//Like the synchronous bus, the READ event reports the default as its prev
+func (cfg *AsynchronousConfigImpl) getParameterOr(origin *listenerFrame, key config.IParameterKey, value config.IParameterValue) config.IParameterValue {
+ key = cfg.keys.resolve(key)
+ ret := value
+ cfg.parameterMutex.RLock()
+ if val, ok := cfg.parameters[key]; ok {
+  ret = val
+ }
+ if cfg.listening() {
+  cfg.pushParameterEvent(key, config.PARAMETER_ACCESS_READ, value, origin, nil)
+ }
+ cfg.parameterMutex.RUnlock()
+ return ret
+}
+
+func (cfg *AsynchronousConfigImpl) getParameters(origin *listenerFrame) config.Parameters {
+ //shallow copy parameters to prevent mutations
+ params := config.Parameters{}
+ cfg.parameterMutex.RLock()
+ for k, v := range cfg.parameters {
+  params[k] = v
+ }
+ //fire read events
+ if cfg.listening() {
+  for k, v := range params {
+   cfg.pushParameterEvent(k, config.PARAMETER_ACCESS_READ, v, origin, nil)
+  }
+ }
+ cfg.parameterMutex.RUnlock()
+ return params
+}
+
+//transactionalBus
+func (cfg *AsynchronousConfigImpl) commit(origin *listenerFrame, writes []stagedWrite) ([]stagedWrite, error) {
+ writes = resolveWrites(&cfg.keys, writes)
+ cfg.ensureOpen(origin)
+ if err := validateWrites(&cfg.validators, writes); err != nil {
+  return nil, err
+ }
+ undo := make([]stagedWrite, len(writes))
+ cfg.applyWrites(origin, writes, undo)
+ return undo, nil
+}
+
+func (cfg *AsynchronousConfigImpl) snapshotWrites(snapshot config.Snapshot) []stagedWrite {
+ cfg.parameterMutex.RLock()
+ defer cfg.parameterMutex.RUnlock()
+ return restoreWrites(cfg.parameters, snapshot.GetParameters(), nil)
+}
+
+//originWriter
+func (cfg *AsynchronousConfigImpl) writeParent() *listenerFrame {
+ return nil
+}
+
+func (cfg *AsynchronousConfigImpl) trySetParameters(origin *listenerFrame, params map[config.IParameterKey]config.IParameterValue) error {
+ _, err := cfg.commit(origin, parameterWrites(params))
+ return err
+}
+
+func (cfg *AsynchronousConfigImpl) setParameters(origin *listenerFrame, params map[config.IParameterKey]config.IParameterValue) {
+ if err := cfg.trySetParameters(origin, params); err != nil {
+  panic(err)
+ }
+}
+
+func (cfg *AsynchronousConfigImpl) removeParameter(origin *listenerFrame, key config.IParameterKey) (config.IParameterValue, bool) {
+ key = cfg.keys.resolve(key)
+ cfg.ensureOpen(origin)
+ var undo [1]stagedWrite
+ cfg.applyWrites(origin, []stagedWrite{{key: key, remove: true}}, undo[:])
+ return undo[0].value, !undo[0].remove
+}
+
+//config.IConfigBus
+func (cfg *AsynchronousConfigImpl) AddParameterListener(key config.IParameterKey, access config.ParameterAccess, listener config.ParameterListener) config.IListenerHandle {
+ defer cfg.detectPanic()
+ key = cfg.keys.resolve(key)
+ if listener == nil {
+  panic(fmt.Errorf(nilListener))
+ }
+ cfg.ensureOpen(nil)
+ cfg.listenerMutex.Lock()
+ defer cfg.listenerMutex.Unlock()
+ //every registration gets its own entry, even when the same listener is registered more than once
+ entry := &listener
+ addListenerEntry(cfg.listeners, key, access, entry)
+ cfg.countListeners()
+ return &listenerHandle{cfg, key, entry}
+}
+
+func (cfg *AsynchronousConfigImpl) AddGroupListener(matcher config.IKeyMatcher, access config.ParameterAccess, listener config.ParameterListener) config.IListenerHandle {
+ defer cfg.detectPanic()
+ if matcher == nil {
+  panic(fmt.Errorf(nilMatcher))
+ }
+ if listener == nil {
+  panic(fmt.Errorf(nilListener))
+ }
+ cfg.ensureOpen(nil)
+ cfg.listenerMutex.Lock()
+ defer cfg.listenerMutex.Unlock()
+ group := &keyGroup{matcher}
+ entry := &listener
+ addListenerEntry(cfg.listeners, group, access, entry)
+ cfg.groups = addKeyGroup(cfg.groups, group)
+ cfg.countListeners()
+ return &listenerHandle{cfg, group, entry}
+}
+
+//Deprecated: use the config.IListenerHandle returned by AddParameterListener instead
+func (cfg *AsynchronousConfigImpl) RemoveParameterListener(key config.IParameterKey, access config.ParameterAccess, toRemove config.ParameterListener) {
+ defer cfg.detectPanic()
+ key = cfg.keys.resolve(key)
+ cfg.listenerMutex.Lock()
+ defer cfg.listenerMutex.Unlock()
+ if listener, prev, ok := findListenerFunc(cfg.listeners, key, toRemove); ok && prev & access != 0 {
+  updateListenerEntry(cfg.listeners, key, listener, ^(^prev | access))
+  cfg.countListeners()
+ }
+}
+
+//listenerRegistry
+func (cfg *AsynchronousConfigImpl) updateListener(key config.IParameterKey, listener *config.ParameterListener, access config.ParameterAccess) bool {
+ cfg.listenerMutex.Lock()
+ defer cfg.listenerMutex.Unlock()
+ updated := updateListenerEntry(cfg.listeners, key, listener, access)
+ cfg.groups = pruneKeyGroup(cfg.listeners, cfg.groups, key)
+ cfg.countListeners()
+ return updated
+}
+
+func (cfg *AsynchronousConfigImpl) listenerAccess(key config.IParameterKey, listener *config.ParameterListener) (config.ParameterAccess, bool) {
+ cfg.listenerMutex.Lock()
+ defer cfg.listenerMutex.Unlock()
+ return findListenerEntry(cfg.listeners, key, listener)
+}
+
+func (cfg *AsynchronousConfigImpl) GetParameterListeners(key config.IParameterKey) []config.ParameterListenerEntry {
+ defer cfg.detectPanic()
+ key = cfg.keys.resolve(key)
+ cfg.listenerMutex.Lock()
+ defer cfg.listenerMutex.Unlock()
+ if listeners, ok := cfg.listeners[key]; ok {
+  toReturn := make([]config.ParameterListenerEntry, len(*listeners))
+  copy(toReturn, *listeners)
+  return toReturn
+ }
+ return []config.ParameterListenerEntry{}
+}
+
+func (cfg *AsynchronousConfigImpl) SetCallbackErrorHandler(h config.CallbackErrorHandler) config.CallbackErrorHandler {
+ gas.AssertNonNil(h)
+ cfg.listenerMutex.Lock()
+ defer cfg.listenerMutex.Unlock()
+ prev := cfg.errorHandler
+ cfg.errorHandler = h
+ return prev
+}
+
+func (cfg *AsynchronousConfigImpl) SetUnexpectedPanicHandler(h config.PanicHandler) config.PanicHandler {
+ gas.AssertNonNil(h)
+ cfg.listenerMutex.Lock()
+ defer cfg.listenerMutex.Unlock()
+ prev := cfg.panicHandler
+ cfg.panicHandler = h
+ return prev
+}
+
+func (cfg *AsynchronousConfigImpl) SetMaxListenerDepth(depth int) int {
+ return int(atomic.SwapInt32(&cfg.maxDepth, int32(depth)))
+}
+
+func (cfg *AsynchronousConfigImpl) SetKeyRegistry(registry config.IKeyRegistry) config.IKeyRegistry {
+ return cfg.keys.swap(registry)
+}
+
+func (cfg *AsynchronousConfigImpl) GetParameter(key config.IParameterKey) (config.IParameterValue, bool) {
+ defer cfg.detectPanic()
+ return cfg.getParameter(nil, key)
+}
+
+func (cfg *AsynchronousConfigImpl) GetParameterOr(key config.IParameterKey, value config.IParameterValue) config.IParameterValue {
+ defer cfg.detectPanic()
+ return cfg.getParameterOr(nil, key, value)
+}
+
+func (cfg *AsynchronousConfigImpl) GetParameters() config.Parameters {
+ defer cfg.detectPanic()
+ return cfg.getParameters(nil)
+}
+
+func (cfg *AsynchronousConfigImpl) SetParameter(key config.IParameterKey, value config.IParameterValue) {
+ defer cfg.detectPanic()
+ cfg.setParameter(nil, key, value)
+}
+
+func (cfg *AsynchronousConfigImpl) SetParameters(params map[config.IParameterKey]config.IParameterValue) {
+ defer cfg.detectPanic()
+ cfg.setParameters(nil, params)
+}
+
+func (cfg *AsynchronousConfigImpl) RemoveParameter(key config.IParameterKey) (config.IParameterValue, bool) {
+ defer cfg.detectPanic()
+ return cfg.removeParameter(nil, key)
+}
+
+func (cfg *AsynchronousConfigImpl) AddParameterValidator(key config.IParameterKey, validator config.ParameterValidator) config.IValidatorHandle {
+ defer cfg.detectPanic()
+ return cfg.validators.add(cfg.keys.resolve(key), validator)
+}
+
+func (cfg *AsynchronousConfigImpl) TrySetParameter(key config.IParameterKey, value config.IParameterValue) error {
+ defer cfg.detectPanic()
+ return cfg.trySetParameter(nil, key, value)
+}
+
+func (cfg *AsynchronousConfigImpl) TrySetParameters(params map[config.IParameterKey]config.IParameterValue) error {
+ defer cfg.detectPanic()
+ return cfg.trySetParameters(nil, params)
+}
+
+func (cfg *AsynchronousConfigImpl) Begin() config.ITransaction {
+ return newTransaction(cfg, nil, nil)
+}
+
+func (cfg *AsynchronousConfigImpl) SetListenerErrorPolicy(policy config.ListenerErrorPolicy) config.ListenerErrorPolicy {
+ cfg.listenerMutex.Lock()
+ defer cfg.listenerMutex.Unlock()
+ return cfg.errorPolicies.set(policy)
+}
+
+func (cfg *AsynchronousConfigImpl) SetKeyListenerErrorPolicy(key config.IParameterKey, policy config.ListenerErrorPolicy) config.ListenerErrorPolicy {
+ defer cfg.detectPanic()
+ key = cfg.keys.resolve(key)
+ cfg.listenerMutex.Lock()
+ defer cfg.listenerMutex.Unlock()
+ return cfg.errorPolicies.setKey(key, policy)
+}
+
+func (cfg *AsynchronousConfigImpl) SetHistory(history config.IHistory) config.IHistory {
+ cfg.parameterMutex.Lock()
+ defer cfg.parameterMutex.Unlock()
+ return cfg.changeLog.setHistory(history)
+}
+
+func (cfg *AsynchronousConfigImpl) SetSuppressUnchanged(suppress bool) bool {
+ cfg.parameterMutex.Lock()
+ defer cfg.parameterMutex.Unlock()
+ prev := cfg.suppressUnchanged
+ cfg.suppressUnchanged = suppress
+ return prev
+}
+
+func (cfg *AsynchronousConfigImpl) Snapshot() config.Snapshot {
+ cfg.parameterMutex.RLock()
+ defer cfg.parameterMutex.RUnlock()
+ return config.NewSnapshot(cfg.parameters)
+}
+
+func (cfg *AsynchronousConfigImpl) Restore(snapshot config.Snapshot) error {
+ defer cfg.detectPanic()
+ return cfg.restore(nil, snapshot)
+}
+
+func (cfg *AsynchronousConfigImpl) restore(parent *listenerFrame, snapshot config.Snapshot) error {
+ _, err := cfg.commit(parent, cfg.snapshotWrites(snapshot))
+ return err
+}
+
+func (cfg *AsynchronousConfigImpl) WithOrigin(origin config.WriteOrigin) config.IConfigBus {
+ return newOriginConfig(cfg, origin)
+}
+
+func (cfg *AsynchronousConfigImpl) Explain(key config.IParameterKey) config.Explanation {
+ defer cfg.detectPanic()
+ key = cfg.keys.resolve(key)
+ cfg.parameterMutex.RLock()
+ defer cfg.parameterMutex.RUnlock()
+ return cfg.changeLog.explain(mapStore(cfg.parameters), key)
+}
+
+//config.IAsynchronousConfigBus
+//Must not be called from a listener, the event loop would wait on itself
+func (cfg *AsynchronousConfigImpl) Drain() {
+ cfg.queueMutex.Lock()
+ for cfg.pending != 0 {
+  cfg.drained.Wait()
+ }
+ cfg.queueMutex.Unlock()
+ cfg.raiseEscapedPanic()
+}
+
+//Must not be called from a listener, the event loop would wait on itself
+func (cfg *AsynchronousConfigImpl) Close() {
+ cfg.queueMutex.Lock()
+ cfg.closed = true
+ cfg.queued.Broadcast()
+ cfg.queueMutex.Unlock()
+ <-cfg.stopped
+ cfg.raiseEscapedPanic()
+}
+
+//config.IListenerContext
+func (context *asyncListenerContext) Key() config.IParameterKey {
+ return context.IParameterKey
+}
+
+func (context *asyncListenerContext) Value() (config.IParameterValue, bool) {
+ return context.GetParameter(context.IParameterKey)
+}
+
+func (context *asyncListenerContext) ValueOr(or config.IParameterValue) config.IParameterValue {
+ if val, ok := context.Value(); ok {
+  return val
+ }
+ return or
+}
+
+func (context *asyncListenerContext) SetValue(value config.IParameterValue) {
+ context.SetParameter(context.IParameterKey, value)
+}
+
+func (context *asyncListenerContext) Config() config.IConfigBus {
+ return context
+}
+
+func (context *asyncListenerContext) AccessType() config.ParameterAccess {
+ return legacyAccess(context.ParameterAccess)
+}
+
+func (context *asyncListenerContext) Changes() config.ChangeSet {
+ return append(config.ChangeSet(nil), context.changes...)
+}
+
+func (context *asyncListenerContext) Origin() *config.WriteOrigin {
+ return context.event.Origin
+}
+
+func (context *asyncListenerContext) Event() config.ParameterEvent {
+ return context.event
+}
+
+//config.IConfigBus, bound to the listener invocation
+func (context *asyncListenerContext) AddParameterListener(key config.IParameterKey, access config.ParameterAccess, listener config.ParameterListener) config.IListenerHandle {
+ return context.cfg.AddParameterListener(key, access, listener)
+}
+
+func (context *asyncListenerContext) AddGroupListener(matcher config.IKeyMatcher, access config.ParameterAccess, listener config.ParameterListener) config.IListenerHandle {
+ return context.cfg.AddGroupListener(matcher, access, listener)
+}
+
+func (context *asyncListenerContext) RemoveParameterListener(key config.IParameterKey, access config.ParameterAccess, toRemove config.ParameterListener) {
+ context.cfg.RemoveParameterListener(key, access, toRemove)
+}
+
+func (context *asyncListenerContext) GetParameterListeners(key config.IParameterKey) []config.ParameterListenerEntry {
+ return context.cfg.GetParameterListeners(key)
+}
+
+func (context *asyncListenerContext) SetCallbackErrorHandler(h config.CallbackErrorHandler) config.CallbackErrorHandler {
+ return context.cfg.SetCallbackErrorHandler(h)
+}
+
+func (context *asyncListenerContext) SetUnexpectedPanicHandler(h config.PanicHandler) config.PanicHandler {
+ return context.cfg.SetUnexpectedPanicHandler(h)
+}
+
+func (context *asyncListenerContext) SetMaxListenerDepth(depth int) int {
+ return context.cfg.SetMaxListenerDepth(depth)
+}
+
+func (context *asyncListenerContext) SetKeyRegistry(registry config.IKeyRegistry) config.IKeyRegistry {
+ return context.cfg.SetKeyRegistry(registry)
+}
+
+func (context *asyncListenerContext) GetParameter(key config.IParameterKey) (config.IParameterValue, bool) {
+ return context.cfg.getParameter(&context.listenerFrame, key)
+}
+
+func (context *asyncListenerContext) GetParameterOr(key config.IParameterKey, value config.IParameterValue) config.IParameterValue {
+ return context.cfg.getParameterOr(&context.listenerFrame, key, value)
+}
+
+func (context *asyncListenerContext) GetParameters() config.Parameters {
+ return context.cfg.getParameters(&context.listenerFrame)
+}
+
+func (context *asyncListenerContext) SetParameter(key config.IParameterKey, value config.IParameterValue) {
+ context.cfg.setParameter(&context.listenerFrame, key, value)
+}
+
+func (context *asyncListenerContext) SetParameters(params map[config.IParameterKey]config.IParameterValue) {
+ context.cfg.setParameters(&context.listenerFrame, params)
+}
+
+func (context *asyncListenerContext) RemoveParameter(key config.IParameterKey) (config.IParameterValue, bool) {
+ return context.cfg.removeParameter(&context.listenerFrame, key)
+}
+
+func (context *asyncListenerContext) AddParameterValidator(key config.IParameterKey, validator config.ParameterValidator) config.IValidatorHandle {
+ return context.cfg.AddParameterValidator(key, validator)
+}
+
+func (context *asyncListenerContext) TrySetParameter(key config.IParameterKey, value config.IParameterValue) error {
+ return context.cfg.trySetParameter(&context.listenerFrame, key, value)
+}
+
+func (context *asyncListenerContext) TrySetParameters(params map[config.IParameterKey]config.IParameterValue) error {
+ return context.cfg.trySetParameters(&context.listenerFrame, params)
+}
+
+//Commits are attributed to the listener, like any other write made through the context
+func (context *asyncListenerContext) Begin() config.ITransaction {
+ return newTransaction(context.cfg, &context.listenerFrame, nil)
+}
+
+func (context *asyncListenerContext) SetListenerErrorPolicy(policy config.ListenerErrorPolicy) config.ListenerErrorPolicy {
+ return context.cfg.SetListenerErrorPolicy(policy)
+}
+
+func (context *asyncListenerContext) SetKeyListenerErrorPolicy(key config.IParameterKey, policy config.ListenerErrorPolicy) config.ListenerErrorPolicy {
+ return context.cfg.SetKeyListenerErrorPolicy(key, policy)
+}
+
+func (context *asyncListenerContext) SetHistory(history config.IHistory) config.IHistory {
+ return context.cfg.SetHistory(history)
+}
+
+func (context *asyncListenerContext) SetSuppressUnchanged(suppress bool) bool {
+ return context.cfg.SetSuppressUnchanged(suppress)
+}
+
+func (context *asyncListenerContext) Snapshot() config.Snapshot {
+ return context.cfg.Snapshot()
+}
+
+func (context *asyncListenerContext) Restore(snapshot config.Snapshot) error {
+ return context.cfg.restore(&context.listenerFrame, snapshot)
+}
+
+func (context *asyncListenerContext) WithOrigin(origin config.WriteOrigin) config.IConfigBus {
+ return newOriginConfig(context, origin)
+}
+
+func (context *asyncListenerContext) Explain(key config.IParameterKey) config.Explanation {
+ return context.cfg.Explain(key)
+}
+
+//originWriter
+func (context *asyncListenerContext) commit(parent *listenerFrame, writes []stagedWrite) ([]stagedWrite, error) {
+ return context.cfg.commit(parent, writes)
+}
+
+func (context *asyncListenerContext) snapshotWrites(snapshot config.Snapshot) []stagedWrite {
+ return context.cfg.snapshotWrites(snapshot)
+}
+
+func (context *asyncListenerContext) writeParent() *listenerFrame {
+ return &context.listenerFrame
+}
+
+func (context *asyncListenerContext) getPanicHandler() config.PanicHandler {
+ return context.cfg.getPanicHandler()
+}
+
+func NewAsynchronousConfigBus() config.IAsynchronousConfigBus {
+ cfg := &AsynchronousConfigImpl{
+  parameters: config.Parameters{},
+  listeners: config.ParameterListeners{},
+  errorHandler: defaultCallbackErrorHandler,
+  panicHandler: defaultPanicHandler,
+  maxDepth: config.DEFAULT_MAX_LISTENER_DEPTH,
+  errorPolicies: errorPolicies{policy: config.LISTENER_ERROR_REPORT},
+  stopped: make(chan struct{}),
+ }
+ cfg.queued = sync.NewCond(&cfg.queueMutex)
+ cfg.drained = sync.NewCond(&cfg.queueMutex)
+ go cfg.eventLoop()
+ return cfg
+}
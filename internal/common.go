@@ -0,0 +1,161 @@
+package internal
+
+import (
+ "fmt"
+ "sync"
+ "sync/atomic"
+ "unsafe"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+const nilListener = "Cannot add a nil parameter listener!\n"
+
+type activeListener struct {
+ config.IParameterKey
+ *config.ParameterListener
+ config.ParameterAccess
+}
+
+//A single listener invocation, linked to the invocation that caused it (if any)
+type listenerFrame struct {
+ activeListener
+ parent *listenerFrame
+ depth  int
+}
+
+//The event a listener invocation is notified of, shared by the contexts of every listener notified of it
+type listenerEvent struct {
+ changes config.ChangeSet
+ event   config.ParameterEvent
+}
+
+func newListenerFrame(listener activeListener, parent *listenerFrame) listenerFrame {
+ depth := 1
+ if parent != nil {
+  depth += parent.depth
+ }
+ return listenerFrame{listener, parent, depth}
+}
+
+func (frame *listenerFrame) chain(next activeListener) config.ListenerChain {
+ chain := make(config.ListenerChain, frame.depth + 1)
+ chain[frame.depth] = config.ListenerChainEntry{
+  Key: next.IParameterKey,
+  ParameterAccess: next.ParameterAccess,
+  ParameterListener: next.ParameterListener,
+ }
+ for f := frame; f != nil; f = f.parent {
+  chain[f.depth - 1] = config.ListenerChainEntry{
+   Key: f.IParameterKey,
+   ParameterAccess: f.ParameterAccess,
+   ParameterListener: f.ParameterListener,
+  }
+ }
+ return chain
+}
+
+//Returns a *config.ListenerCycleError if the next listener is already active further up the chain, or a
+//*config.ListenerDepthError if invoking it would exceed maxDepth. A listener re-entering itself directly is not an
+//error, the caller silently skips it instead.
+//
+//Walking the chain is O(D) for a chain of depth D, top level events (parent == nil) are free.
+func checkListenerChain(parent *listenerFrame, next activeListener, maxDepth int) error {
+ if parent == nil {
+  return nil
+ }
+ for frame := parent.parent; frame != nil; frame = frame.parent {
+  if frame.ParameterListener == next.ParameterListener {
+   return &config.ListenerCycleError{Chain: parent.chain(next)}
+  }
+ }
+ if maxDepth > 0 && parent.depth + 1 > maxDepth {
+  return &config.ListenerDepthError{Chain: parent.chain(next), MaxDepth: maxDepth}
+ }
+ return nil
+}
+
+//Resolves keys through the key registry of a config bus, shared by all config bus implementations. Reads are lock
+//free, so resolving a key never contends with the bus.
+type keyResolver struct {
+ //serializes swaps
+ mutex    sync.Mutex
+ registry atomic.Value
+}
+
+//atomic.Value requires a consistent concrete type
+type keyRegistryHolder struct {
+ config.IKeyRegistry
+}
+
+func (resolver *keyResolver) swap(registry config.IKeyRegistry) config.IKeyRegistry {
+ resolver.mutex.Lock()
+ defer resolver.mutex.Unlock()
+ prev, _ := resolver.registry.Load().(keyRegistryHolder)
+ resolver.registry.Store(keyRegistryHolder{registry})
+ return prev.IKeyRegistry
+}
+
+//Panics with the error of the registry if it rejects the key
+func (resolver *keyResolver) resolve(key config.IParameterKey) config.IParameterKey {
+ holder, _ := resolver.registry.Load().(keyRegistryHolder)
+ if holder.IKeyRegistry == nil {
+  return key
+ }
+ resolved, err := holder.Resolve(key)
+ if err != nil {
+  panic(err)
+ }
+ return resolved
+}
+
+//The listener error policies of a config bus, must only be used while holding the lock that guards the listeners
+type errorPolicies struct {
+ policy config.ListenerErrorPolicy
+ keys   map[config.IParameterKey]config.ListenerErrorPolicy
+}
+
+//LISTENER_ERROR_INHERIT resets the policy of the bus to LISTENER_ERROR_REPORT
+func (policies *errorPolicies) set(policy config.ListenerErrorPolicy) config.ListenerErrorPolicy {
+ if policy == config.LISTENER_ERROR_INHERIT {
+  policy = config.LISTENER_ERROR_REPORT
+ }
+ prev := policies.policy
+ policies.policy = policy
+ return prev
+}
+
+func (policies *errorPolicies) setKey(key config.IParameterKey, policy config.ListenerErrorPolicy) config.ListenerErrorPolicy {
+ prev := policies.keys[key]
+ if policy == config.LISTENER_ERROR_INHERIT {
+  delete(policies.keys, key)
+ } else {
+  if policies.keys == nil {
+   policies.keys = map[config.IParameterKey]config.ListenerErrorPolicy{}
+  }
+  policies.keys[key] = policy
+ }
+ return prev
+}
+
+func (policies *errorPolicies) rollback(key config.IParameterKey) bool {
+ if policy, ok := policies.keys[key]; ok {
+  return policy == config.LISTENER_ERROR_ROLLBACK
+ }
+ return policies.policy == config.LISTENER_ERROR_ROLLBACK
+}
+
+//Default handlers shared by all config bus implementations
+func defaultCallbackErrorHandler(active config.ParameterListener, access config.ParameterAccess, key config.IParameterKey, err error) {
+ panic(fmt.Errorf(
+  "Encountered unexpected error from listener 0x%x on 0x%x access of [%v]:\n%s\n",
+  unsafe.Pointer(&active),
+  access,
+  key.Key(),
+  err.Error(),
+ ))
+}
+
+func defaultPanicHandler(p interface{}) {
+ panic(p)
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+ "fmt"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+const nilMatcher = "Cannot add a group listener without a key matcher!\n"
+
+//Stands in for the keys selected by a matcher in the listeners of a config bus, every group listener has a group of
+//its own
+type keyGroup struct {
+ matcher config.IKeyMatcher
+}
+
+func (group *keyGroup) Key() interface{} {
+ return group.matcher.String()
+}
+
+func (group *keyGroup) String() string {
+ return fmt.Sprintf("group(%s)", group.matcher.String())
+}
+
+//The helpers below must be called while holding the lock that guards the listeners, groups are copy-on-write just
+//like the listener slices.
+
+func addKeyGroup(groups []*keyGroup, group *keyGroup) []*keyGroup {
+ updated := make([]*keyGroup, len(groups), len(groups) + 1)
+ copy(updated, groups)
+ return append(updated, group)
+}
+
+//Drops the group once its listener has been removed
+func pruneKeyGroup(listeners config.ParameterListeners, groups []*keyGroup, key config.IParameterKey) []*keyGroup {
+ group, ok := key.(*keyGroup)
+ if !ok {
+  return groups
+ }
+ if _, ok := listeners[group]; ok {
+  return groups
+ }
+ updated := make([]*keyGroup, 0, len(groups))
+ for _, g := range groups {
+  if g != group {
+   updated = append(updated, g)
+  }
+ }
+ return updated
+}
+
+//Returns the listeners of the key followed by the listeners of every group that matches it, in registration order.
+//The returned slice is never mutated.
+func keyListeners(listeners config.ParameterListeners, groups []*keyGroup, key config.IParameterKey) []config.ParameterListenerEntry {
+ var direct []config.ParameterListenerEntry
+ if accessListeners, ok := listeners[key]; ok {
+  direct = *accessListeners
+ }
+ merged := direct
+ for _, group := range groups {
+  accessListeners, ok := listeners[group]
+  if !ok || !group.matcher.Match(key) {
+   continue
+  }
+  if len(merged) == len(direct) {
+   //never append to the slice of the key
+   merged = append([]config.ParameterListenerEntry(nil), direct...)
+  }
+  merged = append(merged, *accessListeners...)
+ }
+ return merged
+}
@@ -0,0 +1,275 @@
+package internal
+
+import (
+ "fmt"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//A synchronous config bus whose store resolves parameters from a stack of layers. Layers are fixed at construction,
+//writes made through a config.IConfigLayer are not attributed to any listener, just like writes made directly through
+//the bus.
+type LayeredConfigImpl struct {
+ *SynchronousConfigImpl
+ layers *layeredStore
+}
+
+//config.IConfigLayer
+type configLayer struct {
+ cfg        *LayeredConfigImpl
+ name       string
+ parameters config.Parameters
+}
+
+//parameterStore, writes go to the highest precedence layer
+type layeredStore struct {
+ //lowest precedence first
+ layers []*configLayer
+ //the resolved value of every parameter
+ effective config.Parameters
+}
+
+func (store *layeredStore) top() *configLayer {
+ return store.layers[len(store.layers) - 1]
+}
+
+//Returns the highest precedence layer that defines the key
+func (store *layeredStore) resolveLayer(key config.IParameterKey) (*configLayer, bool) {
+ for i := len(store.layers) - 1; i >= 0; i-- {
+  if _, ok := store.layers[i].parameters[key]; ok {
+   return store.layers[i], true
+  }
+ }
+ return nil, false
+}
+
+//Re-resolves the effective value of the key after one of its layers changed
+func (store *layeredStore) resolve(key config.IParameterKey) parameterChange {
+ prev, had := store.effective[key]
+ layer, ok := store.resolveLayer(key)
+ if !ok {
+  delete(store.effective, key)
+  return parameterChange{prev, nil, had, changeKind(had, false)}
+ }
+ value := layer.parameters[key]
+ store.effective[key] = value
+ return parameterChange{prev, value, !had || !config.ValuesEqual(prev, value), changeKind(had, true)}
+}
+
+func (store *layeredStore) setIn(layer *configLayer, key config.IParameterKey, value config.IParameterValue) parameterChange {
+ layer.parameters[key] = value
+ return store.resolve(key)
+}
+
+func (store *layeredStore) removeFrom(layer *configLayer, key config.IParameterKey) (config.IParameterValue, bool, parameterChange) {
+ value, ok := layer.parameters[key]
+ if !ok {
+  return nil, false, parameterChange{}
+ }
+ delete(layer.parameters, key)
+ return value, true, store.resolve(key)
+}
+
+func (store *layeredStore) parameters() config.Parameters {
+ return store.effective
+}
+
+func (store *layeredStore) lookup(key config.IParameterKey) (config.IParameterValue, bool) {
+ value, ok := store.top().parameters[key]
+ return value, ok
+}
+
+func (store *layeredStore) set(key config.IParameterKey, value config.IParameterValue) parameterChange {
+ return store.setIn(store.top(), key, value)
+}
+
+func (store *layeredStore) remove(key config.IParameterKey) (config.IParameterValue, bool, parameterChange) {
+ return store.removeFrom(store.top(), key)
+}
+
+//Binds a layer of a layered store to the parameterStore interface, writes go to the layer
+type layerStore struct {
+ *layeredStore
+ layer *configLayer
+}
+
+func (store layerStore) lookup(key config.IParameterKey) (config.IParameterValue, bool) {
+ value, ok := store.layer.parameters[key]
+ return value, ok
+}
+
+func (store layerStore) set(key config.IParameterKey, value config.IParameterValue) parameterChange {
+ return store.setIn(store.layer, key, value)
+}
+
+func (store layerStore) remove(key config.IParameterKey) (config.IParameterValue, bool, parameterChange) {
+ return store.removeFrom(store.layer, key)
+}
+
+//config.ILayeredConfigBus
+func (cfg *LayeredConfigImpl) Layer(name string) config.IConfigLayer {
+ for _, layer := range cfg.layers.layers {
+  if layer.name == name {
+   return layer
+  }
+ }
+ return nil
+}
+
+func (cfg *LayeredConfigImpl) Layers() []string {
+ names := make([]string, len(cfg.layers.layers))
+ for i, layer := range cfg.layers.layers {
+  names[i] = layer.name
+ }
+ return names
+}
+
+func (cfg *LayeredConfigImpl) ResolveLayer(key config.IParameterKey) (string, bool) {
+ defer cfg.detectPanic()
+ key = cfg.keys.resolve(key)
+ cfg.mutex.RLock()
+ defer cfg.mutex.RUnlock()
+ if layer, ok := cfg.layers.resolveLayer(key); ok {
+  return layer.name, true
+ }
+ return "", false
+}
+
+//Captures the parameters of every layer as well
+func (cfg *LayeredConfigImpl) Snapshot() config.Snapshot {
+ cfg.mutex.RLock()
+ defer cfg.mutex.RUnlock()
+ layers := make(map[string]config.Parameters, len(cfg.layers.layers))
+ for _, layer := range cfg.layers.layers {
+  layers[layer.name] = layer.parameters
+ }
+ return config.NewLayeredSnapshot(cfg.layers.effective, layers)
+}
+
+//Resets every layer the snapshot holds to its parameters, layers missing from the snapshot are left alone. Snapshots
+//without layers are restored into the highest precedence layer, so parameters defined by lower layers are kept.
+func (cfg *LayeredConfigImpl) Restore(snapshot config.Snapshot) error {
+ defer cfg.detectPanic()
+ _, err := cfg.commit(nil, cfg.snapshotWrites(snapshot))
+ return err
+}
+
+//transactionalBus
+func (cfg *LayeredConfigImpl) snapshotWrites(snapshot config.Snapshot) []stagedWrite {
+ cfg.mutex.RLock()
+ defer cfg.mutex.RUnlock()
+ var writes []stagedWrite
+ restored := false
+ for _, layer := range cfg.layers.layers {
+  if params, ok := snapshot.Layer(layer.name); ok {
+   writes = append(writes, restoreWrites(layer.parameters, params, layerStore{cfg.layers, layer})...)
+   restored = true
+  }
+ }
+ if !restored {
+  writes = restoreWrites(cfg.layers.effective, snapshot.GetParameters(), nil)
+ }
+ return writes
+}
+
+//Writes made through the view go to the highest precedence layer
+func (cfg *LayeredConfigImpl) WithOrigin(origin config.WriteOrigin) config.IConfigBus {
+ return newOriginConfig(cfg, origin)
+}
+
+//config.IConfigLayer
+func (layer *configLayer) Name() string {
+ return layer.name
+}
+
+func (layer *configLayer) GetParameter(key config.IParameterKey) (config.IParameterValue, bool) {
+ defer layer.cfg.detectPanic()
+ key = layer.cfg.keys.resolve(key)
+ layer.cfg.mutex.RLock()
+ defer layer.cfg.mutex.RUnlock()
+ value, ok := layer.parameters[key]
+ return value, ok
+}
+
+func (layer *configLayer) GetParameters() config.Parameters {
+ defer layer.cfg.detectPanic()
+ layer.cfg.mutex.RLock()
+ defer layer.cfg.mutex.RUnlock()
+ params := make(config.Parameters, len(layer.parameters))
+ for k, v := range layer.parameters {
+  params[k] = v
+ }
+ return params
+}
+
+func (layer *configLayer) SetParameter(key config.IParameterKey, value config.IParameterValue) {
+ defer layer.cfg.detectPanic()
+ if err := layer.trySetParameter(key, value); err != nil {
+  panic(err)
+ }
+}
+
+func (layer *configLayer) SetParameters(params map[config.IParameterKey]config.IParameterValue) {
+ defer layer.cfg.detectPanic()
+ if err := layer.trySetParameters(params); err != nil {
+  panic(err)
+ }
+}
+
+func (layer *configLayer) TrySetParameter(key config.IParameterKey, value config.IParameterValue) error {
+ defer layer.cfg.detectPanic()
+ return layer.trySetParameter(key, value)
+}
+
+func (layer *configLayer) TrySetParameters(params map[config.IParameterKey]config.IParameterValue) error {
+ defer layer.cfg.detectPanic()
+ return layer.trySetParameters(params)
+}
+
+func (layer *configLayer) RemoveParameter(key config.IParameterKey) (config.IParameterValue, bool) {
+ defer layer.cfg.detectPanic()
+ cfg := layer.cfg
+ key = cfg.keys.resolve(key)
+ var undo [1]stagedWrite
+ if err := cfg.applyWrites(nil, layerStore{cfg.layers, layer}, []stagedWrite{{key: key, remove: true}}, undo[:]); err != nil {
+  panic(err)
+ }
+ return undo[0].value, !undo[0].remove
+}
+
+func (layer *configLayer) trySetParameter(key config.IParameterKey, value config.IParameterValue) error {
+ cfg := layer.cfg
+ key = cfg.keys.resolve(key)
+ if err := cfg.validators.validate(key, value); err != nil {
+  return err
+ }
+ var undo [1]stagedWrite
+ return cfg.applyWrites(nil, layerStore{cfg.layers, layer}, []stagedWrite{{key: key, value: value}}, undo[:])
+}
+
+//Every value is validated before any of them is stored
+func (layer *configLayer) trySetParameters(params map[config.IParameterKey]config.IParameterValue) error {
+ cfg := layer.cfg
+ writes := resolveWrites(&cfg.keys, parameterWrites(params))
+ if err := validateWrites(&cfg.validators, writes); err != nil {
+  return err
+ }
+ return cfg.applyWrites(nil, layerStore{cfg.layers, layer}, writes, make([]stagedWrite, len(writes)))
+}
+
+//Layers are named lowest precedence first, ie. config.LAYER_DEFAULTS before config.LAYER_OVERRIDES
+func NewLayeredConfigBus(names ...string) config.ILayeredConfigBus {
+ if len(names) == 0 {
+  panic(fmt.Errorf("A layered config bus requires at least one layer!\n"))
+ }
+ store := &layeredStore{effective: config.Parameters{}}
+ cfg := &LayeredConfigImpl{newSynchronousConfigImpl(store), store}
+ cfg.owner = cfg
+ for _, name := range names {
+  if cfg.Layer(name) != nil {
+   panic(fmt.Errorf("Layer '%s' is defined more than once!\n", name))
+  }
+  store.layers = append(store.layers, &configLayer{cfg, name, config.Parameters{}})
+ }
+ return cfg
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+ "unsafe"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//Implemented by config buses to back their listener handles
+type listenerRegistry interface {
+ //Replaces the access of a registered listener, removing it when access is 0; returns false if the listener is no
+ //longer registered
+ updateListener(key config.IParameterKey, listener *config.ParameterListener, access config.ParameterAccess) bool
+ listenerAccess(key config.IParameterKey, listener *config.ParameterListener) (config.ParameterAccess, bool)
+}
+
+//config.IListenerHandle
+type listenerHandle struct {
+ registry listenerRegistry
+ key      config.IParameterKey
+ listener *config.ParameterListener
+}
+
+func (handle *listenerHandle) Key() config.IParameterKey {
+ return handle.key
+}
+
+func (handle *listenerHandle) Access() config.ParameterAccess {
+ access, _ := handle.registry.listenerAccess(handle.key, handle.listener)
+ return access
+}
+
+func (handle *listenerHandle) Update(access config.ParameterAccess) {
+ handle.registry.updateListener(handle.key, handle.listener, access)
+}
+
+func (handle *listenerHandle) Unsubscribe() {
+ handle.registry.updateListener(handle.key, handle.listener, 0)
+}
+
+//The helpers below must be called while holding the lock that guards the listeners. Listener slices are
+//copy-on-write: existing elements are never modified in place, so in-flight dispatches keep a consistent view of the
+//listeners that were registered when their event was raised.
+
+func addListenerEntry(listeners config.ParameterListeners, key config.IParameterKey, access config.ParameterAccess, listener *config.ParameterListener) {
+ accessListeners, ok := listeners[key]
+ if !ok {
+  accessListeners = &[]config.ParameterListenerEntry{}
+  listeners[key] = accessListeners
+ }
+ //appending never touches the elements visible to in-flight dispatches
+ *accessListeners = append(
+  *accessListeners,
+  config.ParameterListenerEntry{
+   ParameterAccess: access,
+   ParameterListener: listener,
+  },
+ )
+}
+
+func findListenerEntry(listeners config.ParameterListeners, key config.IParameterKey, listener *config.ParameterListener) (config.ParameterAccess, bool) {
+ if accessListeners, ok := listeners[key]; ok {
+  for _, entry := range *accessListeners {
+   if entry.ParameterListener == listener {
+    return entry.ParameterAccess, true
+   }
+  }
+ }
+ return 0, false
+}
+
+//Functions cannot be compared, so listeners are matched by the closure their function value points to: copies of a
+//function value match each other, separately created closures never do
+func findListenerFunc(listeners config.ParameterListeners, key config.IParameterKey, fn config.ParameterListener) (*config.ParameterListener, config.ParameterAccess, bool) {
+ if accessListeners, ok := listeners[key]; ok {
+  for _, entry := range *accessListeners {
+   if funcIdentity(*entry.ParameterListener) == funcIdentity(fn) {
+    return entry.ParameterListener, entry.ParameterAccess, true
+   }
+  }
+ }
+ return nil, 0, false
+}
+
+func funcIdentity(fn config.ParameterListener) unsafe.Pointer {
+ return *(*unsafe.Pointer)(unsafe.Pointer(&fn))
+}
+
+func updateListenerEntry(listeners config.ParameterListeners, key config.IParameterKey, listener *config.ParameterListener, access config.ParameterAccess) bool {
+ accessListeners, ok := listeners[key]
+ if !ok {
+  return false
+ }
+ for i, entry := range *accessListeners {
+  if entry.ParameterListener == listener {
+   //create new slice with all elements except this one
+   updated := make([]config.ParameterListenerEntry, 0, len(*accessListeners))
+   updated = append(updated, (*accessListeners)[:i]...)
+   //remove listener if it no longer listens on any events
+   if access != 0 {
+    updated = append(updated, config.ParameterListenerEntry{
+     ParameterAccess: access,
+     ParameterListener: listener,
+    })
+   }
+   updated = append(updated, (*accessListeners)[i + 1:]...)
+   if len(updated) == 0 {
+    delete(listeners, key)
+   } else {
+    *accessListeners = updated
+   }
+   return true
+  }
+ }
+ return false
+}
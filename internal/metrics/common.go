@@ -2,6 +2,7 @@ package metrics
 
 import (
  "fmt"
+ "strconv"
  "testing"
 
  "github.com/Matthewacon/go-figure"
@@ -25,6 +26,12 @@ func DefaultEnvAndConfig() config.IEnvironment {
  return env
 }
 
+func DefaultEnvAndAsynchronousConfig() (config.IEnvironment, config.IAsynchronousConfigBus) {
+ env := &Environment{ string: "env" }
+ cfg := go_figure.NewAsynchronousConfig(env)
+ return env, cfg
+}
+
 func EnvWithNameAndConfig(name string) config.IEnvironment {
  env := &Environment{ string: name }
  env.SetConfig(env)
@@ -48,3 +55,17 @@ type IntKeyValue int
 func (i IntKeyValue) String() string { return fmt.Sprintf("%d", i) }
 func (i IntKeyValue) Key() interface{} { return i }
 func (i IntKeyValue) Value() interface{} { return i }
+
+func DecodeIntKeyValue(raw string) (config.IParameterValue, error) {
+ i, err := strconv.Atoi(raw)
+ if err != nil {
+  return nil, err
+ }
+ return IntKeyValue(i), nil
+}
+
+func DefaultEnvAndLayeredConfig(layers ...string) (config.IEnvironment, config.ILayeredConfigBus) {
+ env := &Environment{ string: "env" }
+ cfg := go_figure.NewLayeredConfig(env, layers...)
+ return env, cfg
+}
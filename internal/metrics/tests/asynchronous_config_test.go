@@ -0,0 +1,388 @@
+package tests
+
+import (
+ "fmt"
+ "sync"
+ "testing"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+)
+
+func TestAsyncKVInsertionAndRetrieval(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ defer cfg.Close()
+ count := 10000
+ for i := 0; i < count; i++ {
+  cfg.SetParameter(
+   metrics.IntKeyValue(i),
+   metrics.IntKeyValue(-i),
+  )
+ }
+ if num := len(cfg.GetParameters()); num != count {
+  t.Errorf(
+   "Failed to insert all KV parameter pairs, inserted: %d, retrieved: %d\n",
+   count,
+   num,
+  )
+  return
+ }
+ for i := 0; i < count; i++ {
+  value, ok := cfg.GetParameter(metrics.IntKeyValue(i))
+  if !ok || value != metrics.IntKeyValue(-i) {
+   t.Errorf("Failed to verify kv config pair [%d,%d]\n", i, -i)
+   return
+  }
+ }
+}
+
+func TestAsyncSetParameterDoesNotWaitForListeners(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ defer cfg.Close()
+ kv := metrics.IntKeyValue(0)
+ release := make(chan struct{})
+ cfg.AddParameterListener(
+  kv,
+  config.PARAMETER_ACCESS_WRITE,
+  func(context config.IListenerContext, prev config.IParameterValue) error {
+   <-release
+   return nil
+  },
+ )
+ //would deadlock if SetParameter waited for the listener
+ cfg.SetParameter(kv, kv)
+ if value, ok := cfg.GetParameter(kv); !ok || value != kv {
+  t.Errorf("Value was not stored before the listener ran!\n")
+ }
+ close(release)
+ cfg.Drain()
+}
+
+func TestAsyncPerKeyFIFO(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ defer cfg.Close()
+ count := 1000
+ keys := []metrics.IntKeyValue{0, 1, 2}
+ received := map[config.IParameterKey][]config.IParameterValue{}
+ for _, key := range keys {
+  cfg.AddParameterListener(
+   key,
+   config.PARAMETER_ACCESS_WRITE,
+   func(context config.IListenerContext, prev config.IParameterValue) error {
+    received[context.Key()] = append(received[context.Key()], prev)
+    return nil
+   },
+  )
+ }
+ for i := 0; i < count; i++ {
+  for _, key := range keys {
+   cfg.SetParameter(key, metrics.IntKeyValue(i))
+  }
+ }
+ cfg.Drain()
+ for _, key := range keys {
+  events := received[key]
+  if len(events) != count {
+   t.Errorf("Expected %d events for key '%d', received %d\n", count, key, len(events))
+   return
+  }
+  if events[0] != nil {
+   t.Errorf("First event for key '%d' should have no previous value\n", key)
+  }
+  for i := 1; i < count; i++ {
+   if events[i] != metrics.IntKeyValue(i - 1) {
+    t.Errorf(
+     "Events for key '%d' were delivered out of order, expected previous value: '%d', received: '%v'\n",
+     key,
+     i - 1,
+     events[i],
+    )
+    return
+   }
+  }
+ }
+}
+
+func TestAsyncConcurrentWriters(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ defer cfg.Close()
+ kv := metrics.IntKeyValue(0)
+ calls := 0
+ cfg.AddParameterListener(
+  kv,
+  config.PARAMETER_ACCESS_ANY,
+  func(context config.IListenerContext, prev config.IParameterValue) error {
+   calls++
+   return nil
+  },
+ )
+ writers, writes := 8, 500
+ wg := sync.WaitGroup{}
+ for w := 0; w < writers; w++ {
+  wg.Add(1)
+  go func() {
+   defer wg.Done()
+   for i := 0; i < writes; i++ {
+    cfg.SetParameter(kv, metrics.IntKeyValue(i))
+    _, _ = cfg.GetParameter(kv)
+   }
+  }()
+ }
+ wg.Wait()
+ cfg.Drain()
+ if expected := writers * writes * 2; calls != expected {
+  t.Errorf("Expected %d listener invocations, received %d\n", expected, calls)
+ }
+}
+
+//Events must be delivered in the order the writes were stored: every write event continues where the previous event
+//left the parameter
+func TestAsyncConcurrentWriterOrdering(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ defer cfg.Close()
+ kv := metrics.IntKeyValue(0)
+ events := record(cfg, config.PARAMETER_ACCESS_ANY, kv)
+ writers, writes := 8, 500
+ runConcurrently(writers, func(w int) {
+  for i := 0; i < writes; i++ {
+   cfg.SetParameter(kv, metrics.IntKeyValue(w * writes + i))
+   _, _ = cfg.GetParameter(kv)
+  }
+ })
+ cfg.Drain()
+ var current config.IParameterValue
+ for i, event := range events.received() {
+  if event.Prev != current {
+   t.Fatalf("Event %d saw '%v' before the event, the previous event left '%v'\n", i, event.Prev, current)
+  }
+  current = event.Value
+ }
+ if value, _ := cfg.GetParameter(kv); value != current {
+  t.Errorf("Expected the last event to leave '%v', received: '%v'\n", value, current)
+ }
+}
+
+func TestAsyncListenerSetValueIsNotRedelivered(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ defer cfg.Close()
+ kv := metrics.IntKeyValue(0)
+ calls := 0
+ cfg.AddParameterListener(
+  kv,
+  config.PARAMETER_ACCESS_ANY,
+  func(context config.IListenerContext, prev config.IParameterValue) error {
+   calls++
+   context.SetValue(metrics.IntKeyValue(1))
+   if v, ok := context.Value(); !ok || v != metrics.IntKeyValue(1) {
+    t.Errorf("Listener context did not update the value!\n")
+   }
+   return nil
+  },
+ )
+ cfg.SetParameter(kv, kv)
+ cfg.Drain()
+ if calls != 1 {
+  t.Errorf("Listener was notified of its own changes, invocations: %d\n", calls)
+ }
+}
+
+func TestAsyncListenerContext(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ defer cfg.Close()
+ kv := metrics.IntKeyValue(0)
+ invoked := false
+ cfg.AddParameterListener(
+  kv,
+  config.PARAMETER_ACCESS_WRITE,
+  func(context config.IListenerContext, prev config.IParameterValue) error {
+   invoked = true
+   if context.Key() != kv {
+    t.Errorf("Listener context provided the incorrect key!\n")
+   }
+   if acc := context.AccessType(); acc != config.PARAMETER_ACCESS_WRITE {
+    t.Errorf(
+     "Listener context returned an incorrect access type: '0x%x', expected: '0x%x'\n",
+     acc,
+     config.PARAMETER_ACCESS_WRITE,
+    )
+   }
+   //the listener context returns a view of the bus that is bound to this listener invocation
+   context.Config().SetParameter(metrics.IntKeyValue(1), kv)
+   return nil
+  },
+ )
+ cfg.SetParameter(kv, kv)
+ cfg.Drain()
+ if !invoked {
+  t.Errorf("Listener was never invoked!\n")
+ }
+ if value, ok := cfg.GetParameter(metrics.IntKeyValue(1)); !ok || value != kv {
+  t.Errorf("Listener context returned a config that is not bound to the bus!\n")
+ }
+}
+
+func TestAsyncCloseDrainsPendingEvents(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ count := 100
+ calls := 0
+ for i := 0; i < count; i++ {
+  kv := metrics.IntKeyValue(i)
+  cfg.AddParameterListener(
+   kv,
+   config.PARAMETER_ACCESS_WRITE,
+   func(context config.IListenerContext, prev config.IParameterValue) error {
+    calls++
+    return nil
+   },
+  )
+  cfg.SetParameter(kv, kv)
+ }
+ cfg.Close()
+ if calls != count {
+  t.Errorf("Close did not drain all pending events, expected: %d, dispatched: %d\n", count, calls)
+ }
+ //reads are still served
+ if _, ok := cfg.GetParameter(metrics.IntKeyValue(0)); !ok {
+  t.Errorf("Closed bus did not serve a read!\n")
+ }
+}
+
+func TestAsyncWriteAfterClose(t *testing.T) {
+ defer metrics.CatchExpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ cfg.Close()
+ kv := metrics.IntKeyValue(0)
+ cfg.SetParameter(kv, kv)
+}
+
+func TestAsyncWritesRacingClose(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ for i := 0; i < 100; i++ {
+  _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+  kv := metrics.IntKeyValue(i)
+  cfg.AddParameterListener(
+   kv,
+   config.PARAMETER_ACCESS_WRITE,
+   func(context config.IListenerContext, prev config.IParameterValue) error {
+    return nil
+   },
+  )
+  runConcurrently(2, func(g int) {
+   if g == 0 {
+    cfg.Close()
+    return
+   }
+   //writes after Close panic, writes that raced it must not leave events pending
+   defer func() { recover() }()
+   for {
+    cfg.SetParameter(kv, kv)
+   }
+  })
+  drained := make(chan struct{})
+  go func() {
+   cfg.Drain()
+   close(drained)
+  }()
+  select {
+  case <-drained:
+  case <-time.After(watchTimeout):
+   t.Errorf("Drain blocked after a write raced Close!\n")
+   return
+  }
+ }
+}
+
+func TestAsyncDefaultCallbackErrorHandler(t *testing.T) {
+ defer metrics.CatchExpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ defer cfg.Close()
+ kv := metrics.IntKeyValue(0)
+ cfg.AddParameterListener(
+  kv,
+  config.PARAMETER_ACCESS_ANY,
+  func(context config.IListenerContext, value config.IParameterValue) error {
+   return fmt.Errorf("")
+  },
+ )
+ _, _ = cfg.GetParameter(kv)
+ //escaped panics are re-raised on the draining goroutine
+ cfg.Drain()
+}
+
+func TestAsyncCustomCallbackErrorHandler(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ defer cfg.Close()
+ kv := metrics.IntKeyValue(0)
+ cfg.AddParameterListener(
+  kv,
+  config.PARAMETER_ACCESS_ANY,
+  func(context config.IListenerContext, value config.IParameterValue) error {
+   return fmt.Errorf("")
+  },
+ )
+ handled := 0
+ cfg.SetCallbackErrorHandler(
+  func(active config.ParameterListener, access config.ParameterAccess, key config.IParameterKey, err error) {
+   handled++
+  },
+ )
+ _, _ = cfg.GetParameter(kv)
+ cfg.Drain()
+ if handled != 1 {
+  t.Errorf("Callback error handler was not invoked!\n")
+ }
+}
+
+func TestAsyncDefaultUnexpectedPanicHandler(t *testing.T) {
+ defer metrics.CatchExpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ kv := metrics.IntKeyValue(0)
+ cfg.AddParameterListener(
+  kv,
+  config.PARAMETER_ACCESS_ANY,
+  func(context config.IListenerContext, value config.IParameterValue) error {
+   panic(fmt.Errorf(""))
+  },
+ )
+ _, _ = cfg.GetParameter(kv)
+ cfg.Close()
+}
+
+func TestAsyncCustomUnexpectedPanicHandler(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ defer cfg.Close()
+ kv := metrics.IntKeyValue(0)
+ cfg.AddParameterListener(
+  kv,
+  config.PARAMETER_ACCESS_ANY,
+  func(context config.IListenerContext, value config.IParameterValue) error {
+   panic(fmt.Errorf(""))
+  },
+ )
+ panics := 0
+ cfg.SetUnexpectedPanicHandler(func(p interface{}) {
+  panics++
+ })
+ _, _ = cfg.GetParameter(kv)
+ cfg.Drain()
+ if panics != 1 {
+  t.Errorf("Panic handler was not invoked!\n")
+ }
+ //the event loop survives listener panics
+ _, _ = cfg.GetParameter(kv)
+ cfg.Drain()
+ if panics != 2 {
+  t.Errorf("Event loop stopped dispatching after a listener panic!\n")
+ }
+}
@@ -0,0 +1,161 @@
+package tests
+
+import (
+ "errors"
+ "fmt"
+ "testing"
+ "time"
+
+ "github.com/Matthewacon/go-figure/bind"
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+ "github.com/Matthewacon/go-figure/sources"
+)
+
+//Parameter value that wraps any raw value, like the values decoded from documents
+type rawValue struct {
+ raw interface{}
+}
+
+func (v rawValue) Value() interface{} { return v.raw }
+func (v rawValue) String() string     { return fmt.Sprint(v.raw) }
+
+type TLSConfig struct {
+ Cert string `figure:"cert"`
+}
+
+type sqlConfig struct {
+ MaxConnections int            `figure:"sql.max_connections,default=32"`
+ Timeout        time.Duration  `figure:"sql.timeout"`
+ Hosts          []string       `figure:"sql.hosts,default=alpha,beta"`
+ Weights        map[string]int `figure:"sql.weights"`
+ Ratio          *float64       `figure:"sql.ratio"`
+ *TLSConfig                    `figure:"sql.tls"`
+}
+
+type serviceConfig struct {
+ Sql     sqlConfig
+ Started time.Time `figure:"started"`
+ Value   config.IParameterValue `figure:"value"`
+ Ignored string
+}
+
+var bindNames = []string{
+ "sql.max_connections",
+ "sql.timeout",
+ "sql.hosts",
+ "sql.weights",
+ "sql.ratio",
+ "sql.tls.cert",
+ "started",
+ "value",
+}
+
+func TestBindStruct(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ registry := newIntRegistry(bindNames...)
+ cfg.SetParameters(config.Parameters{
+  metrics.IntKeyValue(1): rawValue{"1m30s"},
+  metrics.IntKeyValue(3): rawValue{map[string]interface{}{"a": int64(1), "b": "2"}},
+  metrics.IntKeyValue(4): rawValue{0.5},
+  metrics.IntKeyValue(5): rawValue{"cert.pem"},
+  metrics.IntKeyValue(6): rawValue{"1979-05-27T07:32:00Z"},
+  metrics.IntKeyValue(7): metrics.IntKeyValue(7),
+ })
+ target := serviceConfig{Ignored: "untouched"}
+ if _, err := bind.Bind(cfg, registry, &target); err != nil {
+  t.Errorf("Failed to bind struct: %s\n", err.Error())
+  return
+ }
+ sql := target.Sql
+ if sql.MaxConnections != 32 || sql.Timeout != 90 * time.Second || len(sql.Hosts) != 2 || sql.Hosts[1] != "beta" {
+  t.Errorf("Unexpected bound struct: %+v\n", sql)
+ }
+ if sql.Weights["a"] != 1 || sql.Weights["b"] != 2 || sql.Ratio == nil || *sql.Ratio != 0.5 {
+  t.Errorf("Unexpected bound struct: %+v\n", sql)
+ }
+ if sql.TLSConfig == nil || sql.Cert != "cert.pem" {
+  t.Errorf("Embedded struct pointer was not bound: %+v\n", sql.TLSConfig)
+ }
+ if !target.Started.Equal(time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC)) || target.Value != metrics.IntKeyValue(7) {
+  t.Errorf("Unexpected bound struct: %+v\n", target)
+ }
+ if target.Ignored != "untouched" {
+  t.Errorf("Untagged field was modified!\n")
+ }
+}
+
+func TestBindStructErrors(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ type invalid struct {
+  Count    int    `figure:"count"`
+  Missing  string `figure:"missing"`
+  Required string `figure:"required,required"`
+  //misspelled, the fields of time.Time must not be bound instead
+  Started  time.Time `figure:"startd"`
+ }
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ cfg.SetParameter(metrics.IntKeyValue(0), rawValue{"many"})
+ target := invalid{Count: 3}
+ binding, err := bind.Bind(cfg, newIntRegistry("count", "required", "started"), &target)
+ var errs sources.Errors
+ if binding == nil || !errors.As(err, &errs) || len(errs) != 4 {
+  t.Errorf("Expected 4 errors, received: %v\n", err)
+  return
+ }
+ var unknown *sources.UnknownParameterError
+ if !errors.As(errs[0], &unknown) || unknown.Path != "missing" {
+  t.Errorf("Expected an unknown parameter error for 'missing', received: %v\n", errs[0])
+ }
+ if !errors.As(errs[1], &unknown) || unknown.Path != "startd" {
+  t.Errorf("Expected an unknown parameter error for 'startd', received: %v\n", errs[1])
+ }
+ var fieldErr *bind.FieldError
+ if !errors.As(errs[2], &fieldErr) || fieldErr.Field != "Count" || fieldErr.Name != "count" {
+  t.Errorf("Expected a field error for 'Count', received: %v\n", errs[2])
+ }
+ if !errors.As(errs[3], &fieldErr) || fieldErr.Field != "Required" {
+  t.Errorf("Expected a field error for 'Required', received: %v\n", errs[3])
+ }
+ if target.Count != 3 {
+  t.Errorf("Field that failed to bind was modified: %d\n", target.Count)
+ }
+ if _, err := bind.Bind(cfg, newIntRegistry(), target); err == nil {
+  t.Errorf("Expected an error when binding a non-pointer!\n")
+ }
+}
+
+func TestWatchStruct(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ errs := collectListenerErrors(cfg)
+ target := sqlConfig{}
+ binding, err := bind.Watch(cfg, newIntRegistry(bindNames...), &struct {
+  Sql *sqlConfig
+ }{&target})
+ if err != nil {
+  t.Errorf("Failed to bind struct: %s\n", err.Error())
+  return
+ }
+ cfg.SetParameter(metrics.IntKeyValue(0), metrics.IntKeyValue(64))
+ binding.RLock()
+ if target.MaxConnections != 64 {
+  t.Errorf("Field was not rebound after a write: %d\n", target.MaxConnections)
+ }
+ binding.RUnlock()
+ //removing the parameter restores the default
+ cfg.RemoveParameter(metrics.IntKeyValue(0))
+ if target.MaxConnections != 32 {
+  t.Errorf("Field was not reset to its default: %d\n", target.MaxConnections)
+ }
+ cfg.SetParameter(metrics.IntKeyValue(1), rawValue{"soon"})
+ if len(*errs) != 1 {
+  t.Errorf("Expected a rebinding error to be reported, received: %v\n", *errs)
+ }
+ binding.Close()
+ cfg.SetParameter(metrics.IntKeyValue(0), metrics.IntKeyValue(16))
+ if target.MaxConnections != 32 {
+  t.Errorf("Closed binding was updated!\n")
+ }
+}
@@ -0,0 +1,194 @@
+package tests
+
+import (
+ "fmt"
+ "sync"
+ "sync/atomic"
+ "testing"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+)
+
+//Run with `go test -race` to verify the synchronization of the config bus
+const (
+ stressGoroutines = 16
+ stressIterations = 2000
+ stressKeys = 32
+)
+
+var errSilenced = fmt.Errorf("silenced")
+
+func runConcurrently(goroutines int, f func(goroutine int)) {
+ wg := sync.WaitGroup{}
+ wg.Add(goroutines)
+ for g := 0; g < goroutines; g++ {
+  go func(goroutine int) {
+   defer wg.Done()
+   f(goroutine)
+  }(g)
+ }
+ wg.Wait()
+}
+
+func TestConcurrentReadersAndWriters(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ runConcurrently(stressGoroutines, func(g int) {
+  for i := 0; i < stressIterations; i++ {
+   kv := metrics.IntKeyValue((g * stressIterations + i) % stressKeys)
+   switch i % 4 {
+   case 0:
+    cfg.SetParameter(kv, kv)
+   case 1:
+    if value, ok := cfg.GetParameter(kv); ok && value != kv {
+     t.Errorf("Read torn value '%v' for key '%d'\n", value, kv)
+    }
+   case 2:
+    _, _ = cfg.RemoveParameter(kv)
+   case 3:
+    cfg.SetParameters(config.Parameters{kv: kv})
+    _ = cfg.GetParameterOr(kv, kv)
+    _ = cfg.GetParameters()
+   }
+  }
+ })
+}
+
+func TestConcurrentDisjointWriters(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ runConcurrently(stressGoroutines, func(g int) {
+  for i := 0; i < stressIterations; i++ {
+   kv := metrics.IntKeyValue(g * stressIterations + i)
+   cfg.SetParameter(kv, kv)
+  }
+ })
+ if num, expected := len(cfg.GetParameters()), stressGoroutines * stressIterations; num != expected {
+  t.Errorf("Lost concurrent writes, expected: %d parameters, found: %d\n", expected, num)
+ }
+}
+
+func TestConcurrentListenerDispatch(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ var reads, writes int64
+ for k := 0; k < stressKeys; k++ {
+  kv := metrics.IntKeyValue(k)
+  cfg.AddParameterListener(
+   kv,
+   config.PARAMETER_ACCESS_ANY,
+   func(context config.IListenerContext, prev config.IParameterValue) error {
+    switch context.AccessType() {
+    case config.PARAMETER_ACCESS_READ:
+     atomic.AddInt64(&reads, 1)
+    case config.PARAMETER_ACCESS_WRITE:
+     atomic.AddInt64(&writes, 1)
+    }
+    if context.Key() != kv {
+     t.Errorf("Listener for key '%d' received a context for key '%v'\n", kv, context.Key())
+    }
+    return nil
+   },
+  )
+ }
+ runConcurrently(stressGoroutines, func(g int) {
+  for i := 0; i < stressIterations; i++ {
+   kv := metrics.IntKeyValue(i % stressKeys)
+   cfg.SetParameter(kv, kv)
+   _, _ = cfg.GetParameter(kv)
+  }
+ })
+ expected := int64(stressGoroutines * stressIterations)
+ if reads != expected || writes != expected {
+  t.Errorf(
+   "Listeners missed events, expected %d reads and writes, received %d reads and %d writes\n",
+   expected,
+   reads,
+   writes,
+  )
+ }
+}
+
+func TestConcurrentListenerRegistration(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ kv := metrics.IntKeyValue(0)
+ cfg.SetParameter(kv, kv)
+ runConcurrently(stressGoroutines, func(g int) {
+  for i := 0; i < stressIterations / 10; i++ {
+   if g % 2 == 0 {
+    handle := cfg.AddParameterListener(
+     kv,
+     config.PARAMETER_ACCESS_ANY,
+     func(context config.IListenerContext, prev config.IParameterValue) error {
+      //listeners may inspect the listeners of the key being dispatched
+      _ = context.Config().GetParameterListeners(context.Key())
+      return nil
+     },
+    )
+    handle.Update(config.PARAMETER_ACCESS_READ)
+    handle.Unsubscribe()
+   } else {
+    _, _ = cfg.GetParameter(kv)
+    cfg.SetParameter(kv, kv)
+   }
+  }
+ })
+}
+
+func TestConcurrentListenerContexts(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ mirrorOffset := stressKeys
+ //every write to a source key is mirrored by its listener into another key
+ for k := 0; k < stressKeys; k++ {
+  cfg.AddParameterListener(
+   metrics.IntKeyValue(k),
+   config.PARAMETER_ACCESS_WRITE,
+   func(context config.IListenerContext, prev config.IParameterValue) error {
+    value, _ := context.Value()
+    context.Config().SetParameter(metrics.IntKeyValue(int(context.Key().(metrics.IntKeyValue)) + mirrorOffset), value)
+    context.SetValue(value)
+    return nil
+   },
+  )
+ }
+ runConcurrently(stressGoroutines, func(g int) {
+  for i := 0; i < stressIterations; i++ {
+   kv := metrics.IntKeyValue(i % stressKeys)
+   cfg.SetParameter(kv, kv)
+  }
+ })
+ for k := 0; k < stressKeys; k++ {
+  mirror := metrics.IntKeyValue(k + mirrorOffset)
+  if value, ok := cfg.GetParameter(mirror); !ok || value != metrics.IntKeyValue(k) {
+   t.Errorf("Mirrored key '%d' has value '%v', expected: '%d'\n", mirror, value, k)
+  }
+ }
+}
+
+func TestConcurrentHandlerReplacement(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ kv := metrics.IntKeyValue(0)
+ cfg.AddParameterListener(
+  kv,
+  config.PARAMETER_ACCESS_ANY,
+  func(context config.IListenerContext, prev config.IParameterValue) error {
+   return errSilenced
+  },
+ )
+ silence := func(active config.ParameterListener, access config.ParameterAccess, key config.IParameterKey, err error) {}
+ cfg.SetCallbackErrorHandler(silence)
+ runConcurrently(stressGoroutines, func(g int) {
+  for i := 0; i < stressIterations; i++ {
+   if g == 0 {
+    cfg.SetCallbackErrorHandler(silence)
+    cfg.SetUnexpectedPanicHandler(func(p interface{}) { panic(p) })
+   } else {
+    cfg.SetParameter(kv, kv)
+   }
+  }
+ })
+}
@@ -78,9 +78,141 @@ func TestRemoveAccessCallback(t *testing.T) {
  defer metrics.CatchUnexpectedPanic(t)
  cfg := metrics.DefaultEnvAndConfig().GetConfig()
  kv := metrics.IntKeyValue(0)
- addAccessCallback(t, cfg, kv)
- listener := cfg.GetParameterListeners(kv)[0]
- cfg.RemoveParameterListener(kv, listener.ParameterAccess, *listener.ParameterListener)
+ calls := 0
+ listener := func(context config.IListenerContext, value config.IParameterValue) error {
+  calls++
+  return nil
+ }
+ //a separately created closure never matches
+ other := func(context config.IListenerContext, value config.IParameterValue) error {
+  calls++
+  return nil
+ }
+ cfg.AddParameterListener(kv, config.PARAMETER_ACCESS_ANY, listener)
+ cfg.AddParameterListener(kv, config.PARAMETER_ACCESS_READ, other)
+ cfg.RemoveParameterListener(kv, config.PARAMETER_ACCESS_WRITE, listener)
+ cfg.SetParameter(kv, kv)
+ if calls != 0 {
+  t.Errorf("Listener was invoked after its WRITE access was removed\n")
+ }
+ cfg.RemoveParameterListener(kv, config.PARAMETER_ACCESS_READ, listener)
+ _, _ = cfg.GetParameter(kv)
+ if calls != 1 {
+  t.Errorf("Expected only the other listener to be invoked, invocations: %d\n", calls)
+ }
+ if n := len(cfg.GetParameterListeners(kv)); n != 1 {
+  t.Errorf("Expected 1 remaining listener, found: %d\n", n)
+ }
+}
+
+func TestListenerHandleUnsubscribe(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ kv := metrics.IntKeyValue(0)
+ calls := 0
+ handle := cfg.AddParameterListener(
+  kv,
+  config.PARAMETER_ACCESS_ANY,
+  func(context config.IListenerContext, value config.IParameterValue) error {
+   calls++
+   return nil
+  },
+ )
+ if handle.Key() != kv || handle.Access() != config.PARAMETER_ACCESS_ANY {
+  t.Errorf("Listener handle reported key: '%v', access: 0x%x\n", handle.Key(), handle.Access())
+ }
+ _, _ = cfg.GetParameter(kv)
+ handle.Unsubscribe()
+ _, _ = cfg.GetParameter(kv)
+ cfg.SetParameter(kv, kv)
+ if calls != 1 {
+  t.Errorf("Listener was invoked after unsubscribing, invocations: %d\n", calls)
+ }
+ if n := len(cfg.GetParameterListeners(kv)); n != 0 {
+  t.Errorf("Expected no remaining listeners, found: %d\n", n)
+ }
+ if access := handle.Access(); access != 0 {
+  t.Errorf("Unsubscribed listener handle reported access: 0x%x\n", access)
+ }
+ //updating an unsubscribed handle has no effect
+ handle.Update(config.PARAMETER_ACCESS_ANY)
+ if n := len(cfg.GetParameterListeners(kv)); n != 0 {
+  t.Errorf("Updating an unsubscribed handle re-registered the listener\n")
+ }
+}
+
+func TestListenerHandleUpdate(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ kv := metrics.IntKeyValue(0)
+ calls := map[config.ParameterAccess]int{}
+ handle := cfg.AddParameterListener(
+  kv,
+  config.PARAMETER_ACCESS_READ,
+  func(context config.IListenerContext, value config.IParameterValue) error {
+   calls[context.AccessType()]++
+   return nil
+  },
+ )
+ handle.Update(config.PARAMETER_ACCESS_WRITE)
+ if access := handle.Access(); access != config.PARAMETER_ACCESS_WRITE {
+  t.Errorf("Listener handle reported access: 0x%x, expected: 0x%x\n", access, config.PARAMETER_ACCESS_WRITE)
+ }
+ _, _ = cfg.GetParameter(kv)
+ cfg.SetParameter(kv, kv)
+ if calls[config.PARAMETER_ACCESS_READ] != 0 || calls[config.PARAMETER_ACCESS_WRITE] != 1 {
+  t.Errorf("Listener access was not updated, invocations: %v\n", calls)
+ }
+ handle.Update(0)
+ if n := len(cfg.GetParameterListeners(kv)); n != 0 {
+  t.Errorf("Updating a listener handle to access 0 did not unsubscribe it\n")
+ }
+}
+
+func TestListenerHandleDuplicateRegistration(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ kv := metrics.IntKeyValue(0)
+ calls := 0
+ listener := func(context config.IListenerContext, value config.IParameterValue) error {
+  calls++
+  return nil
+ }
+ first := cfg.AddParameterListener(kv, config.PARAMETER_ACCESS_WRITE, listener)
+ second := cfg.AddParameterListener(kv, config.PARAMETER_ACCESS_WRITE, listener)
+ cfg.SetParameter(kv, kv)
+ first.Unsubscribe()
+ cfg.SetParameter(kv, kv)
+ if calls != 3 {
+  t.Errorf("Expected 3 invocations from 2 registrations, received: %d\n", calls)
+ }
+ if second.Access() != config.PARAMETER_ACCESS_WRITE {
+  t.Errorf("Unsubscribing a registration affected another registration of the same listener\n")
+ }
+}
+
+func TestAsyncListenerHandle(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ defer cfg.Close()
+ kv := metrics.IntKeyValue(0)
+ calls := 0
+ handle := cfg.AddParameterListener(
+  kv,
+  config.PARAMETER_ACCESS_WRITE,
+  func(context config.IListenerContext, value config.IParameterValue) error {
+   calls++
+   return nil
+  },
+ )
+ cfg.SetParameter(kv, kv)
+ cfg.Drain()
+ handle.Unsubscribe()
+ cfg.SetParameter(kv, kv)
+ cfg.Drain()
+ if calls != 1 {
+  t.Errorf("Listener was invoked after unsubscribing, invocations: %d\n", calls)
+ }
 }
 
 func addCheckedListener(t *testing.T, cfg config.IConfigBus, key config.IParameterKey, value config.IParameterValue, access config.ParameterAccess) {
@@ -263,42 +395,56 @@ func TestCustomUnexpectedPanicHandler(t *testing.T) {
  _, _ = cfg.GetParameter(kv)
 }
 
-//TODO
-//func TestEventLoopCheck(t *testing.T) {
-// defer metrics.CatchExpectedPanic(t)
-// cfg := metrics.DefaultEnvAndConfig().GetConfig()
-// kv := metrics.IntKeyValue(0)
-// for i := 0; i < 2; i++ {
-//  cfg.AddParameterListener(
-//   kv,
-//   config.PARAMETER_ACCESS_READ,
-//   func(value config.IParameterValue, access config.ParameterAccess) error {
-//    _ = i
-//    cfg.GetParameter(kv)
-//    return nil
-//   },
-//  )
-// }
-// _ = cfg.GetParameter(kv)
-//}
+func TestEventLoopCheck(t *testing.T) {
+ defer metrics.CatchExpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ kv := metrics.IntKeyValue(0)
+ for i := 0; i < 2; i++ {
+  cfg.AddParameterListener(
+   kv,
+   config.PARAMETER_ACCESS_READ,
+   func(context config.IListenerContext, value config.IParameterValue) error {
+    _ = i
+    context.Value()
+    return nil
+   },
+  )
+ }
+ _, _ = cfg.GetParameter(kv)
+}
 
+//Listeners may be registered while the listeners of the key are being dispatched; the event in flight is delivered to
+//the listeners that were registered when it was raised
 func TestConcurrentModificationCheck(t *testing.T) {
- defer metrics.CatchExpectedPanic(t)
+ defer metrics.CatchUnexpectedPanic(t)
  cfg := metrics.DefaultEnvAndConfig().GetConfig()
  kv := metrics.IntKeyValue(0)
- cfg.AddParameterListener(
+ added := 0
+ var handle config.IListenerHandle
+ handle = cfg.AddParameterListener(
   kv,
   config.PARAMETER_ACCESS_READ,
   func(context config.IListenerContext, value config.IParameterValue) error {
    cfg.AddParameterListener(
     kv,
     config.PARAMETER_ACCESS_READ,
-    nil,
+    func(config.IListenerContext, config.IParameterValue) error {
+     added++
+     return nil
+    },
    )
+   handle.Unsubscribe()
    return nil
   },
  )
  _, _ = cfg.GetParameter(kv)
+ if added != 0 {
+  t.Errorf("Listener registered during dispatch received the event in flight\n")
+ }
+ _, _ = cfg.GetParameter(kv)
+ if added != 1 {
+  t.Errorf("Expected the listener registered during dispatch to receive the next event, invocations: %d\n", added)
+ }
 }
 
 func TestIListenerKey(t *testing.T) {
@@ -388,22 +534,37 @@ func TestIListenerConfig(t *testing.T) {
  defer metrics.CatchUnexpectedPanic(t)
  cfg := metrics.DefaultEnvAndConfig().GetConfig()
  kv := metrics.IntKeyValue(0)
+ value := metrics.IntKeyValue(1)
+ writes := 0
  cfg.AddParameterListener(
   kv,
-  config.PARAMETER_ACCESS_READ,
+  config.PARAMETER_ACCESS_ANY,
   func(context config.IListenerContext, prev config.IParameterValue) error {
-   contextCfg := context.Config()
-   if contextCfg != cfg {
-    panic(fmt.Errorf(
-     "Listener context returned an incorrect config: '0x%x', expected: '0x%x'\n",
-     cfg,
-     contextCfg,
-    ))
+   if context.AccessType() != config.PARAMETER_ACCESS_READ {
+    writes++
+    return nil
    }
+   //the listener context returns a view of the bus that is bound to this listener invocation
+   context.Config().SetParameter(kv, value)
    return nil
   },
  )
+ others := 0
+ cfg.AddParameterListener(kv, config.PARAMETER_ACCESS_WRITE, func(config.IListenerContext, config.IParameterValue) error {
+  others++
+  return nil
+ })
  _, _ = cfg.GetParameter(kv)
+ if writes != 0 || others != 1 {
+  t.Errorf("Expected the write to be delivered to the other listener only, received: %d and %d\n", writes, others)
+ }
+ explanation := cfg.Explain(kv)
+ if !explanation.Defined || explanation.Value != value {
+  t.Errorf("Listener context returned a config that is not bound to the bus, received: %s\n", explanation.String())
+ }
+ if explanation.Change == nil || explanation.Change.Listener == nil {
+  t.Errorf("Expected the write to be attributed to the listener, received: %s\n", explanation.String())
+ }
 }
 
 func TestIListenerConfigAccessType(t *testing.T) {
@@ -0,0 +1,116 @@
+package tests
+
+import (
+ "errors"
+ "testing"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+ "github.com/Matthewacon/go-figure/sources"
+)
+
+func newIntRegistry(names ...string) *sources.Registry {
+ registry := sources.NewRegistry()
+ for i, name := range names {
+  registry.Register(name, metrics.IntKeyValue(i), sources.TextDecoder(metrics.DecodeIntKeyValue))
+ }
+ return registry
+}
+
+func environ(variables ...string) func() []string {
+ return func() []string { return variables }
+}
+
+func TestEnvironmentSourceVariableName(t *testing.T) {
+ src := sources.NewEnvironmentSource("MYAPP", sources.NewRegistry())
+ for name, expected := range map[string]string{
+  "sql.max_connections": "MYAPP_SQL_MAX_CONNECTIONS",
+  "sql.idle-time": "MYAPP_SQL_IDLE_TIME",
+  "timeout": "MYAPP_TIMEOUT",
+ } {
+  if variable := src.VariableName(name); variable != expected {
+   t.Errorf("Parameter '%s' mapped to variable '%s', expected: '%s'\n", name, variable, expected)
+  }
+ }
+ src.Prefix = ""
+ if variable := src.VariableName("sql.max_connections"); variable != "SQL_MAX_CONNECTIONS" {
+  t.Errorf("Unprefixed parameter mapped to variable '%s'\n", variable)
+ }
+}
+
+func TestEnvironmentSourceLoad(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ registry := newIntRegistry("sql.max_connections", "sql.timeout", "sql.idle_time")
+ src := sources.NewEnvironmentSource("MYAPP", registry)
+ src.Environ = environ(
+  "MYAPP_SQL_MAX_CONNECTIONS=32",
+  "MYAPP_SQL_TIMEOUT=5",
+  "OTHERAPP_SQL_IDLE_TIME=1",
+  "MYAPP_UNREGISTERED=1",
+ )
+ params, err := src.Load()
+ if err != nil {
+  t.Errorf("Failed to load environment: %s\n", err.Error())
+  return
+ }
+ expected := config.Parameters{
+  metrics.IntKeyValue(0): metrics.IntKeyValue(32),
+  metrics.IntKeyValue(1): metrics.IntKeyValue(5),
+ }
+ if len(params) != len(expected) {
+  t.Errorf("Expected %d parameters, loaded: %v\n", len(expected), params)
+ }
+ for key, value := range expected {
+  if params[key] != value {
+   t.Errorf("Parameter [%v] loaded as '%v', expected: '%v'\n", key, params[key], value)
+  }
+ }
+}
+
+func TestEnvironmentSourceDecodeError(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ src := sources.NewEnvironmentSource("MYAPP", newIntRegistry("sql.max_connections"))
+ src.Environ = environ("MYAPP_SQL_MAX_CONNECTIONS=many")
+ _, err := src.Load()
+ var decodeErr *sources.DecodeError
+ if !errors.As(err, &decodeErr) {
+  t.Errorf("Expected a *sources.DecodeError, received: %v\n", err)
+  return
+ }
+ if decodeErr.Name != "MYAPP_SQL_MAX_CONNECTIONS" || decodeErr.Raw != "many" {
+  t.Errorf("Decode error reported variable '%s' with value '%v'\n", decodeErr.Name, decodeErr.Raw)
+ }
+}
+
+func TestEnvironmentSourceApplyFiresWriteListeners(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ src := sources.NewEnvironmentSource("MYAPP", newIntRegistry("sql.max_connections"))
+ src.Environ = environ("MYAPP_SQL_MAX_CONNECTIONS=32")
+ key := metrics.IntKeyValue(0)
+ writes := 0
+ cfg.AddParameterListener(
+  key,
+  config.PARAMETER_ACCESS_WRITE,
+  func(context config.IListenerContext, prev config.IParameterValue) error {
+   writes++
+   return nil
+  },
+ )
+ if err := sources.Apply(cfg, src); err != nil {
+  t.Errorf("Failed to apply environment: %s\n", err.Error())
+  return
+ }
+ if writes != 1 {
+  t.Errorf("Expected 1 write event, received: %d\n", writes)
+ }
+ if value, ok := cfg.GetParameter(key); !ok || value != metrics.IntKeyValue(32) {
+  t.Errorf("Environment was not applied to the bus, value: '%v'\n", value)
+ }
+}
+
+func TestRegistryRejectsDuplicates(t *testing.T) {
+ defer metrics.CatchExpectedPanic(t)
+ registry := newIntRegistry("sql.max_connections")
+ registry.Register("sql.max_connections", metrics.IntKeyValue(1), sources.TextDecoder(metrics.DecodeIntKeyValue))
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+ "errors"
+ "fmt"
+ "testing"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/history"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+ "github.com/Matthewacon/go-figure/sources"
+ "github.com/Matthewacon/go-figure/values"
+)
+
+//A value of an incomparable type without an Equal method
+type sliceValue []int
+
+func (v sliceValue) Value() interface{} { return []int(v) }
+func (v sliceValue) String() string     { return fmt.Sprint([]int(v)) }
+
+func TestValuesEqual(t *testing.T) {
+ for _, test := range []struct {
+  a, b  config.IParameterValue
+  equal bool
+ }{
+  {nil, nil, true},
+  {metrics.IntKeyValue(1), nil, false},
+  {metrics.IntKeyValue(1), metrics.IntKeyValue(1), true},
+  {metrics.IntKeyValue(1), metrics.IntKeyValue(2), false},
+  {metrics.IntKeyValue(1), values.Int(1), false},
+  {values.StringList{"a", "b"}, values.StringList{"a", "b"}, true},
+  {values.StringList{"a", "b"}, values.StringList{"b", "a"}, false},
+  {values.StringMap{"a": "b"}, values.StringMap{"a": "b"}, true},
+  {sliceValue{1, 2}, sliceValue{1, 2}, true},
+  {sliceValue{1, 2}, sliceValue{1}, false},
+ } {
+  if equal := config.ValuesEqual(test.a, test.b); equal != test.equal {
+   t.Errorf("Expected ValuesEqual(%v, %v) to be %v\n", test.a, test.b, test.equal)
+  }
+ }
+}
+
+func TestSuppressUnchanged(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, async := metrics.DefaultEnvAndAsynchronousConfig()
+ for _, cfg := range []config.IConfigBus{metrics.DefaultEnvAndConfig().GetConfig(), async} {
+  h := history.NewHistory(0)
+  cfg.SetHistory(h)
+  key, list := metrics.IntKeyValue(0), metrics.IntKeyValue(1)
+  drain := func() {
+   if async, ok := cfg.(config.IAsynchronousConfigBus); ok {
+    async.Drain()
+   }
+  }
+  cfg.SetParameters(config.Parameters{key: metrics.IntKeyValue(1), list: values.StringList{"a"}})
+  drain()
+  events := record(cfg, config.PARAMETER_ACCESS_WRITE, key)
+  listEvents := record(cfg, config.PARAMETER_ACCESS_WRITE, list)
+  //writes are not suppressed by default
+  cfg.SetParameter(key, metrics.IntKeyValue(1))
+  if prev := cfg.SetSuppressUnchanged(true); prev {
+   t.Errorf("Expected writes not to be suppressed by default\n")
+  }
+  cfg.SetParameter(key, metrics.IntKeyValue(1))
+  cfg.SetParameter(list, values.StringList{"a"})
+  cfg.SetParameter(key, metrics.IntKeyValue(2))
+  drain()
+  if received := events.received(); len(received) != 2 || received[1].Value != metrics.IntKeyValue(2) {
+   t.Errorf("Expected WRITE events for the unsuppressed writes only, received: %v\n", received)
+  }
+  if received := listEvents.received(); len(received) != 0 {
+   t.Errorf("Expected an equal list to be suppressed, received: %v\n", received)
+  }
+  if h.Len() != 4 {
+   t.Errorf("Expected suppressed writes to be left out of the history, received: %v\n", h.Entries())
+  }
+ }
+}
+
+func TestSuppressedWriteIsNotRolledBack(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ cfg.SetSuppressUnchanged(true)
+ a, b := metrics.IntKeyValue(0), metrics.IntKeyValue(1)
+ cfg.SetParameters(config.Parameters{a: metrics.IntKeyValue(1), b: metrics.IntKeyValue(1)})
+ cfg.SetKeyListenerErrorPolicy(b, config.LISTENER_ERROR_ROLLBACK)
+ aEvents := record(cfg, config.PARAMETER_ACCESS_WRITE, a)
+ addFailingListener(cfg, b)
+ var rollback *config.RollbackError
+ err := cfg.TrySetParameters(config.Parameters{a: metrics.IntKeyValue(1), b: metrics.IntKeyValue(2)})
+ if !errors.As(err, &rollback) || len(rollback.Reverted) != 1 || rollback.Reverted[0].Key != b {
+  t.Errorf("Expected only the stored write to be reverted, received: %v\n", err)
+ }
+ if received := aEvents.received(); len(received) != 0 {
+  t.Errorf("Expected no events for the suppressed write, received: %v\n", received)
+ }
+}
+
+func TestChangedComparesValues(t *testing.T) {
+ current := config.Parameters{metrics.IntKeyValue(0): values.StringList{"a"}, metrics.IntKeyValue(1): sliceValue{1}}
+ loaded := config.Parameters{metrics.IntKeyValue(0): values.StringList{"a"}, metrics.IntKeyValue(1): sliceValue{2}}
+ if changed := sources.Changed(current, loaded); len(changed) != 1 {
+  t.Errorf("Expected only the different value to have changed, received: %v\n", changed)
+ }
+}
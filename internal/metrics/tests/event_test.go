@@ -0,0 +1,182 @@
+package tests
+
+import (
+ "testing"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+)
+
+func TestListenerEvents(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, async := metrics.DefaultEnvAndAsynchronousConfig()
+ for _, cfg := range []config.IConfigBus{metrics.DefaultEnvAndConfig().GetConfig(), async} {
+  key := metrics.IntKeyValue(0)
+  events := record(cfg, config.PARAMETER_ACCESS_ANY, key)
+  cfg.SetParameter(key, metrics.IntKeyValue(1))
+  cfg.SetParameter(key, metrics.IntKeyValue(2))
+  cfg.GetParameter(key)
+  cfg.RemoveParameter(key)
+  if async, ok := cfg.(config.IAsynchronousConfigBus); ok {
+   async.Drain()
+  }
+  event := func(access config.ParameterAccess, kind config.ChangeKind, prev, value config.IParameterValue) config.ParameterEvent {
+   return config.ParameterEvent{
+    ParameterChange: config.ParameterChange{Key: key, Prev: prev, Value: value, Kind: kind},
+    Access: access,
+   }
+  }
+  expected := []config.ParameterEvent{
+   event(config.PARAMETER_ACCESS_CREATE, config.CHANGE_CREATE, nil, metrics.IntKeyValue(1)),
+   event(config.PARAMETER_ACCESS_UPDATE, config.CHANGE_UPDATE, metrics.IntKeyValue(1), metrics.IntKeyValue(2)),
+   event(config.PARAMETER_ACCESS_READ, config.CHANGE_NONE, metrics.IntKeyValue(2), metrics.IntKeyValue(2)),
+   event(config.PARAMETER_ACCESS_DELETE, config.CHANGE_REMOVE, metrics.IntKeyValue(2), nil),
+  }
+  notifications := events.received()
+  if len(notifications) != len(expected) {
+   t.Fatalf("Expected %d events, received: %v\n", len(expected), notifications)
+  }
+  for i, received := range notifications {
+   if i > 0 && (received.Sequence <= notifications[i - 1].Sequence || received.Time.Before(notifications[i - 1].Time)) {
+    t.Errorf("Expected increasing sequence numbers and times, received: %v\n", notifications)
+   }
+   if received.Key != expected[i].Key ||
+    received.Prev != expected[i].Prev ||
+    received.Value != expected[i].Value ||
+    received.Kind != expected[i].Kind ||
+    received.Access != expected[i].Access {
+    t.Errorf("Expected event %v, received: %v\n", expected[i], received)
+   }
+  }
+ }
+}
+
+func TestGetParameterOrEvents(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, async := metrics.DefaultEnvAndAsynchronousConfig()
+ defer async.Close()
+ for _, cfg := range []config.IConfigBus{metrics.DefaultEnvAndConfig().GetConfig(), async} {
+  key := metrics.IntKeyValue(0)
+  cfg.SetParameter(key, metrics.IntKeyValue(1))
+  events := record(cfg, config.PARAMETER_ACCESS_READ, key)
+  if value := cfg.GetParameterOr(key, metrics.IntKeyValue(2)); value != metrics.IntKeyValue(1) {
+   t.Errorf("Expected the stored value, received: %v\n", value)
+  }
+  drain(cfg)
+  //both buses report the default that was passed
+  if received := events.received(); len(received) != 1 || received[0].Prev != metrics.IntKeyValue(2) {
+   t.Errorf("Expected a READ event reporting the default, received: %v\n", received)
+  }
+ }
+}
+
+func TestAsyncEventSequenceOrder(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ defer cfg.Close()
+ key := metrics.IntKeyValue(0)
+ //reads raise no events while nobody is listening, so they take no sequence numbers
+ cfg.SetParameter(key, metrics.IntKeyValue(1))
+ for i := 0; i < 100; i++ {
+  cfg.GetParameter(key)
+ }
+ events := record(cfg, config.PARAMETER_ACCESS_ANY, key)
+ cfg.SetParameter(key, metrics.IntKeyValue(2))
+ cfg.Drain()
+ if received := events.received(); len(received) != 1 || received[0].Sequence != 2 {
+  t.Fatalf("Expected a single event with sequence number 2, received %d events\n", len(received))
+ }
+ runConcurrently(8, func(w int) {
+  for i := 0; i < 500; i++ {
+   if i % 50 == w {
+    cfg.SetParameter(key, metrics.IntKeyValue(i))
+   } else {
+    cfg.GetParameter(key)
+   }
+  }
+ })
+ cfg.Drain()
+ received := events.received()
+ for i := 1; i < len(received); i++ {
+  if received[i].Sequence <= received[i - 1].Sequence {
+   t.Fatalf("Sequence number %d was delivered after %d\n", received[i].Sequence, received[i - 1].Sequence)
+  }
+ }
+}
+
+func TestListenerEventsRaiseNoReads(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ key := metrics.IntKeyValue(0)
+ reads := record(cfg, config.PARAMETER_ACCESS_ANY, key)
+ var value config.IParameterValue
+ cfg.AddParameterListener(key, config.PARAMETER_ACCESS_WRITE, func(context config.IListenerContext, _ config.IParameterValue) error {
+  value = context.Event().Value
+  return nil
+ })
+ cfg.SetParameter(key, metrics.IntKeyValue(1))
+ if value != metrics.IntKeyValue(1) || reads.count(nil, config.PARAMETER_ACCESS_READ) != 0 {
+  t.Errorf("Expected the new value without READ events, received: %v and %d reads\n", value, reads.count(nil, config.PARAMETER_ACCESS_READ))
+ }
+}
+
+func TestTransactionMergesEvents(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ a, b := metrics.IntKeyValue(0), metrics.IntKeyValue(1)
+ //a key that is created and removed by the same write has not changed
+ cfg.SetParameter(b, metrics.IntKeyValue(1))
+ aEvents := record(cfg, config.PARAMETER_ACCESS_WRITE, a)
+ bEvents := record(cfg, config.PARAMETER_ACCESS_WRITE, b)
+ tx := cfg.Begin()
+ tx.SetParameter(a, metrics.IntKeyValue(1))
+ tx.RemoveParameter(a)
+ tx.RemoveParameter(b)
+ if err := tx.Commit(); err != nil {
+  t.Fatalf("Failed to commit: %s\n", err.Error())
+ }
+ if received := aEvents.received(); len(received) != 0 {
+  t.Errorf("Expected no events for a key created and removed in place, received: %v\n", received)
+ }
+ if received := bEvents.received(); len(received) != 1 || received[0].Kind != config.CHANGE_REMOVE {
+  t.Errorf("Expected a single remove event, received: %v\n", received)
+ }
+}
+
+func TestLifecycleAccessTypes(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, async := metrics.DefaultEnvAndAsynchronousConfig()
+ for _, cfg := range []config.IConfigBus{metrics.DefaultEnvAndConfig().GetConfig(), async} {
+  key := metrics.IntKeyValue(0)
+  creates := record(cfg, config.PARAMETER_ACCESS_CREATE, key)
+  deletes := record(cfg, config.PARAMETER_ACCESS_DELETE, key)
+  writes := []config.ParameterAccess{}
+  cfg.AddParameterListener(key, config.PARAMETER_ACCESS_WRITE, func(context config.IListenerContext, _ config.IParameterValue) error {
+   writes = append(writes, context.AccessType())
+   return nil
+  })
+  cfg.SetParameter(key, metrics.IntKeyValue(1))
+  cfg.SetParameter(key, metrics.IntKeyValue(2))
+  cfg.RemoveParameter(key)
+  //removing an undefined parameter changes nothing
+  cfg.RemoveParameter(key)
+  cfg.SetParameter(key, metrics.IntKeyValue(3))
+  if async, ok := cfg.(config.IAsynchronousConfigBus); ok {
+   async.Drain()
+  }
+  if received := creates.received(); len(received) != 2 || received[1].Value != metrics.IntKeyValue(3) {
+   t.Errorf("Expected 2 CREATE events, received: %v\n", received)
+  }
+  if received := deletes.received(); len(received) != 1 || received[0].Prev != metrics.IntKeyValue(2) {
+   t.Errorf("Expected 1 DELETE event, received: %v\n", received)
+  }
+  if len(writes) != 4 {
+   t.Errorf("Expected WRITE listeners to receive every change, received: %v\n", writes)
+  }
+  for _, access := range writes {
+   if access != config.PARAMETER_ACCESS_WRITE {
+    t.Errorf("Expected the access type of changes to be reported as WRITE, received: 0x%x\n", access)
+   }
+  }
+ }
+}
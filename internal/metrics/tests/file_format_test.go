@@ -0,0 +1,227 @@
+package tests
+
+import (
+ "io/ioutil"
+ "math"
+ "os"
+ "path/filepath"
+ "reflect"
+ "strings"
+ "testing"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+ "github.com/Matthewacon/go-figure/sources"
+)
+
+func decodeFormat(t *testing.T, format sources.IFormat, document string) map[string]interface{} {
+ tree, err := format.Decode([]byte(document))
+ if err != nil {
+  t.Errorf("Failed to decode %s document: %s\n", format.String(), err.Error())
+ }
+ return tree
+}
+
+func expectTree(t *testing.T, format sources.IFormat, tree, expected map[string]interface{}) {
+ if !reflect.DeepEqual(tree, expected) {
+  t.Errorf("Unexpected %s tree:\n%#v\nexpected:\n%#v\n", format.String(), tree, expected)
+ }
+}
+
+func expectSyntaxError(t *testing.T, format sources.IFormat, document, message string) {
+ _, err := format.Decode([]byte(document))
+ if err == nil || !strings.Contains(err.Error(), message) {
+  t.Errorf("Expected a %s syntax error containing '%s', received: %v\n", format.String(), message, err)
+ }
+}
+
+func TestDecodeYAML(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ tree := decodeFormat(t, sources.YAML, `
+%YAML 1.2
+---
+# connection settings
+sql:
+  max_connections: 32   # per host
+  timeout: 1.5
+  enabled: true
+  password: ~
+  hosts:
+  - alpha
+  - "beta # not a comment"
+  replicas:
+    - name: 'it''s'
+      port: 0x10
+    - [1, 2, {a: b}]
+flow: {x: -7, "y": [true, null, 1e3],
+  z: .inf}
+literal: |
+  first
+   second
+
+folded: >-
+  one
+  two
+
+  three
+plain: it's a string
+url: http://example.com:8080
+empty:
+...
+ignored: true
+`)
+ expectTree(t, sources.YAML, tree, map[string]interface{}{
+  "sql": map[string]interface{}{
+   "max_connections": int64(32),
+   "timeout": 1.5,
+   "enabled": true,
+   "password": nil,
+   "hosts": []interface{}{"alpha", "beta # not a comment"},
+   "replicas": []interface{}{
+    map[string]interface{}{"name": "it's", "port": int64(16)},
+    []interface{}{int64(1), int64(2), map[string]interface{}{"a": "b"}},
+   },
+  },
+  "flow": map[string]interface{}{
+   "x": int64(-7),
+   "y": []interface{}{true, nil, 1e3},
+   "z": math.Inf(1),
+  },
+  "literal": "first\n second\n",
+  "folded": "one two\nthree",
+  "plain": "it's a string",
+  "url": "http://example.com:8080",
+  "empty": nil,
+ })
+}
+
+func TestDecodeYAMLSyntaxErrors(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ expectSyntaxError(t, sources.YAML, "a: 1\na: 2\n", "line 2: duplicate key 'a'")
+ expectSyntaxError(t, sources.YAML, "a:\n  b: 1\n   c: 2\n", "line 3: unexpected indentation")
+ expectSyntaxError(t, sources.YAML, "a: &anchor 1\n", "anchors, aliases and tags are not supported")
+ expectSyntaxError(t, sources.YAML, "a: [1, 2\n", "unterminated flow collection")
+ expectSyntaxError(t, sources.YAML, "a: \"open\n", "unterminated quoted scalar")
+ expectSyntaxError(t, sources.YAML, "- a\n- b\n", "the document must be a mapping")
+ expectSyntaxError(t, sources.YAML, "a: 1\n---\nb: 2\n", "multiple documents are not supported")
+ expectSyntaxError(t, sources.YAML, "a: b: c\n", "line 1: mapping values are not allowed here")
+ expectSyntaxError(t, sources.YAML, "a:\n- b: c: d\n", "line 2: mapping values are not allowed here")
+}
+
+func TestDecodeTOML(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ tree := decodeFormat(t, sources.TOML, `
+# connection settings
+title = "go-figure"
+"quoted key" = 'C:\path'
+dotted.key = 1_000
+
+[sql]
+max_connections = 32 # per host
+timeout = 1.5e0
+enabled = true
+hosts = [
+ "alpha", # trailing comma
+ "beta",
+]
+pool = {size = 0x10, idle.max = 0o7}
+
+[sql.tls]
+cert = """
+line one
+line two \
+  continued"""
+flags = 0b101
+
+[[servers]]
+name = "a"
+started = 1979-05-27T07:32:00Z
+
+[[servers]]
+name = "b"
+started = 1979-05-27 07:32:00
+`)
+ expectTree(t, sources.TOML, tree, map[string]interface{}{
+  "title": "go-figure",
+  "quoted key": `C:\path`,
+  "dotted": map[string]interface{}{"key": int64(1000)},
+  "sql": map[string]interface{}{
+   "max_connections": int64(32),
+   "timeout": 1.5,
+   "enabled": true,
+   "hosts": []interface{}{"alpha", "beta"},
+   "pool": map[string]interface{}{
+    "size": int64(16),
+    "idle": map[string]interface{}{"max": int64(7)},
+   },
+   "tls": map[string]interface{}{
+    "cert": "line one\nline two continued",
+    "flags": int64(5),
+   },
+  },
+  "servers": []interface{}{
+   map[string]interface{}{"name": "a", "started": time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC)},
+   map[string]interface{}{"name": "b", "started": time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC)},
+  },
+ })
+}
+
+func TestDecodeTOMLSyntaxErrors(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ expectSyntaxError(t, sources.TOML, "a = 1\na = 2\n", "line 2: key 'a' is defined more than once")
+ expectSyntaxError(t, sources.TOML, "[a]\n[a]\n", "line 2: table 'a' is defined more than once")
+ expectSyntaxError(t, sources.TOML, "a = {b = 1}\n[a]\n", "line 2: table 'a' is defined more than once")
+ expectSyntaxError(t, sources.TOML, "a = 01\n", "invalid value '01'")
+ expectSyntaxError(t, sources.TOML, "a = \"open\n", "unterminated string")
+ expectSyntaxError(t, sources.TOML, "a = 1 b = 2\n", "expected the end of the line")
+ expectSyntaxError(t, sources.TOML, "a = [1 2]\n", "expected ',' or ']'")
+}
+
+func TestFileSourceFormats(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ dir := tempDir(t)
+ defer os.RemoveAll(dir)
+ documents := map[string]string{
+  "config.json": `{"sql": {"max_connections": 32, "timeout": 5}}`,
+  "config.yaml": "sql:\n  max_connections: 32\n  timeout: 5\n",
+  "config.yml": "sql: {max_connections: 32, timeout: '5'}\n",
+  "config.toml": "[sql]\nmax_connections = 32\ntimeout = 5\n",
+ }
+ registry := newIntRegistry("sql.max_connections", "sql.timeout")
+ for name, document := range documents {
+  path := filepath.Join(dir, name)
+  if err := ioutil.WriteFile(path, []byte(document), 0600); err != nil {
+   t.Errorf("Failed to write '%s': %s\n", path, err.Error())
+   return
+  }
+  source, err := sources.NewFileSource(path, registry)
+  if err != nil {
+   t.Errorf("Failed to create a file source for '%s': %s\n", name, err.Error())
+   continue
+  }
+  cfg := metrics.DefaultEnvAndConfig().GetConfig()
+  writes := 0
+  cfg.AddParameterListener(
+   metrics.IntKeyValue(0),
+   config.PARAMETER_ACCESS_WRITE,
+   func(context config.IListenerContext, prev config.IParameterValue) error {
+    writes++
+    return nil
+   },
+  )
+  if err := sources.Apply(cfg, source); err != nil {
+   t.Errorf("Failed to apply '%s': %s\n", name, err.Error())
+   continue
+  }
+  if value, ok := cfg.GetParameter(metrics.IntKeyValue(0)); !ok || value != metrics.IntKeyValue(32) || writes != 1 {
+   t.Errorf("'%s' was not applied to the bus, value: %v, writes: %d\n", name, value, writes)
+  }
+  if value, ok := cfg.GetParameter(metrics.IntKeyValue(1)); !ok || value != metrics.IntKeyValue(5) {
+   t.Errorf("'%s' was not applied to the bus, value: %v\n", name, value)
+  }
+ }
+ if _, err := sources.NewFileSource(filepath.Join(dir, "config.ini"), registry); err == nil {
+  t.Errorf("Expected an error for a file without a registered format!\n")
+ }
+}
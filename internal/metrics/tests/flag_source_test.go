@@ -0,0 +1,115 @@
+package tests
+
+import (
+ "bytes"
+ "flag"
+ "strconv"
+ "strings"
+ "testing"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+ "github.com/Matthewacon/go-figure/keys"
+ "github.com/Matthewacon/go-figure/sources"
+ "github.com/Matthewacon/go-figure/values"
+)
+
+//Key with metadata for its generated flag
+type describedKey struct {
+ name        string
+ description string
+ def         config.IParameterValue
+}
+
+//config.IParameterKey, config.IDescribedKey and config.IDefaultedKey
+func (k describedKey) Key() interface{}                 { return k.name }
+func (k describedKey) String() string                   { return k.name }
+func (k describedKey) Description() string              { return k.description }
+func (k describedKey) Default() config.IParameterValue { return k.def }
+
+type boolValue bool
+
+func (v boolValue) Value() interface{} { return bool(v) }
+func (v boolValue) String() string     { return strconv.FormatBool(bool(v)) }
+
+func newFlagSource(args ...string) (*sources.FlagSource, *flag.FlagSet, error) {
+ maxConnections := describedKey{"sql.max_connections", "Maximum number of open connections", metrics.IntKeyValue(8)}
+ verbose := describedKey{"verbose", "Log every query", boolValue(false)}
+ registry := sources.NewRegistry()
+ registry.Register(maxConnections.name, maxConnections, sources.TextDecoder(metrics.DecodeIntKeyValue))
+ registry.Register(verbose.name, verbose, sources.TextDecoder(func(raw string) (config.IParameterValue, error) {
+  b, err := strconv.ParseBool(raw)
+  return boolValue(b), err
+ }))
+ registry.Register("sql.timeout", metrics.IntKeyValue(0), sources.TextDecoder(metrics.DecodeIntKeyValue))
+ flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+ flagSet.SetOutput(&bytes.Buffer{})
+ src := sources.NewFlagSource(flagSet, registry)
+ return src, flagSet, flagSet.Parse(args)
+}
+
+func TestFlagSource(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ src, flagSet, err := newFlagSource("--sql-max-connections", "32", "-verbose")
+ if err != nil {
+  t.Errorf("Failed to parse flags: %s\n", err.Error())
+  return
+ }
+ f := flagSet.Lookup("sql-max-connections")
+ if f == nil || f.Usage != "Maximum number of open connections" || f.DefValue != "8" {
+  t.Errorf("Unexpected generated flag: %+v\n", f)
+ }
+ if f := flagSet.Lookup("sql-timeout"); f == nil || !strings.Contains(f.Usage, "sql.timeout") {
+  t.Errorf("Unexpected generated flag: %+v\n", f)
+ }
+ params, _ := src.Load()
+ maxConnections := describedKey{"sql.max_connections", "Maximum number of open connections", metrics.IntKeyValue(8)}
+ verbose := describedKey{"verbose", "Log every query", boolValue(false)}
+ if len(params) != 2 || params[maxConnections] != metrics.IntKeyValue(32) || params[verbose] != boolValue(true) {
+  t.Errorf("Expected only the explicitly set flags, received: %v\n", params)
+ }
+ if !src.IsSet(maxConnections) || src.IsSet(metrics.IntKeyValue(0)) {
+  t.Errorf("Explicitly set flags are indistinguishable from defaults!\n")
+ }
+ if defaults := src.Defaults(); len(defaults) != 2 || defaults[maxConnections] != metrics.IntKeyValue(8) {
+  t.Errorf("Unexpected defaults: %v\n", defaults)
+ }
+ //flags and defaults feed separate layers
+ _, cfg := metrics.DefaultEnvAndLayeredConfig()
+ cfg.Layer(config.LAYER_DEFAULTS).SetParameters(src.Defaults())
+ if err := sources.Apply(cfg.Layer(config.LAYER_FLAGS), src); err != nil {
+  t.Errorf("Failed to apply flags: %s\n", err.Error())
+ }
+ if layer, _ := cfg.ResolveLayer(maxConnections); layer != config.LAYER_FLAGS {
+  t.Errorf("Expected 'sql.max_connections' from the flags layer, received: '%s'\n", layer)
+ }
+}
+
+//Boolean keys without a boolean default may be passed without a value as well
+func TestFlagSourceBoolKey(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ dryRun := keys.NewBoolKey("dry_run")
+ registry := sources.NewRegistry()
+ registry.Register("dry_run", dryRun, sources.TextDecoder(values.ParseBool))
+ flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+ flagSet.SetOutput(&bytes.Buffer{})
+ src := sources.NewFlagSource(flagSet, registry)
+ if err := flagSet.Parse([]string{"-dry-run"}); err != nil {
+  t.Fatalf("Failed to parse flags: %s\n", err.Error())
+ }
+ if params, _ := src.Load(); params[dryRun] != values.Bool(true) {
+  t.Errorf("Expected '-dry-run' to set the parameter, received: %v\n", params)
+ }
+}
+
+func TestFlagSourceInvalidValue(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ if _, _, err := newFlagSource("--sql-timeout", "soon"); err == nil {
+  t.Errorf("Expected an error for an invalid flag value!\n")
+ }
+}
+
+func TestFlagSourceUnregisteredKey(t *testing.T) {
+ defer metrics.CatchExpectedPanic(t)
+ sources.NewFlagSource(flag.NewFlagSet("test", flag.ContinueOnError), sources.NewRegistry(), metrics.IntKeyValue(0))
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+ "reflect"
+ "testing"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+ "github.com/Matthewacon/go-figure/keys"
+ "github.com/Matthewacon/go-figure/match"
+)
+
+func drain(cfg config.IConfigBus) {
+ if async, ok := cfg.(config.IAsynchronousConfigBus); ok {
+  async.Drain()
+ }
+}
+
+func TestGroupListeners(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, async := metrics.DefaultEnvAndAsynchronousConfig()
+ for _, cfg := range []config.IConfigBus{metrics.DefaultEnvAndConfig().GetConfig(), async} {
+  host := keys.NewStringKey("sql.host")
+  pool := keys.NewIntKey("sql.pool.size")
+  port := keys.NewIntKey("http.port")
+  glob, err := match.Glob("sql.p*")
+  if err != nil {
+   t.Fatal(err)
+  }
+  prefixed := recordGroup(cfg, match.Prefix("sql."), config.PARAMETER_ACCESS_WRITE)
+  globbed := recordGroup(cfg, glob, config.PARAMETER_ACCESS_WRITE)
+  typed := recordGroup(cfg, match.Type(metrics.IntKeyValue(0)), config.PARAMETER_ACCESS_WRITE)
+  predicate := recordGroup(
+   cfg,
+   match.Func("port", func(key config.IParameterKey) bool { return key == port }),
+   config.PARAMETER_ACCESS_READ,
+  )
+  //none of the keys existed when the listeners were registered
+  cfg.SetParameter(host, metrics.IntKeyValue(1))
+  cfg.SetParameter(pool, metrics.IntKeyValue(2))
+  cfg.SetParameter(port, metrics.IntKeyValue(3))
+  cfg.SetParameter(metrics.IntKeyValue(4), metrics.IntKeyValue(4))
+  cfg.GetParameter(port)
+  cfg.GetParameter(host)
+  drain(cfg)
+  for _, test := range []struct {
+   received *recorder
+   expected []string
+  }{
+   {prefixed, []string{"sql.host", "sql.pool.size"}},
+   {globbed, []string{"sql.pool.size"}},
+   {typed, []string{"4"}},
+   {predicate, []string{"http.port"}},
+  } {
+   if received := test.received.keys(); !reflect.DeepEqual(received, test.expected) {
+    t.Errorf("Expected events for %v, received: %v\n", test.expected, received)
+   }
+  }
+ }
+}
+
+func TestGroupListenerHandle(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, async := metrics.DefaultEnvAndAsynchronousConfig()
+ for _, cfg := range []config.IConfigBus{metrics.DefaultEnvAndConfig().GetConfig(), async} {
+  key := keys.NewIntKey("sql.port")
+  order := []string{}
+  handle := cfg.AddGroupListener(match.Prefix("sql."), config.PARAMETER_ACCESS_ANY, func(config.IListenerContext, config.IParameterValue) error {
+   order = append(order, "group")
+   return nil
+  })
+  cfg.AddParameterListener(key, config.PARAMETER_ACCESS_WRITE, func(config.IListenerContext, config.IParameterValue) error {
+   order = append(order, "key")
+   return nil
+  })
+  if handle.Key().String() != "group(sql.*)" {
+   t.Errorf("Expected the handle key to describe the group, received: %s\n", handle.Key().String())
+  }
+  cfg.SetParameter(key, metrics.IntKeyValue(1))
+  drain(cfg)
+  if !reflect.DeepEqual(order, []string{"key", "group"}) {
+   t.Errorf("Expected group listeners to follow key listeners, received: %v\n", order)
+  }
+  handle.Update(config.PARAMETER_ACCESS_READ)
+  cfg.SetParameter(key, metrics.IntKeyValue(2))
+  drain(cfg)
+  handle.Unsubscribe()
+  cfg.GetParameter(key)
+  drain(cfg)
+  if !reflect.DeepEqual(order, []string{"key", "group", "key"}) {
+   t.Errorf("Expected no group events after the update and unsubscribe, received: %v\n", order)
+  }
+ }
+}
+
+func TestGlobRejectsInvalidPatterns(t *testing.T) {
+ if _, err := match.Glob("sql.[a"); err == nil {
+  t.Errorf("Expected an error for an invalid pattern\n")
+ }
+}
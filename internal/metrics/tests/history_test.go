@@ -0,0 +1,175 @@
+package tests
+
+import (
+ "errors"
+ "testing"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/history"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+)
+
+func TestHistoryRecordsChanges(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ h := history.NewHistory(0)
+ cfg.SetHistory(h)
+ a, b := metrics.IntKeyValue(0), metrics.IntKeyValue(1)
+ cfg.SetParameter(a, metrics.IntKeyValue(1))
+ cfg.AddParameterListener(a, config.PARAMETER_ACCESS_WRITE, func(context config.IListenerContext, _ config.IParameterValue) error {
+  context.Config().SetParameter(b, metrics.IntKeyValue(1))
+  return nil
+ })
+ cfg.SetParameter(a, metrics.IntKeyValue(2))
+ cfg.RemoveParameter(a)
+ entries := h.ForKey(a)
+ if len(entries) != 3 || h.Len() != 5 {
+  t.Fatalf("Expected 3 changes of the key and 5 in total, received: %v\n", h.Entries())
+ }
+ if entries[0].Prev != nil || entries[1].Prev != metrics.IntKeyValue(1) || entries[1].Value != metrics.IntKeyValue(2) {
+  t.Errorf("Expected the values before and after each change, received: %v\n", entries)
+ }
+ if entries[2].Prev != metrics.IntKeyValue(2) || entries[2].Value != nil {
+  t.Errorf("Expected the remove to record a nil value, received: %v\n", entries[2])
+ }
+ if written := h.ForKey(b); len(written) != 2 || written[0].Listener == nil || entries[1].Listener != nil {
+  t.Errorf("Expected the listener to be recorded as the origin of its writes only, received: %v\n", written)
+ }
+}
+
+func TestHistoryEvictsOldestChanges(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ h := history.NewHistory(2)
+ cfg.SetHistory(h)
+ key := metrics.IntKeyValue(0)
+ for i := 1; i <= 3; i++ {
+  cfg.SetParameter(key, metrics.IntKeyValue(i))
+ }
+ entries := h.Entries()
+ if len(entries) != 2 || entries[0].Value != metrics.IntKeyValue(2) || entries[1].Value != metrics.IntKeyValue(3) {
+  t.Fatalf("Expected the last 2 changes, received: %v\n", entries)
+ }
+ if _, _, err := h.AsOf(cfg, key, entries[0].Time.Add(-time.Hour)); err == nil {
+  t.Errorf("Expected an error for a time before the evicted changes\n")
+ } else if _, ok := err.(*history.TruncatedError); !ok {
+  t.Errorf("Expected a *history.TruncatedError, received: %T\n", err)
+ }
+}
+
+func TestHistoryAsOf(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ h := history.NewHistory(0)
+ cfg.SetHistory(h)
+ key := metrics.IntKeyValue(0)
+ before := time.Now()
+ time.Sleep(time.Millisecond)
+ cfg.SetParameter(key, metrics.IntKeyValue(1))
+ time.Sleep(time.Millisecond)
+ between := time.Now()
+ time.Sleep(time.Millisecond)
+ cfg.SetParameter(key, metrics.IntKeyValue(2))
+ reads := record(cfg, config.PARAMETER_ACCESS_ANY, key)
+ if _, ok, err := h.AsOf(cfg, key, before); err != nil || ok {
+  t.Errorf("Expected the parameter to be undefined before the first write, received: %v, %v\n", ok, err)
+ }
+ if value, _, _ := h.AsOf(cfg, key, between); value != metrics.IntKeyValue(1) {
+  t.Errorf("Expected the value of the first write, received: %v\n", value)
+ }
+ if value, _, _ := h.AsOf(cfg, key, time.Now()); value != metrics.IntKeyValue(2) {
+  t.Errorf("Expected the current value, received: %v\n", value)
+ }
+ if reads.count(nil, config.PARAMETER_ACCESS_READ) != 0 {
+  t.Errorf("Expected queries to raise no READ events, received: %d\n", reads.count(nil, config.PARAMETER_ACCESS_READ))
+ }
+}
+
+func TestHistoryUndo(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, async := metrics.DefaultEnvAndAsynchronousConfig()
+ for _, cfg := range []config.IConfigBus{metrics.DefaultEnvAndConfig().GetConfig(), async} {
+  h := history.NewHistory(0)
+  cfg.SetHistory(h)
+  a, b := metrics.IntKeyValue(0), metrics.IntKeyValue(1)
+  cfg.SetParameter(a, metrics.IntKeyValue(1))
+  cfg.SetParameter(a, metrics.IntKeyValue(2))
+  cfg.SetParameter(b, metrics.IntKeyValue(1))
+  cfg.SetParameter(a, metrics.IntKeyValue(3))
+  reverted, err := h.Undo(cfg, 3)
+  if err != nil {
+   t.Fatalf("Failed to undo: %s\n", err.Error())
+  }
+  if len(reverted) != 3 || reverted[0].Value != metrics.IntKeyValue(3) {
+   t.Errorf("Expected the last 3 changes, newest first, received: %v\n", reverted)
+  }
+  if params := cfg.GetParameters(); len(params) != 1 || params[a] != metrics.IntKeyValue(1) {
+   t.Errorf("Expected the parameters before the undone changes, received: %v\n", params)
+  }
+  if h.Len() != 1 {
+   t.Errorf("Expected the undo to drop the reverted changes without recording its own, received: %v\n", h.Entries())
+  }
+  if _, err := h.Undo(cfg, 5); err != nil {
+   t.Fatalf("Failed to undo: %s\n", err.Error())
+  }
+  if params := cfg.GetParameters(); len(params) != 0 || h.Len() != 0 {
+   t.Errorf("Expected consecutive undos to step further back, received: %v\n", params)
+  }
+ }
+}
+
+//A rejected undo leaves the history as it was, neither the undo nor its rollback is recorded
+func TestHistoryUndoRolledBack(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ h := history.NewHistory(0)
+ cfg.SetHistory(h)
+ a := metrics.IntKeyValue(0)
+ cfg.SetParameter(a, metrics.IntKeyValue(1))
+ cfg.SetParameter(a, metrics.IntKeyValue(2))
+ cfg.SetListenerErrorPolicy(config.LISTENER_ERROR_ROLLBACK)
+ cfg.AddParameterListener(a, config.PARAMETER_ACCESS_WRITE, func(context config.IListenerContext, _ config.IParameterValue) error {
+  if context.Event().Value == metrics.IntKeyValue(1) {
+   return errors.New("rejected")
+  }
+  return nil
+ })
+ var rollback *config.RollbackError
+ if _, err := h.Undo(cfg, 1); !errors.As(err, &rollback) {
+  t.Fatalf("Expected a *config.RollbackError, received: %v\n", err)
+ }
+ if value, _ := cfg.GetParameter(a); value != metrics.IntKeyValue(2) {
+  t.Errorf("Expected the rejected undo to be rolled back, received: %v\n", value)
+ }
+ entries := h.Entries()
+ if len(entries) != 2 || entries[0].Value != metrics.IntKeyValue(1) || entries[1].Value != metrics.IntKeyValue(2) {
+  t.Errorf("Expected the history to be left as it was, received: %v\n", entries)
+ }
+}
+
+//Changes recorded while a rejected undo commits are kept after the changes the undo left in place
+func TestHistoryUndoRolledBackKeepsOrder(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ h := history.NewHistory(0)
+ cfg.SetHistory(h)
+ a, b := metrics.IntKeyValue(0), metrics.IntKeyValue(1)
+ cfg.SetParameter(a, metrics.IntKeyValue(1))
+ cfg.SetParameter(a, metrics.IntKeyValue(2))
+ cfg.SetListenerErrorPolicy(config.LISTENER_ERROR_ROLLBACK)
+ cfg.AddParameterListener(a, config.PARAMETER_ACCESS_WRITE, func(context config.IListenerContext, _ config.IParameterValue) error {
+  if context.Event().Value == metrics.IntKeyValue(1) {
+   context.Config().SetParameter(b, metrics.IntKeyValue(1))
+   return errors.New("rejected")
+  }
+  return nil
+ })
+ if _, err := h.Undo(cfg, 1); err == nil {
+  t.Fatalf("Expected the undo to be rejected!\n")
+ }
+ entries := h.Entries()
+ if len(entries) != 3 || entries[1].Value != metrics.IntKeyValue(2) || entries[2].Key != b {
+  t.Errorf("Expected the history to keep its order, received: %v\n", entries)
+ }
+}
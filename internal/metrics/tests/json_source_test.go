@@ -0,0 +1,191 @@
+package tests
+
+import (
+ "errors"
+ "fmt"
+ "io/ioutil"
+ "math"
+ "os"
+ "path/filepath"
+ "testing"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+ "github.com/Matthewacon/go-figure/sources"
+ "github.com/Matthewacon/go-figure/values"
+)
+
+func TestDecodeJSON(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ registry := newIntRegistry("sql.max_connections", "sql.timeout", "retries")
+ params, err := sources.DecodeJSON(registry, []byte(`{
+  "sql": {"max_connections": 32},
+  "sql.timeout": 5,
+  "retries": "3"
+ }`))
+ if err != nil {
+  t.Errorf("Failed to decode JSON: %s\n", err.Error())
+  return
+ }
+ expected := config.Parameters{
+  metrics.IntKeyValue(0): metrics.IntKeyValue(32),
+  metrics.IntKeyValue(1): metrics.IntKeyValue(5),
+  metrics.IntKeyValue(2): metrics.IntKeyValue(3),
+ }
+ if len(params) != len(expected) {
+  t.Errorf("Expected %d parameters, decoded: %v\n", len(expected), params)
+ }
+ for key, value := range expected {
+  if params[key] != value {
+   t.Errorf("Parameter [%v] decoded as '%v', expected: '%v'\n", key, params[key], value)
+  }
+ }
+}
+
+func TestDecodeJSONReportsPaths(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ registry := newIntRegistry("sql.max_connections", "sql.timeout")
+ _, err := sources.DecodeJSON(registry, []byte(`{
+  "sql": {"max_connections": {"min": 1}, "timeout": "soon", "pool": {"size": 1}}
+ }`))
+ var errs sources.Errors
+ if !errors.As(err, &errs) || len(errs) != 3 {
+  t.Errorf("Expected 3 errors, received: %v\n", err)
+  return
+ }
+ var mismatch *sources.DecodeError
+ if !errors.As(errs[0], &mismatch) || mismatch.Name != "sql.max_connections" {
+  t.Errorf("Expected a type mismatch for 'sql.max_connections', received: %v\n", errs[0])
+ }
+ var unknown *sources.UnknownParameterError
+ if !errors.As(errs[1], &unknown) || unknown.Path != "sql.pool.size" {
+  t.Errorf("Expected an unknown parameter error for 'sql.pool.size', received: %v\n", errs[1])
+ }
+ if !errors.As(errs[2], &mismatch) || mismatch.Name != "sql.timeout" {
+  t.Errorf("Expected a type mismatch for 'sql.timeout', received: %v\n", errs[2])
+ }
+}
+
+func TestDecodeJSONRejectsTrailingData(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ registry := newIntRegistry("sql.max_connections")
+ for _, document := range []string{
+  `{"sql": {"max_connections": 8}} garbage`,
+  `{"sql": {"max_connections": 8}} {"sql": {"max_connections": 16}}`,
+  `{"sql": {"max_connections": 8}}}`,
+ } {
+  if _, err := sources.DecodeJSON(registry, []byte(document)); err == nil {
+   t.Errorf("Expected an error for trailing data: %s\n", document)
+  }
+ }
+ if _, err := sources.DecodeJSON(registry, []byte("{\"sql\": {\"max_connections\": 8}}\n\t ")); err != nil {
+  t.Errorf("Trailing whitespace was rejected: %s\n", err.Error())
+ }
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ registry := newIntRegistry("sql.max_connections", "sql.timeout", "sql", "id")
+ original := config.Parameters{
+  metrics.IntKeyValue(0): metrics.IntKeyValue(32),
+  metrics.IntKeyValue(1): metrics.IntKeyValue(-5),
+  //a parameter sharing its name with a table
+  metrics.IntKeyValue(2): metrics.IntKeyValue(1),
+  //not representable as a float64
+  metrics.IntKeyValue(3): metrics.IntKeyValue(1 << 53 + 1),
+ }
+ cfg.SetParameters(original)
+ data, err := sources.ExportJSON(registry, cfg.GetParameters())
+ if err != nil {
+  t.Errorf("Failed to export JSON: %s\n", err.Error())
+  return
+ }
+ dir := tempDir(t)
+ defer os.RemoveAll(dir)
+ path := filepath.Join(dir, "config.json")
+ if err := ioutil.WriteFile(path, data, 0644); err != nil {
+  t.Errorf("Failed to write JSON: %s\n", err.Error())
+  return
+ }
+ restored, err := sources.NewJSONSource(path, registry).Load()
+ if err != nil {
+  t.Errorf("Failed to load exported JSON:\n%s\n%s\n", string(data), err.Error())
+  return
+ }
+ if len(restored) != len(original) {
+  t.Errorf("Round trip changed the number of parameters:\n%s\n", string(data))
+ }
+ for key, value := range original {
+  if restored[key] != value {
+   t.Errorf("Parameter [%v] round tripped as '%v', expected: '%v'\n", key, restored[key], value)
+  }
+ }
+}
+
+//Every built-in value type must survive an export without an encoder
+func TestJSONRoundTripValues(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ parse := func(raw string, parser func(string) (config.IParameterValue, error)) config.IParameterValue {
+  value, err := parser(raw)
+  if err != nil {
+   t.Fatalf("Failed to parse '%s': %s\n", raw, err.Error())
+  }
+  return value
+ }
+ cases := []struct {
+  value   config.IParameterValue
+  decoder sources.Decoder
+ }{
+  {values.String(" padded "), sources.TextDecoder(values.ParseString)},
+  {values.Bool(true), sources.TextDecoder(values.ParseBool)},
+  {values.Int(-42), sources.TextDecoder(values.ParseInt)},
+  {values.Uint(math.MaxUint64), sources.TextDecoder(values.ParseUint)},
+  {values.Float(1.5), sources.TextDecoder(values.ParseFloat)},
+  {values.Duration(5 * time.Second), sources.TextDecoder(values.ParseDuration)},
+  {parse("1979-05-27T00:32:00.5-07:00", values.ParseTime), sources.TextDecoder(values.ParseTime)},
+  {parse("https://example.com/a?b=c", values.ParseURL), sources.TextDecoder(values.ParseURL)},
+  {parse("^a+$", values.ParseRegexp), sources.TextDecoder(values.ParseRegexp)},
+  {512 * values.MIB, sources.TextDecoder(values.ParseByteSize)},
+  {values.StringList{"a,b", " c"}, values.DecodeStringList},
+  {values.StringMap{"k": "v=1", "l": "w,2"}, values.DecodeStringMap},
+ }
+ registry := sources.NewRegistry()
+ original := config.Parameters{}
+ for i, c := range cases {
+  registry.Register(fmt.Sprintf("value%d", i), metrics.IntKeyValue(i), c.decoder)
+  original[metrics.IntKeyValue(i)] = c.value
+ }
+ data, err := sources.ExportJSON(registry, original)
+ if err != nil {
+  t.Fatalf("Failed to export JSON: %s\n", err.Error())
+ }
+ restored, err := sources.DecodeJSON(registry, data)
+ if err != nil {
+  t.Fatalf("Failed to decode exported JSON:\n%s\n%s\n", string(data), err.Error())
+ }
+ for key, value := range original {
+  if !config.ValuesEqual(value, restored[key]) {
+   t.Errorf("%T '%v' round tripped as '%v':\n%s\n", value, value, restored[key], string(data))
+  }
+ }
+}
+
+func TestExportJSONUnregisteredKey(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ registry := newIntRegistry("sql.max_connections")
+ _, err := sources.ExportJSON(registry, config.Parameters{metrics.IntKeyValue(1): metrics.IntKeyValue(1)})
+ var unregistered *sources.UnregisteredKeyError
+ if !errors.As(err, &unregistered) {
+  t.Errorf("Expected a *sources.UnregisteredKeyError, received: %v\n", err)
+ }
+}
+
+func tempDir(t *testing.T) string {
+ dir, err := ioutil.TempDir("", "go-figure")
+ if err != nil {
+  t.Fatalf("Failed to create temporary directory: %s\n", err.Error())
+ }
+ return dir
+}
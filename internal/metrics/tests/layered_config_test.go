@@ -0,0 +1,119 @@
+package tests
+
+import (
+ "testing"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+ "github.com/Matthewacon/go-figure/sources"
+)
+
+func expectResolved(t *testing.T, cfg config.ILayeredConfigBus, key config.IParameterKey, value config.IParameterValue, layer string) {
+ if v, ok := cfg.GetParameter(key); !ok || v != value {
+  t.Errorf("Expected [%v] to resolve to '%v', received: '%v'\n", key.Key(), value, v)
+ }
+ if l, ok := cfg.ResolveLayer(key); !ok || l != layer {
+  t.Errorf("Expected [%v] to be supplied by layer '%s', received: '%s'\n", key.Key(), layer, l)
+ }
+}
+
+func TestLayeredPrecedence(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndLayeredConfig()
+ expected := []string{
+  config.LAYER_DEFAULTS,
+  config.LAYER_FILE,
+  config.LAYER_ENVIRONMENT,
+  config.LAYER_FLAGS,
+  config.LAYER_OVERRIDES,
+ }
+ if layers := cfg.Layers(); len(layers) != len(expected) {
+  t.Errorf("Unexpected default layers: %v\n", layers)
+  return
+ }
+ kv := metrics.IntKeyValue(0)
+ if _, ok := cfg.ResolveLayer(kv); ok {
+  t.Errorf("Undefined parameter was resolved to a layer!\n")
+ }
+ cfg.Layer(config.LAYER_DEFAULTS).SetParameter(kv, metrics.IntKeyValue(1))
+ cfg.Layer(config.LAYER_FLAGS).SetParameter(kv, metrics.IntKeyValue(3))
+ cfg.Layer(config.LAYER_ENVIRONMENT).SetParameter(kv, metrics.IntKeyValue(2))
+ expectResolved(t, cfg, kv, metrics.IntKeyValue(3), config.LAYER_FLAGS)
+ //bus writes go to the highest precedence layer
+ cfg.SetParameter(kv, metrics.IntKeyValue(4))
+ expectResolved(t, cfg, kv, metrics.IntKeyValue(4), config.LAYER_OVERRIDES)
+ //removing a parameter from an upper layer reveals the lower one
+ if value, ok := cfg.RemoveParameter(kv); !ok || value != metrics.IntKeyValue(4) {
+  t.Errorf("Failed to remove the override, received: '%v'\n", value)
+ }
+ expectResolved(t, cfg, kv, metrics.IntKeyValue(3), config.LAYER_FLAGS)
+ cfg.Layer(config.LAYER_FLAGS).RemoveParameter(kv)
+ expectResolved(t, cfg, kv, metrics.IntKeyValue(2), config.LAYER_ENVIRONMENT)
+ if value, ok := cfg.Layer(config.LAYER_DEFAULTS).GetParameter(kv); !ok || value != metrics.IntKeyValue(1) {
+  t.Errorf("Layer returned '%v' instead of its own value\n", value)
+ }
+ if params := cfg.GetParameters(); len(params) != 1 || params[kv] != metrics.IntKeyValue(2) {
+  t.Errorf("Unexpected effective parameters: %v\n", params)
+ }
+ if cfg.Layer("unknown") != nil {
+  t.Errorf("Expected no layer for an unknown name!\n")
+ }
+}
+
+func TestLayeredWriteListenersFireOnEffectiveChange(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndLayeredConfig("defaults", "file", "overrides")
+ kv := metrics.IntKeyValue(0)
+ writes := record(cfg, config.PARAMETER_ACCESS_WRITE, kv)
+ defaults, file, overrides := cfg.Layer("defaults"), cfg.Layer("file"), cfg.Layer("overrides")
+ file.SetParameter(kv, metrics.IntKeyValue(2))
+ //shadowed by the file layer
+ defaults.SetParameter(kv, metrics.IntKeyValue(1))
+ //same effective value
+ overrides.SetParameter(kv, metrics.IntKeyValue(2))
+ overrides.RemoveParameter(kv)
+ if received := writes.received(); len(received) != 1 || received[0].Prev != nil {
+  t.Errorf("Expected a single WRITE event for the first value, received: %v\n", received)
+ }
+ //revealing a different value is a change
+ file.RemoveParameter(kv)
+ defaults.RemoveParameter(kv)
+ if received := writes.received(); len(received) != 3 || received[1].Prev != metrics.IntKeyValue(2) || received[2].Prev != metrics.IntKeyValue(1) {
+  t.Errorf("Expected WRITE events when the effective value changes, received: %v\n", received)
+ }
+ if _, ok := cfg.GetParameter(kv); ok {
+  t.Errorf("Parameter is still defined after removing it from every layer!\n")
+ }
+}
+
+func TestLayeredListenerContextWritesOverrides(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndLayeredConfig()
+ x, y := metrics.IntKeyValue(0), metrics.IntKeyValue(1)
+ calls := 0
+ addForwardingListener(cfg, x, y, &calls)
+ cfg.Layer(config.LAYER_FILE).SetParameter(x, x)
+ if calls != 1 {
+  t.Errorf("Listener was not invoked for a layer write!\n")
+ }
+ expectResolved(t, cfg, y, y, config.LAYER_OVERRIDES)
+}
+
+func TestApplySourceToLayer(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndLayeredConfig()
+ registry := newIntRegistry("sql.max_connections")
+ source := sources.NewEnvironmentSource("MYAPP", registry)
+ source.Environ = environ("MYAPP_SQL_MAX_CONNECTIONS=32")
+ cfg.Layer(config.LAYER_DEFAULTS).SetParameter(metrics.IntKeyValue(0), metrics.IntKeyValue(8))
+ if err := sources.Apply(cfg.Layer(config.LAYER_ENVIRONMENT), source); err != nil {
+  t.Errorf("Failed to apply the environment: %s\n", err.Error())
+  return
+ }
+ expectResolved(t, cfg, metrics.IntKeyValue(0), metrics.IntKeyValue(32), config.LAYER_ENVIRONMENT)
+}
+
+func TestLayeredDuplicateLayer(t *testing.T) {
+ defer metrics.CatchExpectedPanic(t)
+ metrics.DefaultEnvAndLayeredConfig("defaults", "defaults")
+}
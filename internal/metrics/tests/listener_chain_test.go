@@ -0,0 +1,127 @@
+package tests
+
+import (
+ "errors"
+ "testing"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+)
+
+//Listener on `from` that writes `to` through its listener context
+func addForwardingListener(cfg config.IConfigBus, from, to metrics.IntKeyValue, calls *int) {
+ cfg.AddParameterListener(
+  from,
+  config.PARAMETER_ACCESS_WRITE,
+  func(context config.IListenerContext, prev config.IParameterValue) error {
+   *calls++
+   context.Config().SetParameter(to, to)
+   return nil
+  },
+ )
+}
+
+func collectListenerErrors(cfg config.IConfigBus) *[]error {
+ errs := &[]error{}
+ cfg.SetCallbackErrorHandler(
+  func(active config.ParameterListener, access config.ParameterAccess, key config.IParameterKey, err error) {
+   *errs = append(*errs, err)
+  },
+ )
+ return errs
+}
+
+func TestListenerCycleDetection(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ errs := collectListenerErrors(cfg)
+ x, y := metrics.IntKeyValue(0), metrics.IntKeyValue(1)
+ aCalls, bCalls := 0, 0
+ //A writes Y, B writes X, which would trigger A again
+ addForwardingListener(cfg, x, y, &aCalls)
+ addForwardingListener(cfg, y, x, &bCalls)
+ cfg.SetParameter(x, x)
+ if aCalls != 1 || bCalls != 1 {
+  t.Errorf("Expected each listener to be invoked once, A: %d, B: %d\n", aCalls, bCalls)
+ }
+ if len(*errs) != 1 {
+  t.Errorf("Expected a single listener cycle error, received: %v\n", *errs)
+  return
+ }
+ var cycle *config.ListenerCycleError
+ if !errors.As((*errs)[0], &cycle) {
+  t.Errorf("Expected a *config.ListenerCycleError, received: %v\n", (*errs)[0])
+  return
+ }
+ if len(cycle.Chain) != 3 || cycle.Chain[0].Key != x || cycle.Chain[1].Key != y || cycle.Chain[2].Key != x {
+  t.Errorf("Unexpected listener chain: %s\n", cycle.Chain.String())
+ }
+ if cycle.Chain[0].ParameterListener != cycle.Chain[2].ParameterListener {
+  t.Errorf("Listener cycle does not start and end with the same listener: %s\n", cycle.Chain.String())
+ }
+}
+
+func TestListenerMaxDepth(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ errs := collectListenerErrors(cfg)
+ maxDepth := 4
+ if prev := cfg.SetMaxListenerDepth(maxDepth); prev != config.DEFAULT_MAX_LISTENER_DEPTH {
+  t.Errorf("Expected the default max listener depth: %d, received: %d\n", config.DEFAULT_MAX_LISTENER_DEPTH, prev)
+ }
+ calls := 0
+ //a chain of distinct listeners, each forwarding to the next key
+ for i := 0; i < 2 * maxDepth; i++ {
+  addForwardingListener(cfg, metrics.IntKeyValue(i), metrics.IntKeyValue(i + 1), &calls)
+ }
+ cfg.SetParameter(metrics.IntKeyValue(0), metrics.IntKeyValue(0))
+ if calls != maxDepth {
+  t.Errorf("Expected %d nested listener invocations, received: %d\n", maxDepth, calls)
+ }
+ var depth *config.ListenerDepthError
+ if len(*errs) != 1 || !errors.As((*errs)[0], &depth) {
+  t.Errorf("Expected a single *config.ListenerDepthError, received: %v\n", *errs)
+  return
+ }
+ if depth.MaxDepth != maxDepth || len(depth.Chain) != maxDepth + 1 {
+  t.Errorf("Unexpected listener depth error: %s", depth.Error())
+ }
+ //a depth of 0 disables the limit
+ *errs = nil
+ calls = 0
+ cfg.SetMaxListenerDepth(0)
+ cfg.SetParameter(metrics.IntKeyValue(0), metrics.IntKeyValue(0))
+ if calls != 2 * maxDepth || len(*errs) != 0 {
+  t.Errorf("Unlimited listener depth was limited, invocations: %d, errors: %v\n", calls, *errs)
+ }
+}
+
+func TestListenerCycleDefaultErrorHandler(t *testing.T) {
+ defer metrics.CatchExpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ x, y := metrics.IntKeyValue(0), metrics.IntKeyValue(1)
+ calls := 0
+ addForwardingListener(cfg, x, y, &calls)
+ addForwardingListener(cfg, y, x, &calls)
+ cfg.SetParameter(x, x)
+}
+
+func TestAsyncListenerCycleDetection(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ defer cfg.Close()
+ errs := collectListenerErrors(cfg)
+ x, y := metrics.IntKeyValue(0), metrics.IntKeyValue(1)
+ aCalls, bCalls := 0, 0
+ addForwardingListener(cfg, x, y, &aCalls)
+ addForwardingListener(cfg, y, x, &bCalls)
+ cfg.SetParameter(x, x)
+ cfg.Drain()
+ if aCalls != 1 || bCalls != 1 {
+  t.Errorf("Expected each listener to be invoked once, A: %d, B: %d\n", aCalls, bCalls)
+ }
+ var cycle *config.ListenerCycleError
+ if len(*errs) != 1 || !errors.As((*errs)[0], &cycle) {
+  t.Errorf("Expected a single *config.ListenerCycleError, received: %v\n", *errs)
+ }
+}
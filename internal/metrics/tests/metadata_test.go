@@ -0,0 +1,144 @@
+package tests
+
+import (
+ "errors"
+ "fmt"
+ "strings"
+ "testing"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+ "github.com/Matthewacon/go-figure/metadata"
+ "github.com/Matthewacon/go-figure/sources"
+)
+
+type recordingLogger struct {
+ messages []string
+}
+
+func (logger *recordingLogger) Printf(format string, v ...interface{}) {
+ logger.messages = append(logger.messages, fmt.Sprintf(format, v...))
+}
+
+//Installs a panic handler that records the panics of the bus instead of raising them
+func recordPanics(cfg config.IConfigBus) *[]interface{} {
+ panics := &[]interface{}{}
+ cfg.SetUnexpectedPanicHandler(func(p interface{}) {
+  *panics = append(*panics, p)
+ })
+ return panics
+}
+
+func TestDeprecatedKeyForwarding(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ registry := metadata.NewRegistry()
+ logger := &recordingLogger{}
+ registry.SetLogger(logger)
+ registry.Declare(config.KeyMetadata{Key: metrics.IntKeyValue(1), Description: "current"})
+ registry.Declare(config.KeyMetadata{
+  Key: metrics.IntKeyValue(0),
+  Deprecation: "renamed",
+  ReplacedBy: metrics.IntKeyValue(1),
+ })
+ cfg.SetKeyRegistry(registry)
+ var prevs []config.IParameterValue
+ cfg.AddParameterListener(metrics.IntKeyValue(0), config.PARAMETER_ACCESS_WRITE, func(_ config.IListenerContext, prev config.IParameterValue) error {
+  prevs = append(prevs, prev)
+  return nil
+ })
+ cfg.SetParameter(metrics.IntKeyValue(0), metrics.IntKeyValue(5))
+ if value, ok := cfg.GetParameter(metrics.IntKeyValue(1)); !ok || value != metrics.IntKeyValue(5) {
+  t.Errorf("Expected the write to be forwarded to the replacement, received: %v\n", value)
+ }
+ cfg.SetParameter(metrics.IntKeyValue(1), metrics.IntKeyValue(6))
+ if value, ok := cfg.GetParameter(metrics.IntKeyValue(0)); !ok || value != metrics.IntKeyValue(6) {
+  t.Errorf("Expected the read to be forwarded to the replacement, received: %v\n", value)
+ }
+ if len(prevs) != 2 {
+  t.Errorf("Expected the listener of the deprecated key to observe both writes, received: %v\n", prevs)
+ }
+ if len(logger.messages) != 1 || !strings.Contains(logger.messages[0], "renamed") {
+  t.Errorf("Expected a single deprecation warning, received: %v\n", logger.messages)
+ }
+ if params := cfg.GetParameters(); len(params) != 1 {
+  t.Errorf("Expected only the replacement to be defined, received: %v\n", params)
+ }
+}
+
+func TestStrictRegistry(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ panics := recordPanics(cfg)
+ registry := metadata.NewRegistry()
+ registry.Declare(config.KeyMetadata{Key: metrics.IntKeyValue(0)})
+ cfg.SetKeyRegistry(registry)
+ cfg.SetParameter(metrics.IntKeyValue(1), metrics.IntKeyValue(1))
+ if len(*panics) != 0 {
+  t.Fatalf("Expected undeclared keys to be accepted, received: %v\n", *panics)
+ }
+ registry.SetStrict(true)
+ cfg.SetParameter(metrics.IntKeyValue(0), metrics.IntKeyValue(0))
+ cfg.SetParameter(metrics.IntKeyValue(2), metrics.IntKeyValue(2))
+ var undeclared *metadata.UndeclaredKeyError
+ if len(*panics) != 1 || !errors.As((*panics)[0].(error), &undeclared) || undeclared.Key != metrics.IntKeyValue(2) {
+  t.Errorf("Expected an *metadata.UndeclaredKeyError, received: %v\n", *panics)
+ }
+ if _, ok := cfg.GetParameter(metrics.IntKeyValue(2)); ok {
+  t.Errorf("Expected the undeclared key to be rejected\n")
+ }
+ if len(*panics) != 2 {
+  t.Errorf("Expected reads of the undeclared key to be rejected, received: %v\n", *panics)
+ }
+ if prev := cfg.SetKeyRegistry(nil); prev != registry {
+  t.Errorf("Expected the previous registry to be returned, received: %v\n", prev)
+ }
+ cfg.SetParameter(metrics.IntKeyValue(2), metrics.IntKeyValue(2))
+ if len(*panics) != 2 {
+  t.Errorf("Expected every key to be accepted without a registry, received: %v\n", *panics)
+ }
+}
+
+func TestRegistryEnvironments(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndLayeredConfig()
+ panics := recordPanics(cfg)
+ registry := metadata.NewRegistry()
+ registry.Declare(config.KeyMetadata{Key: metrics.IntKeyValue(0), Environments: []string{"staging"}})
+ cfg.SetKeyRegistry(registry)
+ registry.SetEnvironment("staging")
+ cfg.Layer(config.LAYER_DEFAULTS).SetParameter(metrics.IntKeyValue(0), metrics.IntKeyValue(0))
+ registry.SetEnvironment("production")
+ cfg.GetParameter(metrics.IntKeyValue(0))
+ var environment *metadata.EnvironmentError
+ if len(*panics) != 1 || !errors.As((*panics)[0].(error), &environment) || environment.Environment != "production" {
+  t.Errorf("Expected an *metadata.EnvironmentError, received: %v\n", *panics)
+ }
+}
+
+func TestRegistryDefaultsAndCycles(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndLayeredConfig()
+ registry := metadata.NewRegistry()
+ registry.SetLogger(nil)
+ registry.Declare(config.KeyMetadata{Key: metrics.IntKeyValue(0), Default: metrics.IntKeyValue(10), Owner: "storage"})
+ registry.Declare(config.KeyMetadata{Key: metrics.IntKeyValue(1), Default: metrics.IntKeyValue(11), ReplacedBy: metrics.IntKeyValue(2)})
+ registry.Declare(config.KeyMetadata{Key: metrics.IntKeyValue(2), ReplacedBy: metrics.IntKeyValue(1)})
+ if err := sources.Apply(cfg.Layer(config.LAYER_DEFAULTS), registry); err != nil {
+  t.Fatalf("Failed to apply defaults: %s\n", err.Error())
+ }
+ if params := cfg.GetParameters(); len(params) != 1 || params[metrics.IntKeyValue(0)] != metrics.IntKeyValue(10) {
+  t.Errorf("Expected only the default of the current key, received: %v\n", params)
+ }
+ if declared, ok := registry.Lookup(metrics.IntKeyValue(0)); !ok || declared.Owner != "storage" {
+  t.Errorf("Unexpected metadata: %v\n", declared)
+ }
+ var cycle *metadata.ReplacementCycleError
+ if _, err := registry.Resolve(metrics.IntKeyValue(1)); !errors.As(err, &cycle) {
+  t.Errorf("Expected a *metadata.ReplacementCycleError, received: %v\n", err)
+ }
+ func() {
+  defer metrics.CatchExpectedPanic(t)
+  registry.Declare(config.KeyMetadata{Key: metrics.IntKeyValue(0)})
+ }()
+}
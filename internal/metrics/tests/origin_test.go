@@ -0,0 +1,119 @@
+package tests
+
+import (
+ "testing"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+ "github.com/Matthewacon/go-figure/sources"
+)
+
+func TestWriteOriginReachesListeners(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, async := metrics.DefaultEnvAndAsynchronousConfig()
+ for _, cfg := range []config.IConfigBus{metrics.DefaultEnvAndConfig().GetConfig(), async} {
+  key := metrics.IntKeyValue(0)
+  origins := []*config.WriteOrigin{}
+  cfg.AddParameterListener(key, config.PARAMETER_ACCESS_ANY, func(context config.IListenerContext, _ config.IParameterValue) error {
+   origins = append(origins, context.Origin())
+   return nil
+  })
+  admin := config.WriteOrigin{Component: "admin", Reason: "raise the limit", RequestID: "42"}
+  cfg.WithOrigin(admin).SetParameter(key, metrics.IntKeyValue(1))
+  cfg.SetParameter(key, metrics.IntKeyValue(2))
+  cfg.GetParameter(key)
+  if async, ok := cfg.(config.IAsynchronousConfigBus); ok {
+   async.Drain()
+  }
+  if len(origins) != 3 || origins[0] == nil || *origins[0] != admin || origins[1] != nil || origins[2] != nil {
+   t.Errorf("Expected the origin of the first write only, received: %v\n", origins)
+  }
+ }
+}
+
+func TestWriteOriginOfTransactions(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ a, b, c := metrics.IntKeyValue(0), metrics.IntKeyValue(1), metrics.IntKeyValue(2)
+ cfg.SetParameter(c, metrics.IntKeyValue(1))
+ deploy := config.WriteOrigin{Component: "deploy"}
+ tx := cfg.WithOrigin(deploy).Begin()
+ tx.SetParameter(a, metrics.IntKeyValue(1))
+ tx.SetOrigin(&config.WriteOrigin{Reason: "cleanup"})
+ tx.SetParameter(b, metrics.IntKeyValue(1))
+ tx.RemoveParameter(c)
+ if err := tx.Commit(); err != nil {
+  t.Fatalf("Failed to commit: %s\n", err.Error())
+ }
+ if origin := cfg.Explain(a).Change.Origin; origin == nil || *origin != deploy {
+  t.Errorf("Expected the origin of the view, received: %v\n", origin)
+ }
+ explanation := cfg.Explain(c)
+ if explanation.Defined || explanation.Change == nil || explanation.Change.Origin.Reason != "cleanup" {
+  t.Errorf("Expected the removal and its origin to be explained, received: %s\n", explanation.String())
+ }
+ if value, ok := cfg.WithOrigin(deploy).RemoveParameter(b); !ok || value != metrics.IntKeyValue(1) {
+  t.Errorf("Expected the removed value, received: %v\n", value)
+ }
+}
+
+func TestExplain(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ key, other := metrics.IntKeyValue(0), metrics.IntKeyValue(1)
+ reads := record(cfg, config.PARAMETER_ACCESS_ANY, key)
+ if explanation := cfg.Explain(key); explanation.Defined || explanation.Change != nil {
+  t.Errorf("Expected an unwritten parameter, received: %s\n", explanation.String())
+ }
+ cfg.AddParameterListener(key, config.PARAMETER_ACCESS_WRITE, func(context config.IListenerContext, _ config.IParameterValue) error {
+  context.Config().SetParameter(other, metrics.IntKeyValue(1))
+  return nil
+ })
+ cfg.WithOrigin(config.WriteOrigin{Component: "admin"}).SetParameter(key, metrics.IntKeyValue(64))
+ explanation := cfg.Explain(key)
+ if !explanation.Defined || explanation.Value != metrics.IntKeyValue(64) || explanation.Change.Origin.Component != "admin" {
+  t.Errorf("Expected the value and origin of the last write, received: %s\n", explanation.String())
+ }
+ if explanation.Change.Time.IsZero() || explanation.Change.Listener != nil {
+  t.Errorf("Expected the time of a write made outside of any listener, received: %v\n", explanation.Change)
+ }
+ if change := cfg.Explain(other).Change; change == nil || change.Listener == nil || change.Origin != nil {
+  t.Errorf("Expected the listener to be explained as the writer, received: %v\n", change)
+ }
+ if reads.count(nil, config.PARAMETER_ACCESS_READ) != 0 {
+  t.Errorf("Expected explanations to raise no READ events, received: %d\n", reads.count(nil, config.PARAMETER_ACCESS_READ))
+ }
+}
+
+func TestExplainPlainWrite(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ key := metrics.IntKeyValue(0)
+ cfg.WithOrigin(config.WriteOrigin{Component: "admin"}).SetParameter(key, metrics.IntKeyValue(1))
+ //a write without an origin is still explained, it just has no origin to report
+ cfg.SetParameter(key, metrics.IntKeyValue(2))
+ explanation := cfg.Explain(key)
+ change := explanation.Change
+ if change == nil || change.Value != metrics.IntKeyValue(2) || change.Origin != nil || change.Time.IsZero() {
+  t.Errorf("Expected the time of the plain write without an origin, received: %s\n", explanation.String())
+ }
+ allocs := testing.AllocsPerRun(100, func() {
+  cfg.SetParameter(key, metrics.IntKeyValue(3))
+ })
+ if allocs != 0 {
+  t.Errorf("Expected plain writes without listeners not to allocate, received: %v allocations\n", allocs)
+ }
+}
+
+func TestApplyAttachesSource(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ src := sources.NewEnvironmentSource("MYAPP", newIntRegistry("sql.max_connections"))
+ src.Environ = environ("MYAPP_SQL_MAX_CONNECTIONS=32")
+ if err := sources.Apply(cfg, src); err != nil {
+  t.Fatalf("Failed to apply environment: %s\n", err.Error())
+ }
+ if change := cfg.Explain(metrics.IntKeyValue(0)).Change; change == nil || change.Origin.Source != src.String() {
+  t.Errorf("Expected the source as the origin, received: %v\n", change)
+ }
+}
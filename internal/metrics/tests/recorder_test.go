@@ -0,0 +1,84 @@
+package tests
+
+import (
+ "sync"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//A notification received by a recorded listener
+type notification struct {
+ config.ParameterEvent
+ changes config.ChangeSet
+ //the value of the observed key, read through the listener's config when it was notified, see recordObserving
+ observed config.IParameterValue
+}
+
+//Records the notifications of listeners, guarded for buses and watchers that notify on their own goroutines
+type recorder struct {
+ mutex         sync.Mutex
+ notifications []notification
+ observe       config.IParameterKey
+}
+
+//Records the notifications of listeners of the keys
+func record(cfg config.IConfigBus, access config.ParameterAccess, keys ...config.IParameterKey) *recorder {
+ recorder := &recorder{}
+ for _, key := range keys {
+  cfg.AddParameterListener(key, access, recorder.listener)
+ }
+ return recorder
+}
+
+//Records the notifications of a group listener
+func recordGroup(cfg config.IConfigBus, matcher config.IKeyMatcher, access config.ParameterAccess) *recorder {
+ recorder := &recorder{}
+ cfg.AddGroupListener(matcher, access, recorder.listener)
+ return recorder
+}
+
+//Like record, and reads the other key through the listener's config on every notification
+func recordObserving(cfg config.IConfigBus, access config.ParameterAccess, key, other config.IParameterKey) *recorder {
+ recorder := &recorder{observe: other}
+ cfg.AddParameterListener(key, access, recorder.listener)
+ return recorder
+}
+
+func (recorder *recorder) listener(context config.IListenerContext, _ config.IParameterValue) error {
+ received := notification{ParameterEvent: context.Event(), changes: context.Changes()}
+ if recorder.observe != nil {
+  received.observed, _ = context.Config().GetParameter(recorder.observe)
+ }
+ recorder.mutex.Lock()
+ defer recorder.mutex.Unlock()
+ recorder.notifications = append(recorder.notifications, received)
+ return nil
+}
+
+//Returns the notifications received so far, oldest first
+func (recorder *recorder) received() []notification {
+ recorder.mutex.Lock()
+ defer recorder.mutex.Unlock()
+ return append([]notification(nil), recorder.notifications...)
+}
+
+//Counts the notifications of the key, or of any key if key is nil, for any of the access types
+func (recorder *recorder) count(key config.IParameterKey, access config.ParameterAccess) int {
+ count := 0
+ for _, received := range recorder.received() {
+  if (key == nil || received.Key == key) && received.Access & access != 0 {
+   count++
+  }
+ }
+ return count
+}
+
+//Returns the names of the keys of the notifications received so far
+func (recorder *recorder) keys() []string {
+ received := recorder.received()
+ keys := make([]string, len(received))
+ for i, notification := range received {
+  keys[i] = notification.Key.String()
+ }
+ return keys
+}
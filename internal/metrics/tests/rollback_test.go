@@ -0,0 +1,136 @@
+package tests
+
+import (
+ "errors"
+ "fmt"
+ "testing"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+)
+
+func addFailingListener(cfg config.IConfigBus, key config.IParameterKey) {
+ cfg.AddParameterListener(key, config.PARAMETER_ACCESS_WRITE, func(config.IListenerContext, config.IParameterValue) error {
+  return fmt.Errorf("Rejected!\n")
+ })
+}
+
+func TestRollbackOnListenerError(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ errs := collectListenerErrors(cfg)
+ key := metrics.IntKeyValue(0)
+ cfg.SetParameter(key, metrics.IntKeyValue(1))
+ cfg.SetKeyListenerErrorPolicy(key, config.LISTENER_ERROR_ROLLBACK)
+ events := record(cfg, config.PARAMETER_ACCESS_WRITE, key)
+ addFailingListener(cfg, key)
+ err := cfg.TrySetParameter(key, metrics.IntKeyValue(2))
+ var rollback *config.RollbackError
+ if !errors.As(err, &rollback) || rollback.Key != key || len(rollback.Reverted) != 1 {
+  t.Fatalf("Expected a *config.RollbackError, received: %v\n", err)
+ }
+ if value, _ := cfg.GetParameter(key); value != metrics.IntKeyValue(1) {
+  t.Errorf("Expected the write to be reverted, received: %v\n", value)
+ }
+ expected := [][2]config.IParameterValue{
+  {metrics.IntKeyValue(1), metrics.IntKeyValue(2)},
+  {metrics.IntKeyValue(2), metrics.IntKeyValue(1)},
+ }
+ observed := [][2]config.IParameterValue{}
+ for _, received := range events.received() {
+  observed = append(observed, [2]config.IParameterValue{received.Prev, received.Value})
+ }
+ if fmt.Sprint(observed) != fmt.Sprint(expected) {
+  t.Errorf("Expected the notified listener to observe the revert, received: %v\n", observed)
+ }
+ if len(*errs) != 0 {
+  t.Errorf("Expected the error to be returned rather than reported, received: %v\n", *errs)
+ }
+ panics := recordPanics(cfg)
+ cfg.SetParameter(key, metrics.IntKeyValue(3))
+ if len(*panics) != 1 || !errors.As((*panics)[0].(error), &rollback) {
+  t.Errorf("Expected SetParameter to panic with the rollback, received: %v\n", *panics)
+ }
+ cfg.SetKeyListenerErrorPolicy(key, config.LISTENER_ERROR_INHERIT)
+ if err := cfg.TrySetParameter(key, metrics.IntKeyValue(4)); err != nil || len(*errs) != 1 {
+  t.Errorf("Expected the error to be reported under the default policy, received: %v, %v\n", err, *errs)
+ }
+ if value, _ := cfg.GetParameter(key); value != metrics.IntKeyValue(4) {
+  t.Errorf("Expected the write to stay in place, received: %v\n", value)
+ }
+}
+
+func TestRollbackOfMultiKeyWrite(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ cfg.SetListenerErrorPolicy(config.LISTENER_ERROR_ROLLBACK)
+ host, port := metrics.IntKeyValue(0), metrics.IntKeyValue(1)
+ cfg.SetParameter(host, metrics.IntKeyValue(1))
+ hostEvents := record(cfg, config.PARAMETER_ACCESS_WRITE, host)
+ addFailingListener(cfg, port)
+ portEvents := record(cfg, config.PARAMETER_ACCESS_WRITE, port)
+ tx := cfg.Begin()
+ tx.SetParameter(host, metrics.IntKeyValue(2))
+ tx.SetParameter(port, metrics.IntKeyValue(2))
+ var rollback *config.RollbackError
+ if err := tx.Commit(); !errors.As(err, &rollback) || rollback.Key != port || len(rollback.Reverted) != 2 {
+  t.Fatalf("Expected a *config.RollbackError, received: %v\n", err)
+ }
+ if params := cfg.GetParameters(); len(params) != 1 || params[host] != metrics.IntKeyValue(1) {
+  t.Errorf("Expected the whole commit to be reverted, received: %v\n", params)
+ }
+ if received := hostEvents.received(); len(received) != 2 || received[1].Value != metrics.IntKeyValue(1) {
+  t.Errorf("Expected the host listener to observe the revert, received: %v\n", received)
+ }
+ if received := portEvents.received(); len(received) != 0 {
+  t.Errorf("Expected listeners after the failing listener to never be notified, received: %v\n", received)
+ }
+}
+
+func TestRollbackKeepsNewerWrites(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ cfg.SetListenerErrorPolicy(config.LISTENER_ERROR_ROLLBACK)
+ key := metrics.IntKeyValue(0)
+ cfg.AddParameterListener(key, config.PARAMETER_ACCESS_WRITE, func(context config.IListenerContext, _ config.IParameterValue) error {
+  if value, _ := context.Value(); value == metrics.IntKeyValue(1) {
+   context.SetValue(metrics.IntKeyValue(2))
+  }
+  return nil
+ })
+ cfg.AddParameterListener(key, config.PARAMETER_ACCESS_WRITE, func(context config.IListenerContext, _ config.IParameterValue) error {
+  if context.Changes()[0].Value == metrics.IntKeyValue(1) {
+   return fmt.Errorf("Rejected!\n")
+  }
+  return nil
+ })
+ if err := cfg.TrySetParameter(key, metrics.IntKeyValue(1)); err == nil {
+  t.Fatalf("Expected the write to be rejected\n")
+ }
+ if value, _ := cfg.GetParameter(key); value != metrics.IntKeyValue(2) {
+  t.Errorf("Expected the newer write to be kept, received: %v\n", value)
+ }
+}
+
+func TestAsynchronousRollback(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ defer cfg.Close()
+ errs := collectListenerErrors(cfg)
+ key := metrics.IntKeyValue(0)
+ cfg.SetKeyListenerErrorPolicy(key, config.LISTENER_ERROR_ROLLBACK)
+ events := record(cfg, config.PARAMETER_ACCESS_WRITE, key)
+ addFailingListener(cfg, key)
+ cfg.SetParameter(key, metrics.IntKeyValue(1))
+ cfg.Drain()
+ if _, ok := cfg.GetParameter(key); ok {
+  t.Errorf("Expected the write to be reverted\n")
+ }
+ var rollback *config.RollbackError
+ if len(*errs) != 1 || !errors.As((*errs)[0], &rollback) {
+  t.Errorf("Expected the rollback to be reported, received: %v\n", *errs)
+ }
+ if received := events.received(); len(received) != 2 || received[1].Prev != metrics.IntKeyValue(1) {
+  t.Errorf("Expected the notified listener to observe the revert, received: %v\n", received)
+ }
+}
@@ -0,0 +1,152 @@
+//go:build !windows
+// +build !windows
+
+package tests
+
+import (
+ "errors"
+ "os"
+ "path/filepath"
+ "sync/atomic"
+ "syscall"
+ "testing"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+ "github.com/Matthewacon/go-figure/sources"
+ "github.com/Matthewacon/go-figure/watch"
+)
+
+func TestSignalReloader(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ dir := tempDir(t)
+ defer os.RemoveAll(dir)
+ path := filepath.Join(dir, "config.toml")
+ writeFile(t, path, "[sql]\nmax_connections = 32\n")
+ registry := newIntRegistry("sql.max_connections", "sql.timeout")
+ env := metrics.DefaultEnvAndConfig()
+ file, _ := sources.NewFileSource(path, registry)
+ environment := sources.NewEnvironmentSource("MYAPP", registry)
+ //the environment is read on the reloader's goroutine
+ timeout := atomic.Value{}
+ timeout.Store("5")
+ environment.Environ = func() []string {
+  return []string{"MYAPP_SQL_TIMEOUT=" + timeout.Load().(string)}
+ }
+ reloader := watch.NewSignalReloader(env, file, environment)
+ results := make(chan error, 1)
+ reloader.Handler = func(err error) {
+  results <- err
+ }
+ reloader.Start()
+ defer reloader.Stop()
+ hangup := func() error {
+  if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+   t.Fatalf("Failed to send SIGHUP: %s\n", err.Error())
+  }
+  select {
+  case err := <-results:
+   return err
+  case <-time.After(watchTimeout):
+   t.Fatalf("Timed out waiting for a reload!\n")
+  }
+  return nil
+ }
+ if err := hangup(); err != nil {
+  t.Errorf("Reload failed: %s\n", err.Error())
+ }
+ cfg := env.GetConfig()
+ if value, _ := cfg.GetParameter(metrics.IntKeyValue(0)); value != metrics.IntKeyValue(32) {
+  t.Errorf("File was not applied, received: %v\n", value)
+ }
+ if value, _ := cfg.GetParameter(metrics.IntKeyValue(1)); value != metrics.IntKeyValue(5) {
+  t.Errorf("Environment was not applied, received: %v\n", value)
+ }
+ //every parameter is attributed to the source that defined it
+ if change := cfg.Explain(metrics.IntKeyValue(0)).Change; change == nil || change.Origin.Source != file.String() {
+  t.Errorf("Expected the file as the origin, received: %v\n", change)
+ }
+ if change := cfg.Explain(metrics.IntKeyValue(1)).Change; change == nil || change.Origin.Source != environment.String() {
+  t.Errorf("Expected the environment as the origin, received: %v\n", change)
+ }
+ //a failing source leaves the bus untouched, even if the other sources loaded
+ writeFile(t, path, "[sql]\nmax_connections = 64\n")
+ timeout.Store("soon")
+ var decodeErr *sources.DecodeError
+ if err := hangup(); !errors.As(err, &decodeErr) {
+  t.Errorf("Expected a *sources.DecodeError, received: %v\n", err)
+ }
+ if value, _ := cfg.GetParameter(metrics.IntKeyValue(0)); value != metrics.IntKeyValue(32) {
+  t.Errorf("Failed reload modified the bus: %v\n", value)
+ }
+ if reloader.Reloads() != 1 || reloader.Failures() != 1 {
+  t.Errorf("Expected 1 reload and 1 failure, received: %d and %d\n", reloader.Reloads(), reloader.Failures())
+ }
+ reloader.Stop()
+ //stopping twice is harmless
+ reloader.Stop()
+}
+
+func TestSignalReloaderRemovedVariables(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ registry := newIntRegistry("sql.max_connections", "sql.timeout")
+ env := metrics.DefaultEnvAndConfig()
+ environment := sources.NewEnvironmentSource("MYAPP", registry)
+ variables := atomic.Value{}
+ variables.Store([]string{"MYAPP_SQL_MAX_CONNECTIONS=32", "MYAPP_SQL_TIMEOUT=5"})
+ environment.Environ = func() []string {
+  return variables.Load().([]string)
+ }
+ reloader := watch.NewSignalReloader(env, environment)
+ results := make(chan error, 1)
+ var stopInHandler int32
+ reloader.Handler = func(err error) {
+  //stopping from the handler must not wait for the handler
+  if atomic.LoadInt32(&stopInHandler) != 0 {
+   reloader.Stop()
+  }
+  results <- err
+ }
+ reloader.Start()
+ defer reloader.Stop()
+ hangup := func() error {
+  if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+   t.Fatalf("Failed to send SIGHUP: %s\n", err.Error())
+  }
+  select {
+  case err := <-results:
+   return err
+  case <-time.After(watchTimeout):
+   t.Fatalf("Timed out waiting for a reload!\n")
+  }
+  return nil
+ }
+ if err := hangup(); err != nil {
+  t.Fatalf("Reload failed: %s\n", err.Error())
+ }
+ cfg := env.GetConfig()
+ var changes config.ChangeSet
+ cfg.AddParameterListener(
+  metrics.IntKeyValue(1),
+  config.PARAMETER_ACCESS_DELETE,
+  func(context config.IListenerContext, prev config.IParameterValue) error {
+   changes = context.Changes()
+   return nil
+  },
+ )
+ variables.Store([]string{"MYAPP_SQL_MAX_CONNECTIONS=64"})
+ atomic.StoreInt32(&stopInHandler, 1)
+ if err := hangup(); err != nil {
+  t.Fatalf("Reload failed: %s\n", err.Error())
+ }
+ if _, ok := cfg.GetParameter(metrics.IntKeyValue(1)); ok {
+  t.Errorf("Removed variable is still defined!\n")
+ }
+ if value, _ := cfg.GetParameter(metrics.IntKeyValue(0)); value != metrics.IntKeyValue(64) {
+  t.Errorf("Changed variable was not applied, received: %v\n", value)
+ }
+ if len(changes) != 2 {
+  t.Errorf("Expected the removal to be applied with the update, received: %v\n", changes)
+ }
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+ "testing"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+)
+
+func TestSnapshotAndRestore(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ a, b, c := metrics.IntKeyValue(0), metrics.IntKeyValue(1), metrics.IntKeyValue(2)
+ cfg.SetParameters(config.Parameters{a: metrics.IntKeyValue(1), b: metrics.IntKeyValue(1)})
+ reads := record(cfg, config.PARAMETER_ACCESS_READ, a, b, c)
+ snapshot := cfg.Snapshot()
+ if count := reads.count(nil, config.PARAMETER_ACCESS_READ); count != 0 {
+  t.Errorf("Expected snapshots to raise no READ events, received: %d\n", count)
+ }
+ cfg.SetParameter(b, metrics.IntKeyValue(2))
+ cfg.SetParameter(c, metrics.IntKeyValue(2))
+ if value, _ := snapshot.GetParameter(b); snapshot.Len() != 2 || value != metrics.IntKeyValue(1) {
+  t.Errorf("Expected the snapshot to be unaffected by later writes, received: %v\n", snapshot.GetParameters())
+ }
+ writes := record(cfg, config.PARAMETER_ACCESS_WRITE, a, b, c)
+ if err := cfg.Restore(snapshot); err != nil {
+  t.Fatalf("Failed to restore: %s\n", err.Error())
+ }
+ if writes.count(a, config.PARAMETER_ACCESS_WRITE) != 0 ||
+  writes.count(b, config.PARAMETER_ACCESS_WRITE) != 1 ||
+  writes.count(c, config.PARAMETER_ACCESS_WRITE) != 1 {
+  t.Errorf("Expected WRITE events for the keys that differ only, received: %v\n", writes.received())
+ }
+ if params := cfg.GetParameters(); len(params) != 2 || params[b] != metrics.IntKeyValue(1) {
+  t.Errorf("Expected the parameters of the snapshot, received: %v\n", params)
+ }
+}
+
+func TestRestoreLayers(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndLayeredConfig()
+ key := metrics.IntKeyValue(0)
+ defaults, overrides := cfg.Layer(config.LAYER_DEFAULTS), cfg.Layer(config.LAYER_OVERRIDES)
+ defaults.SetParameter(key, metrics.IntKeyValue(1))
+ snapshot := cfg.Snapshot()
+ defaults.SetParameter(key, metrics.IntKeyValue(2))
+ overrides.SetParameter(key, metrics.IntKeyValue(3))
+ events := record(cfg, config.PARAMETER_ACCESS_WRITE, key)
+ if err := cfg.Restore(snapshot); err != nil {
+  t.Fatalf("Failed to restore: %s\n", err.Error())
+ }
+ if value, _ := defaults.GetParameter(key); value != metrics.IntKeyValue(1) {
+  t.Errorf("Expected the defaults to be restored, received: %v\n", value)
+ }
+ if _, ok := overrides.GetParameter(key); ok {
+  t.Errorf("Expected the override to be removed\n")
+ }
+ if received := events.received(); len(received) != 1 || received[0].Prev != metrics.IntKeyValue(3) || received[0].Value != metrics.IntKeyValue(1) {
+  t.Errorf("Expected a single WRITE event, received: %v\n", received)
+ }
+}
+
+//Snapshots taken and restored through a listener context capture the layers like the bus does
+func TestRestoreLayersFromListener(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndLayeredConfig()
+ key, trigger := metrics.IntKeyValue(0), metrics.IntKeyValue(1)
+ defaults, overrides := cfg.Layer(config.LAYER_DEFAULTS), cfg.Layer(config.LAYER_OVERRIDES)
+ defaults.SetParameter(key, metrics.IntKeyValue(1))
+ var snapshot config.Snapshot
+ taken := false
+ cfg.AddParameterListener(trigger, config.PARAMETER_ACCESS_WRITE, func(context config.IListenerContext, _ config.IParameterValue) error {
+  if !taken {
+   snapshot, taken = context.Config().Snapshot(), true
+   return nil
+  }
+  return context.Config().Restore(snapshot)
+ })
+ cfg.SetParameter(trigger, trigger)
+ if _, ok := snapshot.Layer(config.LAYER_DEFAULTS); !ok {
+  t.Fatalf("Snapshot taken by a listener is missing the layers\n")
+ }
+ defaults.SetParameter(key, metrics.IntKeyValue(2))
+ overrides.SetParameter(key, metrics.IntKeyValue(3))
+ cfg.SetParameter(trigger, metrics.IntKeyValue(2))
+ if value, _ := defaults.GetParameter(key); value != metrics.IntKeyValue(1) {
+  t.Errorf("Expected the defaults to be restored, received: %v\n", value)
+ }
+ if _, ok := overrides.GetParameter(key); ok {
+  t.Errorf("Expected the override to be removed\n")
+ }
+}
+
+func TestAsynchronousSnapshot(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ defer cfg.Close()
+ key := metrics.IntKeyValue(0)
+ snapshot := cfg.Snapshot()
+ cfg.SetParameter(key, metrics.IntKeyValue(1))
+ if err := cfg.Restore(snapshot); err != nil {
+  t.Fatalf("Failed to restore: %s\n", err.Error())
+ }
+ if params := cfg.GetParameters(); len(params) != 0 {
+  t.Errorf("Expected the empty snapshot to be restored, received: %v\n", params)
+ }
+}
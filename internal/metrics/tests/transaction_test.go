@@ -0,0 +1,118 @@
+package tests
+
+import (
+ "errors"
+ "testing"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+ "github.com/Matthewacon/go-figure/validate"
+)
+
+func TestSetParametersIsAtomic(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ host, port := metrics.IntKeyValue(0), metrics.IntKeyValue(1)
+ cfg.SetParameters(config.Parameters{host: metrics.IntKeyValue(1), port: metrics.IntKeyValue(1)})
+ hostWrites := recordObserving(cfg, config.PARAMETER_ACCESS_WRITE, host, port)
+ portWrites := recordObserving(cfg, config.PARAMETER_ACCESS_WRITE, port, host)
+ cfg.SetParameters(config.Parameters{host: metrics.IntKeyValue(2), port: metrics.IntKeyValue(3)})
+ if received := hostWrites.received(); len(received) != 1 || received[0].observed != metrics.IntKeyValue(3) {
+  t.Errorf("Expected the host listener to observe the new port, received: %v\n", received)
+ }
+ if received := portWrites.received(); len(received) != 1 || received[0].observed != metrics.IntKeyValue(2) {
+  t.Errorf("Expected the port listener to observe the new host, received: %v\n", received)
+ }
+ changes := hostWrites.received()[0].changes
+ expected := config.ChangeSet{
+  {Key: host, Prev: metrics.IntKeyValue(1), Value: metrics.IntKeyValue(2), Kind: config.CHANGE_UPDATE},
+  {Key: port, Prev: metrics.IntKeyValue(1), Value: metrics.IntKeyValue(3), Kind: config.CHANGE_UPDATE},
+ }
+ if len(changes) != len(expected) {
+  t.Fatalf("Expected the change set %v, received: %v\n", expected, changes)
+ }
+ for i, change := range changes {
+  //changes stored together share their time, but not their sequence number
+  if change.Time != changes[0].Time || change.Sequence != changes[0].Sequence + uint64(i) {
+   t.Errorf("Expected consecutive changes stored at the same time, received: %v\n", changes)
+  }
+  change.Sequence, change.Time = 0, time.Time{}
+  if change != expected[i] {
+   t.Errorf("Expected the change set %v, received: %v\n", expected, changes)
+  }
+ }
+}
+
+func TestTransactionCommit(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ host, port := metrics.IntKeyValue(0), metrics.IntKeyValue(1)
+ cfg.SetParameter(port, metrics.IntKeyValue(1))
+ hostWrites := recordObserving(cfg, config.PARAMETER_ACCESS_WRITE, host, port)
+ tx := cfg.Begin()
+ tx.SetParameter(host, metrics.IntKeyValue(1))
+ tx.SetParameter(host, metrics.IntKeyValue(2))
+ tx.RemoveParameter(port)
+ if _, ok := cfg.GetParameter(host); ok || len(hostWrites.received()) != 0 {
+  t.Fatalf("Expected staged writes to be invisible until committed\n")
+ }
+ if err := tx.Commit(); err != nil {
+  t.Fatalf("Failed to commit: %s\n", err.Error())
+ }
+ if params := cfg.GetParameters(); len(params) != 1 || params[host] != metrics.IntKeyValue(2) {
+  t.Errorf("Expected only the latest staged write of the host, received: %v\n", params)
+ }
+ if received := hostWrites.received(); len(received) != 1 || received[0].observed != nil || len(received[0].changes) != 2 {
+  t.Errorf("Expected a single event observing the removed port, received: %v\n", received)
+ }
+ func() {
+  defer metrics.CatchExpectedPanic(t)
+  tx.SetParameter(host, metrics.IntKeyValue(3))
+ }()
+}
+
+func TestTransactionRejectedOrRolledBack(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ cfg.AddParameterValidator(metrics.IntKeyValue(1), validate.Min(0))
+ tx := cfg.Begin()
+ tx.SetParameters(config.Parameters{metrics.IntKeyValue(0): metrics.IntKeyValue(0), metrics.IntKeyValue(1): metrics.IntKeyValue(-1)})
+ var validation config.ValidationErrors
+ if err := tx.Commit(); !errors.As(err, &validation) || len(validation) != 1 {
+  t.Errorf("Expected the commit to be rejected, received: %v\n", err)
+ }
+ tx = cfg.Begin()
+ tx.SetParameter(metrics.IntKeyValue(0), metrics.IntKeyValue(0))
+ tx.Rollback()
+ if params := cfg.GetParameters(); len(params) != 0 {
+  t.Errorf("Expected nothing to be stored, received: %v\n", params)
+ }
+ func() {
+  defer metrics.CatchExpectedPanic(t)
+  tx.Commit()
+ }()
+}
+
+func TestTransactionsOnEveryBus(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ host, port := metrics.IntKeyValue(0), metrics.IntKeyValue(1)
+ _, async := metrics.DefaultEnvAndAsynchronousConfig()
+ defer async.Close()
+ asyncWrites := recordObserving(async, config.PARAMETER_ACCESS_WRITE, host, port)
+ tx := async.Begin()
+ tx.SetParameters(config.Parameters{host: metrics.IntKeyValue(1), port: metrics.IntKeyValue(2)})
+ if err := tx.Commit(); err != nil {
+  t.Fatalf("Failed to commit: %s\n", err.Error())
+ }
+ async.Drain()
+ if received := asyncWrites.received(); len(received) != 1 || received[0].observed != metrics.IntKeyValue(2) || len(received[0].changes) != 2 {
+  t.Errorf("Expected the asynchronous listener to observe the whole commit, received: %v\n", received)
+ }
+ _, layered := metrics.DefaultEnvAndLayeredConfig()
+ layeredWrites := recordObserving(layered, config.PARAMETER_ACCESS_WRITE, host, port)
+ layered.Layer(config.LAYER_FILE).SetParameters(config.Parameters{host: metrics.IntKeyValue(1), port: metrics.IntKeyValue(2)})
+ if received := layeredWrites.received(); len(received) != 1 || received[0].observed != metrics.IntKeyValue(2) {
+  t.Errorf("Expected writes to layers to be atomic, received: %v\n", received)
+ }
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+ "errors"
+ "testing"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+ "github.com/Matthewacon/go-figure/keys"
+ "github.com/Matthewacon/go-figure/values"
+)
+
+func TestTypedKeyGetAndSet(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ timeout := keys.NewDurationKey("sql.timeout")
+ var missing *keys.MissingParameterError
+ if _, err := timeout.Get(cfg); !errors.As(err, &missing) {
+  t.Errorf("Expected a *keys.MissingParameterError, received: %v\n", err)
+ }
+ if value, err := timeout.GetOr(cfg, time.Second); err != nil || value != time.Second {
+  t.Errorf("Expected the fallback value, received: %v, %v\n", value, err)
+ }
+ timeout.Set(cfg, time.Minute)
+ if value, err := timeout.Get(cfg); err != nil || value != time.Minute {
+  t.Errorf("Expected '1m0s', received: %v, %v\n", value, err)
+ }
+ if value, _ := cfg.GetParameter(timeout); value != values.Duration(time.Minute) {
+  t.Errorf("Expected the bus to hold a values.Duration, received: %#v\n", value)
+ }
+}
+
+func TestTypedKeyTypeMismatch(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ port := keys.NewIntKey("http.port")
+ cfg.SetParameter(port, values.String("8080"))
+ var mismatch *keys.TypeMismatchError
+ if value, err := port.Get(cfg); !errors.As(err, &mismatch) || value != 0 {
+  t.Fatalf("Expected a *keys.TypeMismatchError, received: %v, %v\n", value, err)
+ }
+ if mismatch.Key != port || mismatch.Value != values.String("8080") {
+  t.Errorf("Unexpected mismatch: %#v\n", mismatch)
+ }
+ if _, err := port.GetOr(cfg, 80); !errors.As(err, &mismatch) {
+  t.Errorf("Expected GetOr to report the mismatch, received: %v\n", err)
+ }
+}
+
+func TestCustomTypedKey(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ key := keys.NewTypedKey("answer", metrics.IntKeyValue(0))
+ key.Set(cfg, metrics.IntKeyValue(42))
+ if value, err := key.Get(cfg); err != nil || value.(metrics.IntKeyValue) != 42 {
+  t.Errorf("Expected '42', received: %v, %v\n", value, err)
+ }
+ func() {
+  defer metrics.CatchExpectedPanic(t)
+  key.Set(cfg, values.Int(42))
+ }()
+}
+
+func TestTypedKeyOnChange(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ var errs []error
+ cfg.SetCallbackErrorHandler(func(_ config.ParameterListener, _ config.ParameterAccess, _ config.IParameterKey, err error) {
+  errs = append(errs, err)
+ })
+ hosts := keys.NewStringListKey("sql.hosts")
+ type change struct{ old, new []string }
+ var changes []change
+ handle := hosts.OnChange(cfg, func(old, new []string) {
+  changes = append(changes, change{old, new})
+ })
+ defer handle.Unsubscribe()
+ hosts.Set(cfg, []string{"a"})
+ hosts.Set(cfg, []string{"a", "b"})
+ cfg.RemoveParameter(hosts)
+ if len(changes) != 3 ||
+  changes[0].old != nil || len(changes[0].new) != 1 ||
+  len(changes[1].old) != 1 || len(changes[1].new) != 2 ||
+  len(changes[2].old) != 2 || changes[2].new != nil {
+  t.Errorf("Unexpected changes: %v\n", changes)
+ }
+ cfg.SetParameter(hosts, values.String("a,b"))
+ var mismatch *keys.TypeMismatchError
+ if len(changes) != 3 || len(errs) != 1 || !errors.As(errs[0], &mismatch) {
+  t.Errorf("Expected the mismatch to be reported to the error handler, received: %v, %v\n", changes, errs)
+ }
+}
+
+//Listeners of an asynchronous bus run after later writes, they must still see the value of their own write
+func TestTypedKeyOnChangeUsesEventValue(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ defer cfg.Close()
+ port := keys.NewIntKey("http.port")
+ reads := record(cfg, config.PARAMETER_ACCESS_ANY, port)
+ var received []int64
+ port.OnChange(cfg, func(old, new int64) {
+  received = append(received, new)
+ })
+ port.Set(cfg, 1)
+ port.Set(cfg, 2)
+ cfg.Drain()
+ if len(received) != 2 || received[0] != 1 || received[1] != 2 {
+  t.Errorf("Expected the values 1 and 2, received: %v\n", received)
+ }
+ if n := reads.count(nil, config.PARAMETER_ACCESS_READ); n != 0 {
+  t.Errorf("OnChange raised %d READ events\n", n)
+ }
+}
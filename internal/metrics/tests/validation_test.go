@@ -0,0 +1,119 @@
+package tests
+
+import (
+ "errors"
+ "regexp"
+ "testing"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+ "github.com/Matthewacon/go-figure/sources"
+ "github.com/Matthewacon/go-figure/validate"
+ "github.com/Matthewacon/go-figure/values"
+)
+
+func TestValidatorVetoesWrite(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ panics := recordPanics(cfg)
+ key := metrics.IntKeyValue(0)
+ cfg.SetParameter(key, metrics.IntKeyValue(4))
+ writes := 0
+ cfg.AddParameterListener(key, config.PARAMETER_ACCESS_WRITE, func(config.IListenerContext, config.IParameterValue) error {
+  writes++
+  return nil
+ })
+ handle := cfg.AddParameterValidator(key, validate.Range(0, 10))
+ err := cfg.TrySetParameter(key, metrics.IntKeyValue(-1))
+ var validation *config.ValidationError
+ if !errors.As(err, &validation) || validation.Key != key || validation.Value != metrics.IntKeyValue(-1) {
+  t.Errorf("Expected a *config.ValidationError, received: %v\n", err)
+ }
+ cfg.SetParameter(key, metrics.IntKeyValue(11))
+ if len(*panics) != 1 || !errors.As((*panics)[0].(error), &validation) {
+  t.Errorf("Expected SetParameter to panic with the rejection, received: %v\n", *panics)
+ }
+ if value, _ := cfg.GetParameter(key); value != metrics.IntKeyValue(4) || writes != 0 {
+  t.Errorf("Expected the bus to be untouched, received: %v after %d writes\n", value, writes)
+ }
+ if err := cfg.TrySetParameter(key, metrics.IntKeyValue(10)); err != nil || writes != 1 {
+  t.Errorf("Expected the value to be accepted, received: %v after %d writes\n", err, writes)
+ }
+ handle.Remove()
+ if err := cfg.TrySetParameter(key, metrics.IntKeyValue(-1)); err != nil {
+  t.Errorf("Expected the removed validator to no longer run, received: %v\n", err)
+ }
+}
+
+func TestValidatorsRejectAllOrNothing(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ cfg.AddParameterValidator(metrics.IntKeyValue(1), validate.OneOf("1", "2"))
+ cfg.AddParameterValidator(metrics.IntKeyValue(2), validate.Min(0))
+ err := cfg.TrySetParameters(config.Parameters{
+  metrics.IntKeyValue(0): metrics.IntKeyValue(0),
+  metrics.IntKeyValue(1): metrics.IntKeyValue(3),
+  metrics.IntKeyValue(2): metrics.IntKeyValue(-1),
+ })
+ var validation config.ValidationErrors
+ if !errors.As(err, &validation) || len(validation) != 2 || validation[0].Key != metrics.IntKeyValue(1) {
+  t.Errorf("Expected both rejections, ordered by key, received: %v\n", err)
+ }
+ if params := cfg.GetParameters(); len(params) != 0 {
+  t.Errorf("Expected nothing to be stored, received: %v\n", params)
+ }
+}
+
+func TestValidatorsOnEveryBus(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ key := metrics.IntKeyValue(0)
+ _, async := metrics.DefaultEnvAndAsynchronousConfig()
+ defer async.Close()
+ async.AddParameterValidator(key, validate.Range(0, 1))
+ if err := async.TrySetParameter(key, metrics.IntKeyValue(2)); err == nil {
+  t.Errorf("Expected the asynchronous bus to reject the value\n")
+ }
+ _, layered := metrics.DefaultEnvAndLayeredConfig()
+ layered.AddParameterValidator(key, validate.Range(0, 1))
+ if err := layered.Layer(config.LAYER_DEFAULTS).TrySetParameter(key, metrics.IntKeyValue(2)); err == nil {
+  t.Errorf("Expected writes to layers to be validated\n")
+ }
+ src := sources.NewEnvironmentSource("MYAPP", newIntRegistry("a"))
+ src.Environ = environ("MYAPP_A=5")
+ err := sources.Apply(layered.Layer(config.LAYER_ENVIRONMENT), src)
+ var validation config.ValidationErrors
+ if !errors.As(err, &validation) {
+  t.Errorf("Expected sources.Apply to report the rejection, received: %v\n", err)
+ }
+ if params := layered.GetParameters(); len(params) != 0 {
+  t.Errorf("Expected nothing to be stored, received: %v\n", params)
+ }
+}
+
+func TestBuiltinValidators(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ key := metrics.IntKeyValue(0)
+ cases := []struct {
+  validator config.ParameterValidator
+  value     config.IParameterValue
+  valid     bool
+ }{
+  {validate.Range(1, 2), values.Float(1.5), true},
+  {validate.Range(1, 2), values.Uint(3), false},
+  {validate.Range(0, float64(time.Second)), values.Duration(time.Minute), false},
+  {validate.Range(0, 1), values.String("0"), false},
+  {validate.Matches(regexp.MustCompile("^[a-z]+$")), values.String("abc"), true},
+  {validate.Matches(regexp.MustCompile("^[a-z]+$")), values.String("ABC"), false},
+  {validate.OneOf("debug", "info"), values.String("info"), true},
+  {validate.OneOf("debug", "info"), nil, false},
+  {validate.NonNil, nil, false},
+  {validate.All(validate.NonNil, validate.Min(0)), values.Int(-1), false},
+  {validate.All(validate.NonNil, validate.Min(0)), values.Int(0), true},
+ }
+ for i, c := range cases {
+  if err := c.validator(key, c.value); (err == nil) != c.valid {
+   t.Errorf("Case %d: expected valid to be %v, received: %v\n", i, c.valid, err)
+  }
+ }
+}
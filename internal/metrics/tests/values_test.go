@@ -0,0 +1,156 @@
+package tests
+
+import (
+ "testing"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+ "github.com/Matthewacon/go-figure/sources"
+ "github.com/Matthewacon/go-figure/values"
+)
+
+type equatable interface {
+ config.IParameterValue
+ Equal(other config.IParameterValue) bool
+}
+
+type parser func(raw string) (config.IParameterValue, error)
+
+//Parses the raw text, checks its canonical form and that the canonical form parses back into an equal value
+func expectCanonical(t *testing.T, parse parser, raw, canonical string) config.IParameterValue {
+ value, err := parse(raw)
+ if err != nil {
+  t.Errorf("Failed to parse '%s': %s\n", raw, err.Error())
+  return nil
+ }
+ if value.String() != canonical {
+  t.Errorf("Expected '%s' to be formatted as '%s', received: '%s'\n", raw, canonical, value.String())
+ }
+ reparsed, err := parse(value.String())
+ if err != nil || !value.(equatable).Equal(reparsed) {
+  t.Errorf("Canonical form '%s' does not parse back into an equal value: %v\n", value.String(), err)
+ }
+ return value
+}
+
+func TestValuesRoundTrip(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cases := []struct {
+  parse          parser
+  raw, canonical string
+ }{
+  {values.ParseString, " padded ", " padded "},
+  {values.ParseBool, "TRUE", "true"},
+  {values.ParseInt, "0x10", "16"},
+  {values.ParseInt, "-42", "-42"},
+  {values.ParseUint, "18446744073709551615", "18446744073709551615"},
+  {values.ParseFloat, "1.50", "1.5"},
+  {values.ParseFloat, "1e21", "1e+21"},
+  {values.ParseDuration, "90s", "1m30s"},
+  {values.ParseTime, "1979-05-27T00:32:00-07:00", "1979-05-27T00:32:00-07:00"},
+  {values.ParseTime, "1979-05-27", "1979-05-27T00:00:00Z"},
+  {values.ParseURL, "https://example.com/a?b=c", "https://example.com/a?b=c"},
+  {values.ParseRegexp, "^a+$", "^a+$"},
+  {values.ParseByteSize, "512 MiB", "512MiB"},
+  {values.ParseByteSize, "1.5kib", "1536B"},
+  {values.ParseByteSize, "5000000", "5MB"},
+  {values.ParseByteSize, "0", "0B"},
+  {values.ParseStringList, " a, b ,c", "a,b,c"},
+  {values.ParseStringList, "", ""},
+  {values.ParseStringMap, "b = 2, a=1", "a=1,b=2"},
+ }
+ for _, c := range cases {
+  expectCanonical(t, c.parse, c.raw, c.canonical)
+ }
+}
+
+//Separators, backslashes and surrounding whitespace inside elements must survive formatting and parsing
+func TestStringListAndMapEscaping(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ for _, value := range []equatable{
+  values.StringList{"a,b", " padded ", `C:\dir\`, "x=y", "\t", ""},
+  values.StringList{" "},
+  values.StringMap{"k=1": "v,2", " key ": ` \ `, "": "="},
+ } {
+  text, err := value.(interface{ MarshalText() ([]byte, error) }).MarshalText()
+  if err != nil || string(text) != value.String() {
+   t.Errorf("Expected MarshalText to return '%s', received: '%s' (%v)\n", value.String(), text, err)
+  }
+  var reparsed config.IParameterValue
+  if _, ok := value.(values.StringList); ok {
+   reparsed, err = values.ParseStringList(value.String())
+  } else {
+   reparsed, err = values.ParseStringMap(value.String())
+  }
+  if err != nil || !value.Equal(reparsed) {
+   t.Errorf("'%s' does not parse back into %q, received: %q (%v)\n", value.String(), value, reparsed, err)
+  }
+ }
+ //backslashes that don't escape anything are kept
+ expectCanonical(t, values.ParseStringList, `C:\dir, b\,c`, `C:\\dir,b\,c`)
+}
+
+func TestValuesParseErrors(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ cases := map[string]parser{
+  "yes please": values.ParseBool,
+  "1.5": values.ParseInt,
+  "-1": values.ParseUint,
+  "soon": values.ParseDuration,
+  "yesterday": values.ParseTime,
+  "/relative/path": values.ParseURL,
+  "(": values.ParseRegexp,
+  "5 parsecs": values.ParseByteSize,
+  "17179869184 PiB": values.ParseByteSize,
+  "a=1,b": values.ParseStringMap,
+ }
+ for raw, parse := range cases {
+  if value, err := parse(raw); err == nil {
+   t.Errorf("Expected '%s' to fail to parse, received: %v\n", raw, value)
+  }
+ }
+}
+
+func TestValuesEquality(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ utc, _ := values.ParseTime("1979-05-27T07:32:00Z")
+ offset, _ := values.ParseTime("1979-05-27T00:32:00-07:00")
+ if !utc.(values.Time).Equal(offset) {
+  t.Errorf("The same instant in different locations is not equal!\n")
+ }
+ if values.Int(1).Equal(values.Uint(1)) || values.String("1").Equal(values.Int(1)) {
+  t.Errorf("Values of different types are equal!\n")
+ }
+ if !(values.StringList{"a", "b"}).Equal(values.StringList{"a", "b"}) || (values.StringList{"a"}).Equal(values.StringList{"b"}) {
+  t.Errorf("Unexpected StringList equality!\n")
+ }
+ if !(values.StringMap{"a": "1"}).Equal(values.StringMap{"a": "1"}) || (values.StringMap{"a": "1"}).Equal(values.StringMap{"a": "2"}) {
+  t.Errorf("Unexpected StringMap equality!\n")
+ }
+ if d, _ := values.ParseDuration("1m"); d.Value() != time.Minute {
+  t.Errorf("Duration does not return a time.Duration: %T\n", d.Value())
+ }
+}
+
+func TestValuesDecodeDocuments(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ registry := sources.NewRegistry()
+ registry.Register("hosts", metrics.IntKeyValue(0), values.DecodeStringList)
+ registry.Register("labels", metrics.IntKeyValue(1), values.DecodeStringMap)
+ registry.Register("limit", metrics.IntKeyValue(2), sources.TextDecoder(values.ParseByteSize))
+ params, err := sources.Decode(sources.YAML, registry, []byte("hosts: [alpha, 2]\nlabels: {tier: web, replicas: 3}\nlimit: 64MiB\n"))
+ if err != nil {
+  t.Errorf("Failed to decode document: %s\n", err.Error())
+  return
+ }
+ if !(values.StringList{"alpha", "2"}).Equal(params[metrics.IntKeyValue(0)]) {
+  t.Errorf("Unexpected list: %v\n", params[metrics.IntKeyValue(0)])
+ }
+ if !(values.StringMap{"tier": "web", "replicas": "3"}).Equal(params[metrics.IntKeyValue(1)]) {
+  t.Errorf("Unexpected map: %v\n", params[metrics.IntKeyValue(1)])
+ }
+ if params[metrics.IntKeyValue(2)] != 64 * values.MIB {
+  t.Errorf("Unexpected byte size: %v\n", params[metrics.IntKeyValue(2)])
+ }
+}
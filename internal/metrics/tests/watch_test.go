@@ -0,0 +1,280 @@
+package tests
+
+import (
+ "errors"
+ "io/ioutil"
+ "os"
+ "path/filepath"
+ "testing"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/internal/metrics"
+ "github.com/Matthewacon/go-figure/sources"
+ "github.com/Matthewacon/go-figure/watch"
+)
+
+const watchTimeout = 5 * time.Second
+
+func writeFile(t *testing.T, path, content string) {
+ if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+  t.Fatalf("Failed to write '%s': %s\n", path, err.Error())
+ }
+}
+
+//Starts a watcher that signals every reload and reload error
+func startWatcher(t *testing.T, cfg config.IConfigBus, poll time.Duration, src watch.IWatchable) (*watch.Watcher, chan config.Parameters, chan error) {
+ reloads, errs := make(chan config.Parameters, 16), make(chan error, 16)
+ watcher := watch.NewWatcher(cfg, src)
+ watcher.Debounce = 50 * time.Millisecond
+ watcher.PollInterval = poll
+ watcher.ReloadHandler = func(changed config.Parameters, removed []config.IParameterKey) {
+  reloads <- changed
+ }
+ watcher.ErrorHandler = func(err error) {
+  errs <- err
+ }
+ if err := watcher.Start(); err != nil {
+  t.Fatalf("Failed to start watcher: %s\n", err.Error())
+ }
+ //the initial load
+ <-reloads
+ return watcher, reloads, errs
+}
+
+func awaitReload(t *testing.T, reloads chan config.Parameters, errs chan error) config.Parameters {
+ select {
+ case changed := <-reloads:
+  return changed
+ case err := <-errs:
+  t.Errorf("Unexpected reload error: %s\n", err.Error())
+ case <-time.After(watchTimeout):
+  t.Errorf("Timed out waiting for a reload!\n")
+ }
+ return nil
+}
+
+func testWatchFile(t *testing.T, poll time.Duration) {
+ defer metrics.CatchUnexpectedPanic(t)
+ dir := tempDir(t)
+ defer os.RemoveAll(dir)
+ path := filepath.Join(dir, "config.yaml")
+ writeFile(t, path, "sql:\n  max_connections: 32\n  timeout: 5\n")
+ registry := newIntRegistry("sql.max_connections", "sql.timeout")
+ source, _ := sources.NewFileSource(path, registry)
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ writes := record(cfg, config.PARAMETER_ACCESS_WRITE, metrics.IntKeyValue(0), metrics.IntKeyValue(1))
+ watcher, reloads, errs := startWatcher(t, cfg, poll, source)
+ defer watcher.Close()
+ //only the changed parameter is applied
+ writeFile(t, path, "sql:\n  max_connections: 64\n  timeout: 5\n")
+ if changed := awaitReload(t, reloads, errs); len(changed) != 1 || changed[metrics.IntKeyValue(0)] != metrics.IntKeyValue(64) {
+  t.Errorf("Expected only 'sql.max_connections' to change, received: %v\n", changed)
+ }
+ if writes.count(metrics.IntKeyValue(0), config.PARAMETER_ACCESS_WRITE) != 2 ||
+  writes.count(metrics.IntKeyValue(1), config.PARAMETER_ACCESS_WRITE) != 1 {
+  t.Errorf("WRITE listeners fired for unchanged parameters: %v\n", writes.received())
+ }
+ //a broken file leaves the bus intact
+ writeFile(t, path, "sql: [\n")
+ select {
+ case err := <-errs:
+  var reloadErr *watch.ReloadError
+  if !errors.As(err, &reloadErr) {
+   t.Errorf("Expected a *watch.ReloadError, received: %v\n", err)
+  }
+ case <-reloads:
+  t.Errorf("Broken file was reloaded!\n")
+ case <-time.After(watchTimeout):
+  t.Errorf("Timed out waiting for a reload error!\n")
+ }
+ if value, _ := cfg.GetParameter(metrics.IntKeyValue(0)); value != metrics.IntKeyValue(64) {
+  t.Errorf("Failed reload modified the bus: %v\n", value)
+ }
+ //replacing the file, like editors do, and dropping a parameter
+ temp := filepath.Join(dir, "config.yaml.tmp")
+ writeFile(t, temp, "sql:\n  max_connections: 64\n")
+ if err := os.Rename(temp, path); err != nil {
+  t.Fatalf("Failed to replace '%s': %s\n", path, err.Error())
+ }
+ awaitReload(t, reloads, errs)
+ if _, ok := cfg.GetParameter(metrics.IntKeyValue(1)); ok {
+  t.Errorf("Parameter that was dropped from the file is still defined!\n")
+ }
+}
+
+//Removals are applied by the same transaction as the other changes of a reload, and a bus that rejects the reload
+//fails it instead of panicking
+func TestReloadRemovesAtomically(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ dir := tempDir(t)
+ defer os.RemoveAll(dir)
+ path := filepath.Join(dir, "config.yaml")
+ writeFile(t, path, "sql:\n  max_connections: 32\n  timeout: 5\n")
+ registry := newIntRegistry("sql.max_connections", "sql.timeout")
+ source, _ := sources.NewFileSource(path, registry)
+ _, cfg := metrics.DefaultEnvAndAsynchronousConfig()
+ watcher := watch.NewWatcher(cfg, source)
+ if err := watcher.Reload(); err != nil {
+  t.Fatalf("Initial load failed: %s\n", err.Error())
+ }
+ var changes config.ChangeSet
+ cfg.AddParameterListener(
+  metrics.IntKeyValue(1),
+  config.PARAMETER_ACCESS_DELETE,
+  func(context config.IListenerContext, prev config.IParameterValue) error {
+   changes = context.Changes()
+   return nil
+  },
+ )
+ writeFile(t, path, "sql:\n  max_connections: 64\n")
+ if err := watcher.Reload(); err != nil {
+  t.Fatalf("Reload failed: %s\n", err.Error())
+ }
+ cfg.Drain()
+ if len(changes) != 2 {
+  t.Errorf("Expected the removal to be applied with the update, received: %v\n", changes)
+ }
+ cfg.Close()
+ writeFile(t, path, "sql:\n  max_connections: 128\n")
+ if err := watcher.Reload(); err == nil {
+  t.Errorf("Expected reloading into a closed bus to fail\n")
+ }
+}
+
+func TestReloadRaisesNoReadEvents(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ dir := tempDir(t)
+ defer os.RemoveAll(dir)
+ path := filepath.Join(dir, "config.yaml")
+ writeFile(t, path, "sql:\n  max_connections: 32\n")
+ source, _ := sources.NewFileSource(path, newIntRegistry("sql.max_connections"))
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ reads := 0
+ cfg.AddParameterListener(
+  metrics.IntKeyValue(0),
+  config.PARAMETER_ACCESS_READ,
+  func(context config.IListenerContext, prev config.IParameterValue) error {
+   reads++
+   return nil
+  },
+ )
+ watcher := watch.NewWatcher(cfg, source)
+ for i := 0; i < 2; i++ {
+  if err := watcher.Reload(); err != nil {
+   t.Fatalf("Reload failed: %s\n", err.Error())
+  }
+ }
+ if reads != 0 {
+  t.Errorf("Reloads raised %d READ events!\n", reads)
+ }
+}
+
+func TestWatchFile(t *testing.T) {
+ testWatchFile(t, 0)
+}
+
+func TestWatchFilePolling(t *testing.T) {
+ testWatchFile(t, 20 * time.Millisecond)
+}
+
+//Mimics the atomic '..data' symlink swap of a Kubernetes ConfigMap volume
+func TestWatchConfigMapMount(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ dir := tempDir(t)
+ defer os.RemoveAll(dir)
+ publish := func(version, value string) {
+  data := filepath.Join(dir, "..version_" + version)
+  if err := os.Mkdir(data, 0700); err != nil {
+   t.Fatalf("Failed to create '%s': %s\n", data, err.Error())
+  }
+  writeFile(t, filepath.Join(data, "sql.max_connections"), value + "\n")
+  link := filepath.Join(dir, "..data_tmp")
+  if err := os.Symlink(filepath.Base(data), link); err != nil {
+   t.Fatalf("Failed to link '%s': %s\n", link, err.Error())
+  }
+  if err := os.Rename(link, filepath.Join(dir, "..data")); err != nil {
+   t.Fatalf("Failed to swap '..data': %s\n", err.Error())
+  }
+ }
+ publish("1", "32")
+ if err := os.Symlink(filepath.Join("..data", "sql.max_connections"), filepath.Join(dir, "sql.max_connections")); err != nil {
+  t.Fatalf("Failed to link the ConfigMap entry: %s\n", err.Error())
+ }
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ watcher, reloads, errs := startWatcher(t, cfg, 0, sources.NewDirectorySource(dir, newIntRegistry("sql.max_connections")))
+ defer watcher.Close()
+ if value, _ := cfg.GetParameter(metrics.IntKeyValue(0)); value != metrics.IntKeyValue(32) {
+  t.Errorf("Initial load returned '%v'\n", value)
+ }
+ publish("2", "64")
+ for deadline := time.Now().Add(watchTimeout); time.Now().Before(deadline); {
+  awaitReload(t, reloads, errs)
+  if value, _ := cfg.GetParameter(metrics.IntKeyValue(0)); value == metrics.IntKeyValue(64) {
+   return
+  }
+ }
+ t.Errorf("ConfigMap update was never applied!\n")
+}
+
+//Mimics tools that replace a directory with a new one, the replacement must be watched in turn
+func TestWatchReplacedDirectory(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ dir := tempDir(t)
+ defer os.RemoveAll(dir)
+ conf := filepath.Join(dir, "conf")
+ if err := os.Mkdir(conf, 0700); err != nil {
+  t.Fatalf("Failed to create '%s': %s\n", conf, err.Error())
+ }
+ writeFile(t, filepath.Join(conf, "sql.max_connections"), "32\n")
+ cfg := metrics.DefaultEnvAndConfig().GetConfig()
+ watcher, reloads, errs := startWatcher(t, cfg, 0, sources.NewDirectorySource(conf, newIntRegistry("sql.max_connections")))
+ defer watcher.Close()
+ replace := func(value string) {
+  next := filepath.Join(dir, "conf.next")
+  if err := os.Mkdir(next, 0700); err != nil {
+   t.Fatalf("Failed to create '%s': %s\n", next, err.Error())
+  }
+  writeFile(t, filepath.Join(next, "sql.max_connections"), value + "\n")
+  if err := os.Rename(conf, filepath.Join(dir, "conf.old")); err != nil {
+   t.Fatalf("Failed to move '%s': %s\n", conf, err.Error())
+  }
+  if err := os.Rename(next, conf); err != nil {
+   t.Fatalf("Failed to replace '%s': %s\n", conf, err.Error())
+  }
+  os.RemoveAll(filepath.Join(dir, "conf.old"))
+ }
+ await := func(expected config.IParameterValue) {
+  deadline := time.After(watchTimeout)
+  for {
+   select {
+   case <-reloads:
+   //reloads fail while the directory is missing
+   case <-errs:
+   case <-deadline:
+    t.Fatalf("Parameter was never reloaded as '%v'!\n", expected)
+   }
+   if value, _ := cfg.GetParameter(metrics.IntKeyValue(0)); value == expected {
+    return
+   }
+  }
+ }
+ replace("64")
+ await(metrics.IntKeyValue(64))
+ writeFile(t, filepath.Join(conf, "sql.max_connections"), "128\n")
+ await(metrics.IntKeyValue(128))
+ replace("256")
+ await(metrics.IntKeyValue(256))
+}
+
+func TestWatcherInitialLoadError(t *testing.T) {
+ defer metrics.CatchUnexpectedPanic(t)
+ dir := tempDir(t)
+ defer os.RemoveAll(dir)
+ source := sources.NewJSONSource(filepath.Join(dir, "missing.json"), newIntRegistry("sql.max_connections"))
+ watcher := watch.NewWatcher(metrics.DefaultEnvAndConfig().GetConfig(), source)
+ if err := watcher.Start(); err == nil {
+  t.Errorf("Expected the initial load of a missing file to fail!\n")
+ }
+ watcher.Close()
+}
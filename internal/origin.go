@@ -0,0 +1,195 @@
+package internal
+
+import (
+ "sync/atomic"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//The last change of every parameter of a config bus and the history it reports changes to, must only be used while
+//holding the lock that guards the store of the bus. Sequence numbers are handed out to reads as well, without the
+//lock.
+type changeLog struct {
+ //accessed atomically
+ sequence uint64
+ history  config.IHistory
+ last     map[config.IParameterKey]config.HistoryEntry
+}
+
+//Stamps the changes made by the writes of a listener, or of any other writer if parent is nil, with their sequence
+//numbers and time, then records them, so Explain can report the last change of every parameter
+func (log *changeLog) record(parent *listenerFrame, changes config.ChangeSet) {
+ if len(changes) == 0 {
+  return
+ }
+ var listener *config.ParameterListener
+ if parent != nil {
+  listener = parent.ParameterListener
+ }
+ if log.last == nil {
+  log.last = map[config.IParameterKey]config.HistoryEntry{}
+ }
+ var entries []config.HistoryEntry
+ if log.history != nil {
+  entries = make([]config.HistoryEntry, len(changes))
+ }
+ now := time.Now()
+ for i := range changes {
+  changes[i].Sequence = atomic.AddUint64(&log.sequence, 1)
+  changes[i].Time = now
+  entry := config.HistoryEntry{ParameterChange: changes[i], Listener: listener}
+  log.last[entry.Key] = entry
+  if entries != nil {
+   entries[i] = entry
+  }
+ }
+ if entries != nil {
+  log.history.Record(entries)
+ }
+}
+
+func (log *changeLog) setHistory(history config.IHistory) config.IHistory {
+ prev := log.history
+ log.history = history
+ return prev
+}
+
+func (log *changeLog) explain(store parameterStore, key config.IParameterKey) config.Explanation {
+ value, ok := store.parameters()[key]
+ explanation := config.Explanation{Key: key, Value: value, Defined: ok}
+ if entry, ok := log.last[key]; ok {
+  explanation.Change = &entry
+ }
+ return explanation
+}
+
+//Returns the event of a read of the parameter, not yet stamped with a sequence number
+func readEvent(key config.IParameterKey, value config.IParameterValue) config.ParameterEvent {
+ return config.ParameterEvent{
+  ParameterChange: config.ParameterChange{Key: key, Prev: value, Value: value},
+  Access: config.PARAMETER_ACCESS_READ,
+ }
+}
+
+//Stamps the event of a read with its sequence number and time, may be called without holding the lock
+func (log *changeLog) stampRead(event *config.ParameterEvent) {
+ event.Sequence = atomic.AddUint64(&log.sequence, 1)
+ event.Time = time.Now()
+}
+
+//Returns the event of the change of the key
+func writeEvent(changes config.ChangeSet, key config.IParameterKey) config.ParameterEvent {
+ for _, change := range changes {
+  if change.Key == key {
+   return config.ParameterEvent{ParameterChange: change, Access: writeAccess(change.Kind)}
+  }
+ }
+ return config.ParameterEvent{ParameterChange: config.ParameterChange{Key: key}, Access: config.PARAMETER_ACCESS_WRITE}
+}
+
+//Returns the access type of the events raised by a change
+func writeAccess(kind config.ChangeKind) config.ParameterAccess {
+ switch kind {
+ case config.CHANGE_CREATE:
+  return config.PARAMETER_ACCESS_CREATE
+ case config.CHANGE_UPDATE:
+  return config.PARAMETER_ACCESS_UPDATE
+ case config.CHANGE_REMOVE:
+  return config.PARAMETER_ACCESS_DELETE
+ default:
+  return config.PARAMETER_ACCESS_WRITE
+ }
+}
+
+//Reports CREATE, UPDATE and DELETE as WRITE, for listeners that compare their access type against it
+func legacyAccess(access config.ParameterAccess) config.ParameterAccess {
+ if access & config.PARAMETER_ACCESS_WRITE != 0 {
+  return config.PARAMETER_ACCESS_WRITE
+ }
+ return access
+}
+
+//Implemented by config buses and listener contexts, so writes made through an originConfig are attributed to the
+//same listener as the writes of the wrapped bus
+type originWriter interface {
+ config.IConfigBus
+ transactionalBus
+ //The listener whose writes the wrapped bus makes, nil for a config bus
+ writeParent() *listenerFrame
+ getPanicHandler() config.PanicHandler
+}
+
+//config.IConfigBus that attaches an origin to every write made through it, everything else is forwarded to the
+//wrapped bus
+type originConfig struct {
+ originWriter
+ origin *config.WriteOrigin
+}
+
+func newOriginConfig(bus originWriter, origin config.WriteOrigin) *originConfig {
+ return &originConfig{bus, &origin}
+}
+
+func (cfg *originConfig) detectPanic() {
+ if p := recover(); p != nil {
+  cfg.getPanicHandler()(p)
+ }
+}
+
+func (cfg *originConfig) commitWrites(writes []stagedWrite) ([]stagedWrite, error) {
+ for i := range writes {
+  writes[i].origin = cfg.origin
+ }
+ return cfg.originWriter.commit(cfg.writeParent(), writes)
+}
+
+func (cfg *originConfig) SetParameter(key config.IParameterKey, value config.IParameterValue) {
+ defer cfg.detectPanic()
+ if err := cfg.TrySetParameter(key, value); err != nil {
+  panic(err)
+ }
+}
+
+func (cfg *originConfig) SetParameters(params map[config.IParameterKey]config.IParameterValue) {
+ defer cfg.detectPanic()
+ if err := cfg.TrySetParameters(params); err != nil {
+  panic(err)
+ }
+}
+
+func (cfg *originConfig) TrySetParameter(key config.IParameterKey, value config.IParameterValue) error {
+ _, err := cfg.commitWrites([]stagedWrite{{key: key, value: value}})
+ if err, ok := err.(config.ValidationErrors); ok {
+  return err[0]
+ }
+ return err
+}
+
+func (cfg *originConfig) TrySetParameters(params map[config.IParameterKey]config.IParameterValue) error {
+ _, err := cfg.commitWrites(parameterWrites(params))
+ return err
+}
+
+func (cfg *originConfig) RemoveParameter(key config.IParameterKey) (config.IParameterValue, bool) {
+ defer cfg.detectPanic()
+ undo, err := cfg.commitWrites([]stagedWrite{{key: key, remove: true}})
+ if err != nil {
+  panic(err)
+ }
+ return undo[0].value, !undo[0].remove
+}
+
+func (cfg *originConfig) Begin() config.ITransaction {
+ return newTransaction(cfg.originWriter, cfg.writeParent(), cfg.origin)
+}
+
+func (cfg *originConfig) Restore(snapshot config.Snapshot) error {
+ defer cfg.detectPanic()
+ _, err := cfg.commitWrites(cfg.snapshotWrites(snapshot))
+ return err
+}
+
+func (cfg *originConfig) WithOrigin(origin config.WriteOrigin) config.IConfigBus {
+ return newOriginConfig(cfg.originWriter, origin)
+}
@@ -0,0 +1,62 @@
+package internal
+
+import "github.com/Matthewacon/go-figure/config"
+
+//The effective value of a parameter before and after a write, and whether the write changed it. Values are nil when
+//the parameter is not defined.
+type parameterChange struct {
+ prev, value config.IParameterValue
+ changed     bool
+ kind        config.ChangeKind
+}
+
+//Returns the kind of a change from whether the parameter was defined before and after it
+func changeKind(defined, remains bool) config.ChangeKind {
+ switch {
+ case !defined && remains:
+  return config.CHANGE_CREATE
+ case defined && remains:
+  return config.CHANGE_UPDATE
+ case defined && !remains:
+  return config.CHANGE_REMOVE
+ default:
+  return config.CHANGE_NONE
+ }
+}
+
+//Storage behind a synchronous config bus, must only be used while holding the bus mutex
+type parameterStore interface {
+ //Returns the effective parameters, the returned map must not be modified
+ parameters() config.Parameters
+ //Returns the value that writes replace, which may differ from the effective value
+ lookup(key config.IParameterKey) (config.IParameterValue, bool)
+ set(key config.IParameterKey, value config.IParameterValue) parameterChange
+ //Returns the removed value, if any
+ remove(key config.IParameterKey) (config.IParameterValue, bool, parameterChange)
+}
+
+//A single map of parameters, every write is a change
+type mapStore config.Parameters
+
+func (store mapStore) parameters() config.Parameters {
+ return config.Parameters(store)
+}
+
+func (store mapStore) lookup(key config.IParameterKey) (config.IParameterValue, bool) {
+ value, ok := store[key]
+ return value, ok
+}
+
+func (store mapStore) set(key config.IParameterKey, value config.IParameterValue) parameterChange {
+ prev, ok := store[key]
+ store[key] = value
+ return parameterChange{prev, value, true, changeKind(ok, true)}
+}
+
+func (store mapStore) remove(key config.IParameterKey) (config.IParameterValue, bool, parameterChange) {
+ value, ok := store[key]
+ if ok {
+  delete(store, key)
+ }
+ return value, ok, parameterChange{value, nil, ok, changeKind(ok, false)}
+}
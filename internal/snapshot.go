@@ -0,0 +1,20 @@
+package internal
+
+import "github.com/Matthewacon/go-figure/config"
+
+//Returns the writes that turn the current parameters into the target parameters, leaving equal values alone, see
+//config.ValuesEqual
+func restoreWrites(current, target config.Parameters, store parameterStore) []stagedWrite {
+ var writes []stagedWrite
+ for key := range current {
+  if _, ok := target[key]; !ok {
+   writes = append(writes, stagedWrite{key: key, remove: true, store: store})
+  }
+ }
+ for key, value := range target {
+  if prev, ok := current[key]; !ok || !config.ValuesEqual(prev, value) {
+   writes = append(writes, stagedWrite{key: key, value: value, store: store})
+  }
+ }
+ return writes
+}
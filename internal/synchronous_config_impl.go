@@ -3,132 +3,351 @@ package internal
 import (
  "fmt"
  "sync"
- "unsafe"
+ "sync/atomic"
 
  "github.com/Matthewacon/gas"
 
  "github.com/Matthewacon/go-figure/config"
 )
 
-const concurrentModification = "Configuration bus detected a concurrent modification to the listeners!\n"
+//Concurrency model:
+// - parameters and listeners are guarded by a RWMutex that is never held while listeners run, so listeners may freely
+//   read from and write to the bus
+// - listener slices are copy-on-write: they are only ever appended to or replaced while holding the listener lock,
+//   so an event that is being dispatched keeps a consistent view of the listeners that were registered when it was
+//   raised
+// - listeners are invoked on the goroutine that raised the event, with a listener context dedicated to that
+//   invocation; changes made through the context (or the bus returned by IListenerContext.Config) are attributed to
+//   the listener, they are not redelivered to it and are subject to cycle detection. Changes made by a listener
+//   directly through the bus are indistinguishable from any other caller's.
+type SynchronousConfigImpl struct {
+ //guards everything below, a single lock keeps the uncontended read and write paths to one lock acquisition
+ mutex        sync.RWMutex
+ store        parameterStore
+ listeners    config.ParameterListeners
+ groups       []*keyGroup
+ errorHandler config.CallbackErrorHandler
+ panicHandler config.PanicHandler
+ //accessed atomically
+ maxDepth int32
+ keys     keyResolver
+ //set at construction, the bus that embeds this one, so listener contexts reach the overrides of a layered bus
+ owner snapshotBus
+ //guarded by their own lock
+ validators validatorRegistry
+ //guarded by mutex
+ errorPolicies     errorPolicies
+ changeLog         changeLog
+ suppressUnchanged bool
+}
 
-type activeListener struct {
- config.IParameterKey
- *config.ParameterListener
- config.ParameterAccess
+//The methods a layered bus overrides to capture and restore its layers
+type snapshotBus interface {
+ Snapshot() config.Snapshot
+ snapshotWrites(snapshot config.Snapshot) []stagedWrite
 }
 
-type SynchronousConfigImpl struct {
- parameters      config.Parameters
- listeners       config.ParameterListeners
- currentListener *activeListener
- mutex           sync.Locker
- errorHandler    config.CallbackErrorHandler
- panicHandler    config.PanicHandler
+//Listener context handed to a single listener invocation, doubles as a view of the bus bound to that invocation
+type syncListenerContext struct {
+ cfg *SynchronousConfigImpl
+ listenerFrame
+ *listenerEvent
 }
 
 //TODO cover nil panic (when go-away is ready)
 func (cfg *SynchronousConfigImpl) detectPanic() {
  if p := recover(); p != nil {
-  cfg.panicHandler(p)
+  cfg.getPanicHandler()(p)
  }
 }
 
-//config.IConfigBus
-//TODO event loop checking (spawn a secondary goroutine that combs through the listener trace and looks for loops)
-// O(P^2) for {P ∈ Z | 2 <= P <= N/2}, where N is the number of access listeners in the set
-func (cfg *SynchronousConfigImpl) pushParameterEvent(key config.IParameterKey, access config.ParameterAccess, prevValue config.IParameterValue) {
- previousListener := cfg.currentListener
- accessListeners, ok := cfg.listeners[key]
- if ok {
-  defer func() { cfg.currentListener = previousListener }()
-  for _, listener := range *accessListeners {
-   //don't recurse into the same listener if a change was made from that listener
-   if listener.ParameterAccess & access != 0 {
-    if cfg.currentListener == nil || cfg.currentListener.ParameterListener != listener.ParameterListener {
-     cfg.currentListener = &activeListener{
-      key,
-      listener.ParameterListener,
-      access,
-     }
-     invoke := *listener.ParameterListener
-     if err := (invoke)(cfg, prevValue); err != nil {
-      cfg.errorHandler(invoke, access, key, err)
+func (cfg *SynchronousConfigImpl) getPanicHandler() config.PanicHandler {
+ cfg.mutex.RLock()
+ defer cfg.mutex.RUnlock()
+ return cfg.panicHandler
+}
+
+//Must be called while holding the mutex, the returned slice is never mutated
+func (cfg *SynchronousConfigImpl) getListeners(key config.IParameterKey) []config.ParameterListenerEntry {
+ return keyListeners(cfg.listeners, cfg.groups, key)
+}
+
+//Listeners are invoked in registration order on the calling goroutine. Events raised through a listener context are
+//nested under the listener that raised them, so the bus can tell when a chain of listeners loops back on itself
+//(A writes X, which triggers B writing Y, which triggers A again) or grows too deep; instead of recursing, the
+//offending listener is skipped and a *config.ListenerCycleError or *config.ListenerDepthError is reported to the
+//CallbackErrorHandler.
+func (cfg *SynchronousConfigImpl) pushParameterEvent(parent *listenerFrame, listeners []config.ParameterListenerEntry, key config.IParameterKey, access config.ParameterAccess, prevValue config.IParameterValue, changes config.ChangeSet) {
+ cfg.dispatchEvent(parent, listeners, key, access, prevValue, changes, false)
+}
+
+//Like pushParameterEvent, returns the listeners that were invoked for a write, which can be rolled back. With rollback
+//set, dispatching stops at the first listener that returns an error and the error is returned instead of being
+//reported.
+func (cfg *SynchronousConfigImpl) dispatchEvent(parent *listenerFrame, listeners []config.ParameterListenerEntry, key config.IParameterKey, access config.ParameterAccess, prevValue config.IParameterValue, changes config.ChangeSet, rollback bool) ([]config.ParameterListenerEntry, error) {
+ if len(listeners) == 0 {
+  return nil, nil
+ }
+ var event config.ParameterEvent
+ if access & config.PARAMETER_ACCESS_WRITE != 0 {
+  event = writeEvent(changes, key)
+ } else {
+  event = readEvent(key, prevValue)
+  cfg.changeLog.stampRead(&event)
+ }
+ var invoked []config.ParameterListenerEntry
+ var shared *listenerEvent
+ for _, listener := range listeners {
+  //don't recurse into the same listener if a change was made from that listener
+  if listener.ParameterAccess & access != 0 {
+   if parent == nil || parent.ParameterListener != listener.ParameterListener {
+    active := activeListener{key, listener.ParameterListener, access}
+    invoke := *listener.ParameterListener
+    if err := checkListenerChain(parent, active, int(atomic.LoadInt32(&cfg.maxDepth))); err != nil {
+     cfg.reportError(invoke, access, key, err)
+     continue
+    }
+    if shared == nil {
+     shared = &listenerEvent{changes, event}
+    }
+    context := &syncListenerContext{cfg, newListenerFrame(active, parent), shared}
+    if err := invoke(context, prevValue); err != nil {
+     if rollback {
+      return invoked, err
      }
+     cfg.reportError(invoke, access, key, err)
+    }
+    if access & config.PARAMETER_ACCESS_WRITE != 0 {
+     invoked = append(invoked, listener)
     }
    }
   }
  }
+ return invoked, nil
 }
 
-func (cfg *SynchronousConfigImpl) AddParameterListener(key config.IParameterKey, access config.ParameterAccess, listener config.ParameterListener) {
- defer cfg.detectPanic()
- if cfg.currentListener != nil {
-  panic(fmt.Errorf(concurrentModification))
+func (cfg *SynchronousConfigImpl) reportError(active config.ParameterListener, access config.ParameterAccess, key config.IParameterKey, err error) {
+ cfg.mutex.RLock()
+ errorHandler := cfg.errorHandler
+ cfg.mutex.RUnlock()
+ errorHandler(active, access, key, err)
+}
+
+func (cfg *SynchronousConfigImpl) getParameter(parent *listenerFrame, key config.IParameterKey) (config.IParameterValue, bool) {
+ key = cfg.keys.resolve(key)
+ cfg.mutex.RLock()
+ value, ok := cfg.store.parameters()[key]
+ listeners := cfg.getListeners(key)
+ cfg.mutex.RUnlock()
+ cfg.pushParameterEvent(parent, listeners, key, config.PARAMETER_ACCESS_READ, value, nil)
+ if !ok {
+  return nil, false
  }
+ return value, true
+}
+
+func (cfg *SynchronousConfigImpl) getParameterOr(parent *listenerFrame, key config.IParameterKey, value config.IParameterValue) config.IParameterValue {
+ key = cfg.keys.resolve(key)
+ ret := value
+ cfg.mutex.RLock()
+ if val, ok := cfg.store.parameters()[key]; ok {
+  ret = val
+ }
+ listeners := cfg.getListeners(key)
+ cfg.mutex.RUnlock()
+ cfg.pushParameterEvent(parent, listeners, key, config.PARAMETER_ACCESS_READ, value, nil)
+ return ret
+}
+
+func (cfg *SynchronousConfigImpl) getParameters(parent *listenerFrame) config.Parameters {
+ //shallow copy parameters to prevent mutations
+ params := config.Parameters{}
+ listeners := map[config.IParameterKey][]config.ParameterListenerEntry{}
+ cfg.mutex.RLock()
+ for k, v := range cfg.store.parameters() {
+  params[k] = v
+  if l := cfg.getListeners(k); len(l) > 0 {
+   listeners[k] = l
+  }
+ }
+ cfg.mutex.RUnlock()
+ //fire read events
+ for k, l := range listeners {
+  cfg.pushParameterEvent(parent, l, k, config.PARAMETER_ACCESS_READ, params[k], nil)
+ }
+ return params
+}
+
+//Stores every write under a single lock acquisition, then raises their WRITE events with the full change set. WRITE
+//events are only raised when the store reports a change, ie. when a layered bus resolves a different value. Keys must
+//already be resolved and values validated. Fills undo with the previous contents of the store for every write, and
+//returns a *config.RollbackError if a listener rejected the write.
+func (cfg *SynchronousConfigImpl) applyWrites(parent *listenerFrame, store parameterStore, writes, undo []stagedWrite) error {
+ //the change of a single write stays on the stack unless listeners are notified of it
+ var buffer [1]config.ParameterChange
  cfg.mutex.Lock()
- defer cfg.mutex.Unlock()
- accessListeners, ok := cfg.listeners[key]
- if !ok {
-  accessListeners = &[]config.ParameterListenerEntry{}
-  cfg.listeners[key] = accessListeners
+ stored := storeWrites(store, writes, undo, buffer[:0], cfg.suppressUnchanged)
+ listeners := make([][]config.ParameterListenerEntry, len(stored))
+ rollback := make([]bool, len(stored))
+ notified := false
+ for i, change := range stored {
+  listeners[i] = cfg.getListeners(change.Key)
+  rollback[i] = cfg.errorPolicies.rollback(change.Key)
+  notified = notified || len(listeners[i]) > 0
+ }
+ cfg.changeLog.record(parent, stored)
+ cfg.mutex.Unlock()
+ if !notified {
+  return nil
  }
- index := -1
- //Look for existing entry
- for i := 0; i < len(*accessListeners); i++ {
-  if (*accessListeners)[i].ParameterListener == &listener {
-   index = i
-   break
+ //the listener contexts outlive the call
+ changes := append(config.ChangeSet(nil), stored...)
+ invoked := make([][]config.ParameterListenerEntry, len(changes))
+ for i, change := range changes {
+  var err error
+  invoked[i], err = cfg.dispatchEvent(parent, listeners[i], change.Key, writeAccess(change.Kind), change.Prev, changes, rollback[i])
+  if err != nil {
+   return cfg.rollbackWrites(parent, store, writes, undo, changes[:i + 1], invoked, change.Key, err)
   }
  }
- if index != -1 {
-  //Update existing entry
-  (*accessListeners)[index].ParameterAccess |= access
- } else {
-  //Add new entry
-  *accessListeners = append(
-   *accessListeners,
-   config.ParameterListenerEntry{
-    access,
-    &listener,
-   },
-  )
+ return nil
+}
+
+//Reverts the writes and notifies the listeners that were already invoked for the notified changes of the revert
+func (cfg *SynchronousConfigImpl) rollbackWrites(parent *listenerFrame, store parameterStore, writes, undo []stagedWrite, notified config.ChangeSet, invoked [][]config.ParameterListenerEntry, key config.IParameterKey, err error) error {
+ cfg.mutex.Lock()
+ reverted := revertWrites(store, writes, undo)
+ cfg.changeLog.record(parent, reverted)
+ cfg.mutex.Unlock()
+ for _, change := range reverted {
+  for i, prev := range notified {
+   if prev.Key == change.Key {
+    cfg.pushParameterEvent(parent, invoked[i], change.Key, writeAccess(change.Kind), change.Prev, reverted)
+   }
+  }
  }
+ return &config.RollbackError{Key: key, Err: err, Reverted: reverted}
 }
 
-func (cfg *SynchronousConfigImpl) RemoveParameterListener(key config.IParameterKey, access config.ParameterAccess, toRemove config.ParameterListener) {
+func (cfg *SynchronousConfigImpl) trySetParameter(parent *listenerFrame, key config.IParameterKey, value config.IParameterValue) error {
+ key = cfg.keys.resolve(key)
+ if err := cfg.validators.validate(key, value); err != nil {
+  return err
+ }
+ var undo [1]stagedWrite
+ return cfg.applyWrites(parent, cfg.store, []stagedWrite{{key: key, value: value}}, undo[:])
+}
+
+func (cfg *SynchronousConfigImpl) setParameter(parent *listenerFrame, key config.IParameterKey, value config.IParameterValue) {
+ if err := cfg.trySetParameter(parent, key, value); err != nil {
+  panic(err)
+ }
+}
+
+//transactionalBus
+func (cfg *SynchronousConfigImpl) commit(parent *listenerFrame, writes []stagedWrite) ([]stagedWrite, error) {
+ writes = resolveWrites(&cfg.keys, writes)
+ if err := validateWrites(&cfg.validators, writes); err != nil {
+  return nil, err
+ }
+ undo := make([]stagedWrite, len(writes))
+ return undo, cfg.applyWrites(parent, cfg.store, writes, undo)
+}
+
+func (cfg *SynchronousConfigImpl) snapshotWrites(snapshot config.Snapshot) []stagedWrite {
+ cfg.mutex.RLock()
+ defer cfg.mutex.RUnlock()
+ return restoreWrites(cfg.store.parameters(), snapshot.GetParameters(), nil)
+}
+
+//originWriter
+func (cfg *SynchronousConfigImpl) writeParent() *listenerFrame {
+ return nil
+}
+
+func (cfg *SynchronousConfigImpl) trySetParameters(parent *listenerFrame, params map[config.IParameterKey]config.IParameterValue) error {
+ _, err := cfg.commit(parent, parameterWrites(params))
+ return err
+}
+
+func (cfg *SynchronousConfigImpl) setParameters(parent *listenerFrame, params map[config.IParameterKey]config.IParameterValue) {
+ if err := cfg.trySetParameters(parent, params); err != nil {
+  panic(err)
+ }
+}
+
+func (cfg *SynchronousConfigImpl) removeParameter(parent *listenerFrame, key config.IParameterKey) (config.IParameterValue, bool) {
+ key = cfg.keys.resolve(key)
+ var undo [1]stagedWrite
+ if err := cfg.applyWrites(parent, cfg.store, []stagedWrite{{key: key, remove: true}}, undo[:]); err != nil {
+  panic(err)
+ }
+ return undo[0].value, !undo[0].remove
+}
+
+//config.IConfigBus
+func (cfg *SynchronousConfigImpl) AddParameterListener(key config.IParameterKey, access config.ParameterAccess, listener config.ParameterListener) config.IListenerHandle {
  defer cfg.detectPanic()
- if cfg.currentListener != nil {
-  panic(fmt.Errorf(concurrentModification))
+ key = cfg.keys.resolve(key)
+ if listener == nil {
+  panic(fmt.Errorf(nilListener))
  }
  cfg.mutex.Lock()
  defer cfg.mutex.Unlock()
- accessListeners, ok := cfg.listeners[key]
- if ok {
-  for _, listener := range *accessListeners {
-   if listener.ParameterListener == &toRemove {
-    if listener.ParameterAccess & access != 0 {
-     listener.ParameterAccess = ^(^listener.ParameterAccess | access)
-     //remove listener if it no longer listens on any events
-     if listener.ParameterAccess == 0 {
-      //create new slice with all elements except this one
-      previousListeners := *accessListeners
-      *accessListeners = make([]config.ParameterListenerEntry, 0)
-      for _, prev := range previousListeners {
-       if prev.ParameterListener != &toRemove {
-        *accessListeners = append(*accessListeners, prev)
-       }
-      }
-     }
-     return
-    }
-   }
-  }
+ //every registration gets its own entry, even when the same listener is registered more than once
+ entry := &listener
+ addListenerEntry(cfg.listeners, key, access, entry)
+ return &listenerHandle{cfg, key, entry}
+}
+
+func (cfg *SynchronousConfigImpl) AddGroupListener(matcher config.IKeyMatcher, access config.ParameterAccess, listener config.ParameterListener) config.IListenerHandle {
+ defer cfg.detectPanic()
+ if matcher == nil {
+  panic(fmt.Errorf(nilMatcher))
+ }
+ if listener == nil {
+  panic(fmt.Errorf(nilListener))
+ }
+ cfg.mutex.Lock()
+ defer cfg.mutex.Unlock()
+ group := &keyGroup{matcher}
+ entry := &listener
+ addListenerEntry(cfg.listeners, group, access, entry)
+ cfg.groups = addKeyGroup(cfg.groups, group)
+ return &listenerHandle{cfg, group, entry}
+}
+
+//Deprecated: use the config.IListenerHandle returned by AddParameterListener instead
+func (cfg *SynchronousConfigImpl) RemoveParameterListener(key config.IParameterKey, access config.ParameterAccess, toRemove config.ParameterListener) {
+ defer cfg.detectPanic()
+ key = cfg.keys.resolve(key)
+ cfg.mutex.Lock()
+ defer cfg.mutex.Unlock()
+ if listener, prev, ok := findListenerFunc(cfg.listeners, key, toRemove); ok && prev & access != 0 {
+  updateListenerEntry(cfg.listeners, key, listener, ^(^prev | access))
  }
 }
 
+//listenerRegistry
+func (cfg *SynchronousConfigImpl) updateListener(key config.IParameterKey, listener *config.ParameterListener, access config.ParameterAccess) bool {
+ cfg.mutex.Lock()
+ defer cfg.mutex.Unlock()
+ updated := updateListenerEntry(cfg.listeners, key, listener, access)
+ cfg.groups = pruneKeyGroup(cfg.listeners, cfg.groups, key)
+ return updated
+}
+
+func (cfg *SynchronousConfigImpl) listenerAccess(key config.IParameterKey, listener *config.ParameterListener) (config.ParameterAccess, bool) {
+ cfg.mutex.RLock()
+ defer cfg.mutex.RUnlock()
+ return findListenerEntry(cfg.listeners, key, listener)
+}
+
 func (cfg *SynchronousConfigImpl) GetParameterListeners(key config.IParameterKey) []config.ParameterListenerEntry {
  defer cfg.detectPanic()
+ key = cfg.keys.resolve(key)
+ cfg.mutex.RLock()
+ defer cfg.mutex.RUnlock()
  if listeners, ok := cfg.listeners[key]; ok {
   toReturn := make([]config.ParameterListenerEntry, len(*listeners))
   copy(toReturn, *listeners)
@@ -139,6 +358,8 @@ func (cfg *SynchronousConfigImpl) GetParameterListeners(key config.IParameterKey
 
 func (cfg *SynchronousConfigImpl) SetCallbackErrorHandler(h config.CallbackErrorHandler) config.CallbackErrorHandler {
  gas.AssertNonNil(h)
+ cfg.mutex.Lock()
+ defer cfg.mutex.Unlock()
  prev := cfg.errorHandler
  cfg.errorHandler = h
  return prev
@@ -146,133 +367,303 @@ func (cfg *SynchronousConfigImpl) SetCallbackErrorHandler(h config.CallbackError
 
 func (cfg *SynchronousConfigImpl) SetUnexpectedPanicHandler(h config.PanicHandler) config.PanicHandler {
  gas.AssertNonNil(h)
+ cfg.mutex.Lock()
+ defer cfg.mutex.Unlock()
  prev := cfg.panicHandler
  cfg.panicHandler = h
  return prev
 }
 
+func (cfg *SynchronousConfigImpl) SetMaxListenerDepth(depth int) int {
+ return int(atomic.SwapInt32(&cfg.maxDepth, int32(depth)))
+}
+
+func (cfg *SynchronousConfigImpl) SetKeyRegistry(registry config.IKeyRegistry) config.IKeyRegistry {
+ return cfg.keys.swap(registry)
+}
+
 func (cfg *SynchronousConfigImpl) GetParameter(key config.IParameterKey) (config.IParameterValue, bool) {
  defer cfg.detectPanic()
- value, ok := cfg.parameters[key]
- cfg.pushParameterEvent(key, config.PARAMETER_ACCESS_READ, value)
- if !ok {
-  return nil, false
- }
- return value, true
+ return cfg.getParameter(nil, key)
 }
 
 func (cfg *SynchronousConfigImpl) GetParameterOr(key config.IParameterKey, value config.IParameterValue) config.IParameterValue {
  defer cfg.detectPanic()
- ret := value
- if val, ok := cfg.parameters[key]; ok {
-  ret = val
- }
- cfg.pushParameterEvent(key, config.PARAMETER_ACCESS_READ, value)
- return ret
+ return cfg.getParameterOr(nil, key, value)
 }
 
 func (cfg *SynchronousConfigImpl) GetParameters() config.Parameters {
  defer cfg.detectPanic()
- //shallow copy parameters to prevent mutations
- params := config.Parameters{}
- for k, v := range cfg.parameters {
-  params[k] = v
- }
- //fire read events
- for k, v := range cfg.parameters {
-  cfg.pushParameterEvent(k, config.PARAMETER_ACCESS_READ, v)
- }
- return params
+ return cfg.getParameters(nil)
 }
 
 func (cfg *SynchronousConfigImpl) SetParameter(key config.IParameterKey, value config.IParameterValue) {
  defer cfg.detectPanic()
- prevValue, ok := cfg.parameters[key]
- if !ok {
-  prevValue = nil
- }
- cfg.parameters[key] = value
- cfg.pushParameterEvent(key, config.PARAMETER_ACCESS_WRITE, prevValue)
+ cfg.setParameter(nil, key, value)
 }
 
 func (cfg *SynchronousConfigImpl) SetParameters(params map[config.IParameterKey]config.IParameterValue) {
  defer cfg.detectPanic()
- for key, value := range params {
-  prevValue, ok := cfg.parameters[key]
-  if !ok {
-   prevValue = nil
-  }
-  cfg.pushParameterEvent(key, config.PARAMETER_ACCESS_WRITE, prevValue)
-  cfg.parameters[key] = value
- }
+ cfg.setParameters(nil, params)
 }
 
 func (cfg *SynchronousConfigImpl) RemoveParameter(key config.IParameterKey) (config.IParameterValue, bool) {
  defer cfg.detectPanic()
- value, ok := cfg.parameters[key]
- if ok {
-  delete(cfg.parameters, key)
-  cfg.pushParameterEvent(key, config.PARAMETER_ACCESS_WRITE, value)
-  return value, ok
- }
- return nil, false
+ return cfg.removeParameter(nil, key)
 }
 
-func (cfg *SynchronousConfigImpl) ensureListenerActive() {
- if cfg.currentListener == nil {
-  panic(fmt.Errorf("IListenerContext used outside of listener evaluation!\n"))
- }
+func (cfg *SynchronousConfigImpl) AddParameterValidator(key config.IParameterKey, validator config.ParameterValidator) config.IValidatorHandle {
+ defer cfg.detectPanic()
+ return cfg.validators.add(cfg.keys.resolve(key), validator)
+}
+
+func (cfg *SynchronousConfigImpl) TrySetParameter(key config.IParameterKey, value config.IParameterValue) error {
+ defer cfg.detectPanic()
+ return cfg.trySetParameter(nil, key, value)
+}
+
+func (cfg *SynchronousConfigImpl) TrySetParameters(params map[config.IParameterKey]config.IParameterValue) error {
+ defer cfg.detectPanic()
+ return cfg.trySetParameters(nil, params)
+}
+
+func (cfg *SynchronousConfigImpl) Begin() config.ITransaction {
+ return newTransaction(cfg, nil, nil)
+}
+
+func (cfg *SynchronousConfigImpl) SetListenerErrorPolicy(policy config.ListenerErrorPolicy) config.ListenerErrorPolicy {
+ cfg.mutex.Lock()
+ defer cfg.mutex.Unlock()
+ return cfg.errorPolicies.set(policy)
+}
+
+func (cfg *SynchronousConfigImpl) SetKeyListenerErrorPolicy(key config.IParameterKey, policy config.ListenerErrorPolicy) config.ListenerErrorPolicy {
+ defer cfg.detectPanic()
+ key = cfg.keys.resolve(key)
+ cfg.mutex.Lock()
+ defer cfg.mutex.Unlock()
+ return cfg.errorPolicies.setKey(key, policy)
+}
+
+func (cfg *SynchronousConfigImpl) SetHistory(history config.IHistory) config.IHistory {
+ cfg.mutex.Lock()
+ defer cfg.mutex.Unlock()
+ return cfg.changeLog.setHistory(history)
+}
+
+func (cfg *SynchronousConfigImpl) SetSuppressUnchanged(suppress bool) bool {
+ cfg.mutex.Lock()
+ defer cfg.mutex.Unlock()
+ prev := cfg.suppressUnchanged
+ cfg.suppressUnchanged = suppress
+ return prev
+}
+
+func (cfg *SynchronousConfigImpl) Snapshot() config.Snapshot {
+ cfg.mutex.RLock()
+ defer cfg.mutex.RUnlock()
+ return config.NewSnapshot(cfg.store.parameters())
+}
+
+func (cfg *SynchronousConfigImpl) Restore(snapshot config.Snapshot) error {
+ defer cfg.detectPanic()
+ return cfg.restore(nil, snapshot)
+}
+
+func (cfg *SynchronousConfigImpl) restore(parent *listenerFrame, snapshot config.Snapshot) error {
+ _, err := cfg.commit(parent, cfg.snapshotWrites(snapshot))
+ return err
+}
+
+func (cfg *SynchronousConfigImpl) WithOrigin(origin config.WriteOrigin) config.IConfigBus {
+ return newOriginConfig(cfg, origin)
+}
+
+func (cfg *SynchronousConfigImpl) Explain(key config.IParameterKey) config.Explanation {
+ defer cfg.detectPanic()
+ key = cfg.keys.resolve(key)
+ cfg.mutex.RLock()
+ defer cfg.mutex.RUnlock()
+ return cfg.changeLog.explain(cfg.store, key)
 }
 
 //config.IListenerContext
-func (cfg *SynchronousConfigImpl) Key() config.IParameterKey {
- cfg.ensureListenerActive()
- return cfg.currentListener.IParameterKey
+func (context *syncListenerContext) Key() config.IParameterKey {
+ return context.IParameterKey
 }
 
-func (cfg *SynchronousConfigImpl) Value() (config.IParameterValue, bool) {
- return cfg.GetParameter(cfg.Key())
+func (context *syncListenerContext) Value() (config.IParameterValue, bool) {
+ return context.GetParameter(context.IParameterKey)
 }
 
-func (cfg *SynchronousConfigImpl) ValueOr(or config.IParameterValue) config.IParameterValue {
- if val, ok := cfg.Value(); ok {
+func (context *syncListenerContext) ValueOr(or config.IParameterValue) config.IParameterValue {
+ if val, ok := context.Value(); ok {
   return val
  }
  return or
 }
 
-func (cfg *SynchronousConfigImpl) SetValue(value config.IParameterValue) {
- cfg.ensureListenerActive()
- cfg.SetParameter(cfg.Key(), value)
+func (context *syncListenerContext) SetValue(value config.IParameterValue) {
+ context.SetParameter(context.IParameterKey, value)
 }
 
-func (cfg *SynchronousConfigImpl) Config() config.IConfigBus {
- cfg.ensureListenerActive()
- return cfg
+func (context *syncListenerContext) Config() config.IConfigBus {
+ return context
+}
+
+func (context *syncListenerContext) AccessType() config.ParameterAccess {
+ return legacyAccess(context.ParameterAccess)
+}
+
+func (context *syncListenerContext) Changes() config.ChangeSet {
+ return append(config.ChangeSet(nil), context.changes...)
 }
 
-func (cfg *SynchronousConfigImpl) AccessType() config.ParameterAccess {
- cfg.ensureListenerActive()
- return cfg.currentListener.ParameterAccess
+func (context *syncListenerContext) Origin() *config.WriteOrigin {
+ return context.event.Origin
+}
+
+func (context *syncListenerContext) Event() config.ParameterEvent {
+ return context.event
+}
+
+//config.IConfigBus, bound to the listener invocation
+func (context *syncListenerContext) AddParameterListener(key config.IParameterKey, access config.ParameterAccess, listener config.ParameterListener) config.IListenerHandle {
+ return context.cfg.AddParameterListener(key, access, listener)
+}
+
+func (context *syncListenerContext) AddGroupListener(matcher config.IKeyMatcher, access config.ParameterAccess, listener config.ParameterListener) config.IListenerHandle {
+ return context.cfg.AddGroupListener(matcher, access, listener)
+}
+
+func (context *syncListenerContext) RemoveParameterListener(key config.IParameterKey, access config.ParameterAccess, toRemove config.ParameterListener) {
+ context.cfg.RemoveParameterListener(key, access, toRemove)
+}
+
+func (context *syncListenerContext) GetParameterListeners(key config.IParameterKey) []config.ParameterListenerEntry {
+ return context.cfg.GetParameterListeners(key)
+}
+
+func (context *syncListenerContext) SetCallbackErrorHandler(h config.CallbackErrorHandler) config.CallbackErrorHandler {
+ return context.cfg.SetCallbackErrorHandler(h)
+}
+
+func (context *syncListenerContext) SetUnexpectedPanicHandler(h config.PanicHandler) config.PanicHandler {
+ return context.cfg.SetUnexpectedPanicHandler(h)
+}
+
+func (context *syncListenerContext) SetMaxListenerDepth(depth int) int {
+ return context.cfg.SetMaxListenerDepth(depth)
+}
+
+func (context *syncListenerContext) SetKeyRegistry(registry config.IKeyRegistry) config.IKeyRegistry {
+ return context.cfg.SetKeyRegistry(registry)
+}
+
+func (context *syncListenerContext) GetParameter(key config.IParameterKey) (config.IParameterValue, bool) {
+ return context.cfg.getParameter(&context.listenerFrame, key)
+}
+
+func (context *syncListenerContext) GetParameterOr(key config.IParameterKey, value config.IParameterValue) config.IParameterValue {
+ return context.cfg.getParameterOr(&context.listenerFrame, key, value)
+}
+
+func (context *syncListenerContext) GetParameters() config.Parameters {
+ return context.cfg.getParameters(&context.listenerFrame)
+}
+
+func (context *syncListenerContext) SetParameter(key config.IParameterKey, value config.IParameterValue) {
+ context.cfg.setParameter(&context.listenerFrame, key, value)
+}
+
+func (context *syncListenerContext) SetParameters(params map[config.IParameterKey]config.IParameterValue) {
+ context.cfg.setParameters(&context.listenerFrame, params)
+}
+
+func (context *syncListenerContext) RemoveParameter(key config.IParameterKey) (config.IParameterValue, bool) {
+ return context.cfg.removeParameter(&context.listenerFrame, key)
+}
+
+func (context *syncListenerContext) AddParameterValidator(key config.IParameterKey, validator config.ParameterValidator) config.IValidatorHandle {
+ return context.cfg.AddParameterValidator(key, validator)
+}
+
+func (context *syncListenerContext) TrySetParameter(key config.IParameterKey, value config.IParameterValue) error {
+ return context.cfg.trySetParameter(&context.listenerFrame, key, value)
+}
+
+func (context *syncListenerContext) TrySetParameters(params map[config.IParameterKey]config.IParameterValue) error {
+ return context.cfg.trySetParameters(&context.listenerFrame, params)
+}
+
+//Commits are attributed to the listener, like any other write made through the context
+func (context *syncListenerContext) Begin() config.ITransaction {
+ return newTransaction(context.cfg, &context.listenerFrame, nil)
+}
+
+func (context *syncListenerContext) SetListenerErrorPolicy(policy config.ListenerErrorPolicy) config.ListenerErrorPolicy {
+ return context.cfg.SetListenerErrorPolicy(policy)
+}
+
+func (context *syncListenerContext) SetKeyListenerErrorPolicy(key config.IParameterKey, policy config.ListenerErrorPolicy) config.ListenerErrorPolicy {
+ return context.cfg.SetKeyListenerErrorPolicy(key, policy)
+}
+
+func (context *syncListenerContext) SetHistory(history config.IHistory) config.IHistory {
+ return context.cfg.SetHistory(history)
+}
+
+func (context *syncListenerContext) SetSuppressUnchanged(suppress bool) bool {
+ return context.cfg.SetSuppressUnchanged(suppress)
+}
+
+func (context *syncListenerContext) Snapshot() config.Snapshot {
+ return context.cfg.owner.Snapshot()
+}
+
+func (context *syncListenerContext) Restore(snapshot config.Snapshot) error {
+ _, err := context.cfg.commit(&context.listenerFrame, context.cfg.owner.snapshotWrites(snapshot))
+ return err
+}
+
+func (context *syncListenerContext) WithOrigin(origin config.WriteOrigin) config.IConfigBus {
+ return newOriginConfig(context, origin)
+}
+
+func (context *syncListenerContext) Explain(key config.IParameterKey) config.Explanation {
+ return context.cfg.Explain(key)
+}
+
+//originWriter
+func (context *syncListenerContext) commit(parent *listenerFrame, writes []stagedWrite) ([]stagedWrite, error) {
+ return context.cfg.commit(parent, writes)
+}
+
+func (context *syncListenerContext) snapshotWrites(snapshot config.Snapshot) []stagedWrite {
+ return context.cfg.owner.snapshotWrites(snapshot)
+}
+
+func (context *syncListenerContext) writeParent() *listenerFrame {
+ return &context.listenerFrame
+}
+
+func (context *syncListenerContext) getPanicHandler() config.PanicHandler {
+ return context.cfg.getPanicHandler()
 }
 
 func NewSynchronousConfigBus() config.IConfigBus {
- return &SynchronousConfigImpl{
-  config.Parameters{},
-  config.ParameterListeners{},
-  nil,
-  &sync.Mutex{},
-  func(active config.ParameterListener, access config.ParameterAccess, key config.IParameterKey, err error) {
-   panic(fmt.Errorf(
-    "Encountered unexpected error from listener 0x%x on 0x%x access of [%v]:\n%s\n",
-    unsafe.Pointer(&active),
-    access,
-    key.Key(),
-    err.Error(),
-   ))
-  },
-  func(p interface{}) {
-   panic(p)
-  },
+ return newSynchronousConfigImpl(mapStore{})
+}
+
+func newSynchronousConfigImpl(store parameterStore) *SynchronousConfigImpl {
+ cfg := &SynchronousConfigImpl{
+  store: store,
+  listeners: config.ParameterListeners{},
+  errorHandler: defaultCallbackErrorHandler,
+  panicHandler: defaultPanicHandler,
+  maxDepth: config.DEFAULT_MAX_LISTENER_DEPTH,
+  errorPolicies: errorPolicies{policy: config.LISTENER_ERROR_REPORT},
  }
+ cfg.owner = cfg
+ return cfg
 }
@@ -0,0 +1,263 @@
+package internal
+
+import (
+ "fmt"
+ "sort"
+ "sync"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+const finishedTransaction = "Transaction has already been committed or rolled back!\n"
+
+//A single write of a multi-key write or transaction
+type stagedWrite struct {
+ key    config.IParameterKey
+ value  config.IParameterValue
+ remove bool
+ origin *config.WriteOrigin
+ //overrides the store the write goes to, ie. a single layer of a layered bus
+ store parameterStore
+}
+
+//Implemented by config buses that can store several writes at once
+type transactionalBus interface {
+ //Resolves and validates every write, then stores all of them at once before raising any event. Returns the previous
+ //contents of the store for every resolved write.
+ commit(origin *listenerFrame, writes []stagedWrite) ([]stagedWrite, error)
+ //Returns the writes that reset the bus to the snapshot
+ snapshotWrites(snapshot config.Snapshot) []stagedWrite
+}
+
+//Resolves the keys of the writes through the key registry, ordered by key so events are raised in a stable order
+func resolveWrites(resolver *keyResolver, writes []stagedWrite) []stagedWrite {
+ resolved := make([]stagedWrite, len(writes))
+ for i, write := range writes {
+  resolved[i] = write
+  resolved[i].key = resolver.resolve(write.key)
+ }
+ sort.SliceStable(resolved, func(i, j int) bool {
+  return resolved[i].key.String() < resolved[j].key.String()
+ })
+ return resolved
+}
+
+//Returns config.ValidationErrors if any of the set values is rejected, removals are not validated
+func validateWrites(validators *validatorRegistry, writes []stagedWrite) error {
+ params := map[config.IParameterKey]config.IParameterValue{}
+ for _, write := range writes {
+  if !write.remove {
+   params[write.key] = write.value
+  } else {
+   delete(params, write.key)
+  }
+ }
+ return validators.validateAll(params)
+}
+
+func parameterWrites(params map[config.IParameterKey]config.IParameterValue) []stagedWrite {
+ writes := make([]stagedWrite, 0, len(params))
+ for key, value := range params {
+  writes = append(writes, stagedWrite{key: key, value: value})
+ }
+ return writes
+}
+
+func (write *stagedWrite) storeOr(store parameterStore) parameterStore {
+ if write.store != nil {
+  return write.store
+ }
+ return store
+}
+
+//Applies every write to its store, must be called while holding the lock that guards the stores. Appends the changes
+//to changes in the order of the writes, several writes of the same key being merged into a single change, and fills
+//undo, which holds an element for every write, with the writes that restore the previous contents of the stores.
+//With suppress set, values equal to the ones they replace are not stored, see config.ValuesEqual.
+func storeWrites(store parameterStore, writes, undo []stagedWrite, changes config.ChangeSet, suppress bool) config.ChangeSet {
+ var merger changeMerger
+ for i, write := range writes {
+  target := write.storeOr(store)
+  prev, ok := target.lookup(write.key)
+  undo[i] = stagedWrite{key: write.key, value: prev, remove: !ok, store: write.store}
+  if suppress && ok && !write.remove && config.ValuesEqual(prev, write.value) {
+   continue
+  }
+  var change parameterChange
+  if write.remove {
+   _, _, change = target.remove(write.key)
+  } else {
+   change = target.set(write.key, write.value)
+  }
+  //a single write has nothing to merge with, so it is spared the index of the merger
+  if len(writes) == 1 {
+   if !change.changed || change.kind == config.CHANGE_NONE {
+    return changes
+   }
+   return append(changes, newParameterChange(write.key, change, write.origin))
+  }
+  merger.add(write.key, change, write.origin)
+ }
+ return append(changes, merger.changeSet()...)
+}
+
+//Restores the previous contents of the store for every write that has not been changed since, latest write first.
+//Must be called while holding the lock that guards the store, returns the reverting changes ordered by key.
+func revertWrites(store parameterStore, writes, undo []stagedWrite) config.ChangeSet {
+ var merger changeMerger
+ for i := len(writes) - 1; i >= 0; i-- {
+  write := writes[i]
+  target := write.storeOr(store)
+  current, ok := target.lookup(write.key)
+  if write.remove && ok || !write.remove && (!ok || !config.ValuesEqual(current, write.value)) {
+   continue
+  }
+  //a suppressed write did not replace anything
+  if ok && !undo[i].remove && config.ValuesEqual(current, undo[i].value) {
+   continue
+  }
+  var change parameterChange
+  if undo[i].remove {
+   _, _, change = target.remove(write.key)
+  } else {
+   change = target.set(write.key, undo[i].value)
+  }
+  merger.add(write.key, change, nil)
+ }
+ reverted := merger.changeSet()
+ sort.SliceStable(reverted, func(i, j int) bool {
+  return reverted[i].Key.String() < reverted[j].Key.String()
+ })
+ return reverted
+}
+
+//Builds a change set from the changes of several writes, several changes of the same key are merged into one that
+//carries the origin of the latest write. A parameter that was created and removed again has not changed.
+type changeMerger struct {
+ changes config.ChangeSet
+ index   map[config.IParameterKey]int
+}
+
+func (merger *changeMerger) add(key config.IParameterKey, change parameterChange, origin *config.WriteOrigin) {
+ if !change.changed {
+  return
+ }
+ if i, ok := merger.index[key]; ok {
+  merged := &merger.changes[i]
+  merged.Value = change.value
+  defined := merged.Kind == config.CHANGE_UPDATE || merged.Kind == config.CHANGE_REMOVE
+  merged.Kind = changeKind(defined, change.kind != config.CHANGE_REMOVE)
+  merged.Origin = origin
+  return
+ }
+ if merger.index == nil {
+  merger.index = map[config.IParameterKey]int{}
+ }
+ merger.index[key] = len(merger.changes)
+ merger.changes = append(merger.changes, newParameterChange(key, change, origin))
+}
+
+func newParameterChange(key config.IParameterKey, change parameterChange, origin *config.WriteOrigin) config.ParameterChange {
+ return config.ParameterChange{
+  Key: key,
+  Prev: change.prev,
+  Value: change.value,
+  Kind: change.kind,
+  Origin: origin,
+ }
+}
+
+func (merger *changeMerger) changeSet() config.ChangeSet {
+ changes := merger.changes[:0]
+ for _, change := range merger.changes {
+  if change.Kind != config.CHANGE_NONE {
+   changes = append(changes, change)
+  }
+ }
+ return changes
+}
+
+//config.ITransaction
+type transaction struct {
+ bus    transactionalBus
+ origin *listenerFrame
+ mutex  sync.Mutex
+ //attached to the writes staged from now on
+ writeOrigin *config.WriteOrigin
+ //staged writes by key, the order of keys is kept so later writes of the same key replace earlier ones in place
+ staged map[config.IParameterKey]int
+ writes []stagedWrite
+ done   bool
+}
+
+func newTransaction(bus transactionalBus, origin *listenerFrame, writeOrigin *config.WriteOrigin) *transaction {
+ return &transaction{bus: bus, origin: origin, writeOrigin: writeOrigin, staged: map[config.IParameterKey]int{}}
+}
+
+//Must be called while holding the mutex
+func (tx *transaction) stage(write stagedWrite) {
+ if tx.done {
+  panic(fmt.Errorf(finishedTransaction))
+ }
+ write.origin = tx.writeOrigin
+ if i, ok := tx.staged[write.key]; ok {
+  tx.writes[i] = write
+  return
+ }
+ tx.staged[write.key] = len(tx.writes)
+ tx.writes = append(tx.writes, write)
+}
+
+func (tx *transaction) SetParameter(key config.IParameterKey, value config.IParameterValue) {
+ tx.mutex.Lock()
+ defer tx.mutex.Unlock()
+ tx.stage(stagedWrite{key: key, value: value})
+}
+
+func (tx *transaction) SetParameters(params map[config.IParameterKey]config.IParameterValue) {
+ tx.mutex.Lock()
+ defer tx.mutex.Unlock()
+ for key, value := range params {
+  tx.stage(stagedWrite{key: key, value: value})
+ }
+}
+
+func (tx *transaction) RemoveParameter(key config.IParameterKey) {
+ tx.mutex.Lock()
+ defer tx.mutex.Unlock()
+ tx.stage(stagedWrite{key: key, remove: true})
+}
+
+func (tx *transaction) SetOrigin(origin *config.WriteOrigin) {
+ tx.mutex.Lock()
+ defer tx.mutex.Unlock()
+ tx.writeOrigin = origin
+}
+
+//The transaction is finished even if the commit is rejected
+func (tx *transaction) Commit() error {
+ tx.mutex.Lock()
+ if tx.done {
+  tx.mutex.Unlock()
+  panic(fmt.Errorf(finishedTransaction))
+ }
+ tx.done = true
+ writes := tx.writes
+ tx.staged, tx.writes = nil, nil
+ tx.mutex.Unlock()
+ if len(writes) == 0 {
+  return nil
+ }
+ _, err := tx.bus.commit(tx.origin, writes)
+ return err
+}
+
+func (tx *transaction) Rollback() {
+ tx.mutex.Lock()
+ defer tx.mutex.Unlock()
+ if tx.done {
+  panic(fmt.Errorf(finishedTransaction))
+ }
+ tx.done = true
+ tx.staged, tx.writes = nil, nil
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+ "fmt"
+ "sort"
+ "sync"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+const nilValidator = "Cannot add a nil parameter validator!\n"
+
+//The validators of a config bus, shared by all config bus implementations. Validators are guarded by their own lock,
+//which is never held while they run, so validators may read from the bus.
+type validatorRegistry struct {
+ mutex sync.RWMutex
+ //copy-on-write, like listener slices
+ validators map[config.IParameterKey][]*config.ParameterValidator
+}
+
+//config.IValidatorHandle
+type validatorHandle struct {
+ registry  *validatorRegistry
+ key       config.IParameterKey
+ validator *config.ParameterValidator
+}
+
+func (handle *validatorHandle) Key() config.IParameterKey {
+ return handle.key
+}
+
+func (handle *validatorHandle) Remove() {
+ handle.registry.remove(handle.key, handle.validator)
+}
+
+func (registry *validatorRegistry) add(key config.IParameterKey, validator config.ParameterValidator) config.IValidatorHandle {
+ if validator == nil {
+  panic(fmt.Errorf(nilValidator))
+ }
+ registry.mutex.Lock()
+ defer registry.mutex.Unlock()
+ if registry.validators == nil {
+  registry.validators = map[config.IParameterKey][]*config.ParameterValidator{}
+ }
+ //every registration gets its own entry, even when the same validator is added more than once
+ entry := &validator
+ prev := registry.validators[key]
+ validators := make([]*config.ParameterValidator, len(prev), len(prev) + 1)
+ copy(validators, prev)
+ registry.validators[key] = append(validators, entry)
+ return &validatorHandle{registry, key, entry}
+}
+
+func (registry *validatorRegistry) remove(key config.IParameterKey, validator *config.ParameterValidator) {
+ registry.mutex.Lock()
+ defer registry.mutex.Unlock()
+ prev := registry.validators[key]
+ validators := make([]*config.ParameterValidator, 0, len(prev))
+ for _, entry := range prev {
+  if entry != validator {
+   validators = append(validators, entry)
+  }
+ }
+ if len(validators) == 0 {
+  delete(registry.validators, key)
+ } else {
+  registry.validators[key] = validators
+ }
+}
+
+//Returns a *config.ValidationError for the first validator that rejects the value
+func (registry *validatorRegistry) validate(key config.IParameterKey, value config.IParameterValue) error {
+ registry.mutex.RLock()
+ validators := registry.validators[key]
+ registry.mutex.RUnlock()
+ for _, validator := range validators {
+  if err := (*validator)(key, value); err != nil {
+   return &config.ValidationError{Key: key, Value: value, Err: err}
+  }
+ }
+ return nil
+}
+
+//Validates every parameter, returns config.ValidationErrors ordered by key if any value is rejected
+func (registry *validatorRegistry) validateAll(params map[config.IParameterKey]config.IParameterValue) error {
+ var errs config.ValidationErrors
+ for key, value := range params {
+  if err := registry.validate(key, value); err != nil {
+   errs = append(errs, err.(*config.ValidationError))
+  }
+ }
+ if len(errs) == 0 {
+  return nil
+ }
+ sort.Slice(errs, func(i, j int) bool {
+  return errs[i].Key.String() < errs[j].Key.String()
+ })
+ return errs
+}
@@ -0,0 +1,137 @@
+package keys
+
+import (
+ "errors"
+ "fmt"
+ "reflect"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//Returned when a parameter is not defined
+type MissingParameterError struct {
+ Key config.IParameterKey
+}
+
+func (err *MissingParameterError) Error() string {
+ return fmt.Sprintf("Parameter '%s' is not defined!\n", err.Key.String())
+}
+
+//Returned when a parameter holds a value of another type than its key expects
+type TypeMismatchError struct {
+ Key      config.IParameterKey
+ Expected reflect.Type
+ Value    config.IParameterValue
+}
+
+func (err *TypeMismatchError) Error() string {
+ return fmt.Sprintf(
+  "Parameter '%s' holds '%s' of type %T, expected a value of type %s!\n",
+  err.Key.String(),
+  err.Value.String(),
+  err.Value,
+  err.Expected,
+ )
+}
+
+//The name and value type shared by all typed keys. Typed keys are compared by identity, so every key must be
+//created once, ie. as a package level variable, and shared.
+type typedKey struct {
+ name      string
+ valueType reflect.Type
+}
+
+//config.IParameterKey
+func (key *typedKey) Key() interface{} { return key.name }
+func (key *typedKey) String() string   { return key.name }
+
+//Returns the type of the values of the key
+func (key *typedKey) ValueType() reflect.Type {
+ return key.valueType
+}
+
+//Checks the type of a value of the key, nil values are never a mismatch
+func (key *typedKey) check(self config.IParameterKey, value config.IParameterValue) error {
+ if value != nil && reflect.TypeOf(value) != key.valueType {
+  return &TypeMismatchError{self, key.valueType, value}
+ }
+ return nil
+}
+
+func (key *typedKey) get(self config.IParameterKey, bus config.IConfigBus) (config.IParameterValue, error) {
+ value, ok := bus.GetParameter(self)
+ if !ok {
+  return nil, &MissingParameterError{self}
+ }
+ if err := key.check(self, value); err != nil {
+  return nil, err
+ }
+ return value, nil
+}
+
+func isMissing(err error) bool {
+ var missing *MissingParameterError
+ return errors.As(err, &missing)
+}
+
+//Invokes fn with the previous and new value whenever the parameter is written, values are nil when the parameter is
+//not defined. Values of the wrong type are reported to the bus's CallbackErrorHandler instead.
+func (key *typedKey) onChange(self config.IParameterKey, bus config.IConfigBus, fn func(old, new config.IParameterValue)) config.IListenerHandle {
+ return bus.AddParameterListener(
+  self,
+  config.PARAMETER_ACCESS_WRITE,
+  func(context config.IListenerContext, prev config.IParameterValue) error {
+   //the value that was written, re-reading the bus could return a later one
+   value := context.Event().Value
+   if err := key.check(self, prev); err != nil {
+    return err
+   }
+   if err := key.check(self, value); err != nil {
+    return err
+   }
+   fn(prev, value)
+   return nil
+  },
+ )
+}
+
+//A key for values of any config.IParameterValue type, ie. your own value types. The built-in value types have
+//dedicated keys that return their underlying Go types, ie. IntKey.
+type TypedKey struct {
+ typedKey
+}
+
+//The values of the key have the type of the prototype
+func NewTypedKey(name string, prototype config.IParameterValue) *TypedKey {
+ if prototype == nil {
+  panic(fmt.Errorf("Cannot create typed key '%s' without a prototype value!\n", name))
+ }
+ return &TypedKey{typedKey{name, reflect.TypeOf(prototype)}}
+}
+
+//The returned value is always of the key's value type, returns a *MissingParameterError if the parameter is not
+//defined and a *TypeMismatchError if it holds a value of another type
+func (key *TypedKey) Get(bus config.IConfigBus) (config.IParameterValue, error) {
+ return key.get(key, bus)
+}
+
+//Returns or if the parameter is not defined
+func (key *TypedKey) GetOr(bus config.IConfigBus, or config.IParameterValue) (config.IParameterValue, error) {
+ value, err := key.Get(bus)
+ if isMissing(err) {
+  return or, nil
+ }
+ return value, err
+}
+
+//Panics with a *TypeMismatchError if the value is of another type
+func (key *TypedKey) Set(bus config.IConfigBus, value config.IParameterValue) {
+ if err := key.check(key, value); err != nil {
+  panic(err)
+ }
+ bus.SetParameter(key, value)
+}
+
+func (key *TypedKey) OnChange(bus config.IConfigBus, fn func(old, new config.IParameterValue)) config.IListenerHandle {
+ return key.onChange(key, bus, fn)
+}
@@ -0,0 +1,482 @@
+package keys
+
+import (
+ "net/url"
+ "reflect"
+ "regexp"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/values"
+)
+
+//Keys for the value types of the values package. Get, GetOr and OnChange return the underlying Go type of the value,
+//the zero value of that type stands in for an undefined parameter.
+
+//A key for values.String parameters
+type StringKey struct {
+ typedKey
+}
+
+func NewStringKey(name string) *StringKey {
+ return &StringKey{typedKey{name, reflect.TypeOf(values.String(""))}}
+}
+
+func (key *StringKey) native(v config.IParameterValue) string {
+ if v == nil {
+  return ""
+ }
+ return string(v.(values.String))
+}
+
+func (key *StringKey) Get(bus config.IConfigBus) (string, error) {
+ value, err := key.get(key, bus)
+ return key.native(value), err
+}
+
+func (key *StringKey) GetOr(bus config.IConfigBus, or string) (string, error) {
+ value, err := key.Get(bus)
+ if isMissing(err) {
+  return or, nil
+ }
+ return value, err
+}
+
+func (key *StringKey) Set(bus config.IConfigBus, value string) {
+ bus.SetParameter(key, values.String(value))
+}
+
+func (key *StringKey) OnChange(bus config.IConfigBus, fn func(old, new string)) config.IListenerHandle {
+ return key.onChange(key, bus, func(old, new config.IParameterValue) {
+  fn(key.native(old), key.native(new))
+ })
+}
+
+//A key for values.Bool parameters
+type BoolKey struct {
+ typedKey
+}
+
+func NewBoolKey(name string) *BoolKey {
+ return &BoolKey{typedKey{name, reflect.TypeOf(values.Bool(false))}}
+}
+
+func (key *BoolKey) native(v config.IParameterValue) bool {
+ if v == nil {
+  return false
+ }
+ return bool(v.(values.Bool))
+}
+
+func (key *BoolKey) Get(bus config.IConfigBus) (bool, error) {
+ value, err := key.get(key, bus)
+ return key.native(value), err
+}
+
+func (key *BoolKey) GetOr(bus config.IConfigBus, or bool) (bool, error) {
+ value, err := key.Get(bus)
+ if isMissing(err) {
+  return or, nil
+ }
+ return value, err
+}
+
+func (key *BoolKey) Set(bus config.IConfigBus, value bool) {
+ bus.SetParameter(key, values.Bool(value))
+}
+
+func (key *BoolKey) OnChange(bus config.IConfigBus, fn func(old, new bool)) config.IListenerHandle {
+ return key.onChange(key, bus, func(old, new config.IParameterValue) {
+  fn(key.native(old), key.native(new))
+ })
+}
+
+//A key for values.Int parameters
+type IntKey struct {
+ typedKey
+}
+
+func NewIntKey(name string) *IntKey {
+ return &IntKey{typedKey{name, reflect.TypeOf(values.Int(0))}}
+}
+
+func (key *IntKey) native(v config.IParameterValue) int64 {
+ if v == nil {
+  return 0
+ }
+ return int64(v.(values.Int))
+}
+
+func (key *IntKey) Get(bus config.IConfigBus) (int64, error) {
+ value, err := key.get(key, bus)
+ return key.native(value), err
+}
+
+func (key *IntKey) GetOr(bus config.IConfigBus, or int64) (int64, error) {
+ value, err := key.Get(bus)
+ if isMissing(err) {
+  return or, nil
+ }
+ return value, err
+}
+
+func (key *IntKey) Set(bus config.IConfigBus, value int64) {
+ bus.SetParameter(key, values.Int(value))
+}
+
+func (key *IntKey) OnChange(bus config.IConfigBus, fn func(old, new int64)) config.IListenerHandle {
+ return key.onChange(key, bus, func(old, new config.IParameterValue) {
+  fn(key.native(old), key.native(new))
+ })
+}
+
+//A key for values.Uint parameters
+type UintKey struct {
+ typedKey
+}
+
+func NewUintKey(name string) *UintKey {
+ return &UintKey{typedKey{name, reflect.TypeOf(values.Uint(0))}}
+}
+
+func (key *UintKey) native(v config.IParameterValue) uint64 {
+ if v == nil {
+  return 0
+ }
+ return uint64(v.(values.Uint))
+}
+
+func (key *UintKey) Get(bus config.IConfigBus) (uint64, error) {
+ value, err := key.get(key, bus)
+ return key.native(value), err
+}
+
+func (key *UintKey) GetOr(bus config.IConfigBus, or uint64) (uint64, error) {
+ value, err := key.Get(bus)
+ if isMissing(err) {
+  return or, nil
+ }
+ return value, err
+}
+
+func (key *UintKey) Set(bus config.IConfigBus, value uint64) {
+ bus.SetParameter(key, values.Uint(value))
+}
+
+func (key *UintKey) OnChange(bus config.IConfigBus, fn func(old, new uint64)) config.IListenerHandle {
+ return key.onChange(key, bus, func(old, new config.IParameterValue) {
+  fn(key.native(old), key.native(new))
+ })
+}
+
+//A key for values.Float parameters
+type FloatKey struct {
+ typedKey
+}
+
+func NewFloatKey(name string) *FloatKey {
+ return &FloatKey{typedKey{name, reflect.TypeOf(values.Float(0))}}
+}
+
+func (key *FloatKey) native(v config.IParameterValue) float64 {
+ if v == nil {
+  return 0
+ }
+ return float64(v.(values.Float))
+}
+
+func (key *FloatKey) Get(bus config.IConfigBus) (float64, error) {
+ value, err := key.get(key, bus)
+ return key.native(value), err
+}
+
+func (key *FloatKey) GetOr(bus config.IConfigBus, or float64) (float64, error) {
+ value, err := key.Get(bus)
+ if isMissing(err) {
+  return or, nil
+ }
+ return value, err
+}
+
+func (key *FloatKey) Set(bus config.IConfigBus, value float64) {
+ bus.SetParameter(key, values.Float(value))
+}
+
+func (key *FloatKey) OnChange(bus config.IConfigBus, fn func(old, new float64)) config.IListenerHandle {
+ return key.onChange(key, bus, func(old, new config.IParameterValue) {
+  fn(key.native(old), key.native(new))
+ })
+}
+
+//A key for values.Duration parameters
+type DurationKey struct {
+ typedKey
+}
+
+func NewDurationKey(name string) *DurationKey {
+ return &DurationKey{typedKey{name, reflect.TypeOf(values.Duration(0))}}
+}
+
+func (key *DurationKey) native(v config.IParameterValue) time.Duration {
+ if v == nil {
+  return 0
+ }
+ return time.Duration(v.(values.Duration))
+}
+
+func (key *DurationKey) Get(bus config.IConfigBus) (time.Duration, error) {
+ value, err := key.get(key, bus)
+ return key.native(value), err
+}
+
+func (key *DurationKey) GetOr(bus config.IConfigBus, or time.Duration) (time.Duration, error) {
+ value, err := key.Get(bus)
+ if isMissing(err) {
+  return or, nil
+ }
+ return value, err
+}
+
+func (key *DurationKey) Set(bus config.IConfigBus, value time.Duration) {
+ bus.SetParameter(key, values.Duration(value))
+}
+
+func (key *DurationKey) OnChange(bus config.IConfigBus, fn func(old, new time.Duration)) config.IListenerHandle {
+ return key.onChange(key, bus, func(old, new config.IParameterValue) {
+  fn(key.native(old), key.native(new))
+ })
+}
+
+//A key for values.Time parameters
+type TimeKey struct {
+ typedKey
+}
+
+func NewTimeKey(name string) *TimeKey {
+ return &TimeKey{typedKey{name, reflect.TypeOf(values.Time{})}}
+}
+
+func (key *TimeKey) native(v config.IParameterValue) time.Time {
+ if v == nil {
+  return time.Time{}
+ }
+ return v.(values.Time).Time
+}
+
+func (key *TimeKey) Get(bus config.IConfigBus) (time.Time, error) {
+ value, err := key.get(key, bus)
+ return key.native(value), err
+}
+
+func (key *TimeKey) GetOr(bus config.IConfigBus, or time.Time) (time.Time, error) {
+ value, err := key.Get(bus)
+ if isMissing(err) {
+  return or, nil
+ }
+ return value, err
+}
+
+func (key *TimeKey) Set(bus config.IConfigBus, value time.Time) {
+ bus.SetParameter(key, values.Time{Time: value})
+}
+
+func (key *TimeKey) OnChange(bus config.IConfigBus, fn func(old, new time.Time)) config.IListenerHandle {
+ return key.onChange(key, bus, func(old, new config.IParameterValue) {
+  fn(key.native(old), key.native(new))
+ })
+}
+
+//A key for values.ByteSize parameters
+type ByteSizeKey struct {
+ typedKey
+}
+
+func NewByteSizeKey(name string) *ByteSizeKey {
+ return &ByteSizeKey{typedKey{name, reflect.TypeOf(values.ByteSize(0))}}
+}
+
+func (key *ByteSizeKey) native(v config.IParameterValue) values.ByteSize {
+ if v == nil {
+  return 0
+ }
+ return v.(values.ByteSize)
+}
+
+func (key *ByteSizeKey) Get(bus config.IConfigBus) (values.ByteSize, error) {
+ value, err := key.get(key, bus)
+ return key.native(value), err
+}
+
+func (key *ByteSizeKey) GetOr(bus config.IConfigBus, or values.ByteSize) (values.ByteSize, error) {
+ value, err := key.Get(bus)
+ if isMissing(err) {
+  return or, nil
+ }
+ return value, err
+}
+
+func (key *ByteSizeKey) Set(bus config.IConfigBus, value values.ByteSize) {
+ bus.SetParameter(key, value)
+}
+
+func (key *ByteSizeKey) OnChange(bus config.IConfigBus, fn func(old, new values.ByteSize)) config.IListenerHandle {
+ return key.onChange(key, bus, func(old, new config.IParameterValue) {
+  fn(key.native(old), key.native(new))
+ })
+}
+
+//A key for values.URL parameters
+type URLKey struct {
+ typedKey
+}
+
+func NewURLKey(name string) *URLKey {
+ return &URLKey{typedKey{name, reflect.TypeOf(values.URL{})}}
+}
+
+func (key *URLKey) native(v config.IParameterValue) *url.URL {
+ if v == nil {
+  return nil
+ }
+ return v.(values.URL).URL
+}
+
+func (key *URLKey) Get(bus config.IConfigBus) (*url.URL, error) {
+ value, err := key.get(key, bus)
+ return key.native(value), err
+}
+
+func (key *URLKey) GetOr(bus config.IConfigBus, or *url.URL) (*url.URL, error) {
+ value, err := key.Get(bus)
+ if isMissing(err) {
+  return or, nil
+ }
+ return value, err
+}
+
+func (key *URLKey) Set(bus config.IConfigBus, value *url.URL) {
+ bus.SetParameter(key, values.URL{URL: value})
+}
+
+func (key *URLKey) OnChange(bus config.IConfigBus, fn func(old, new *url.URL)) config.IListenerHandle {
+ return key.onChange(key, bus, func(old, new config.IParameterValue) {
+  fn(key.native(old), key.native(new))
+ })
+}
+
+//A key for values.Regexp parameters
+type RegexpKey struct {
+ typedKey
+}
+
+func NewRegexpKey(name string) *RegexpKey {
+ return &RegexpKey{typedKey{name, reflect.TypeOf(values.Regexp{})}}
+}
+
+func (key *RegexpKey) native(v config.IParameterValue) *regexp.Regexp {
+ if v == nil {
+  return nil
+ }
+ return v.(values.Regexp).Regexp
+}
+
+func (key *RegexpKey) Get(bus config.IConfigBus) (*regexp.Regexp, error) {
+ value, err := key.get(key, bus)
+ return key.native(value), err
+}
+
+func (key *RegexpKey) GetOr(bus config.IConfigBus, or *regexp.Regexp) (*regexp.Regexp, error) {
+ value, err := key.Get(bus)
+ if isMissing(err) {
+  return or, nil
+ }
+ return value, err
+}
+
+func (key *RegexpKey) Set(bus config.IConfigBus, value *regexp.Regexp) {
+ bus.SetParameter(key, values.Regexp{Regexp: value})
+}
+
+func (key *RegexpKey) OnChange(bus config.IConfigBus, fn func(old, new *regexp.Regexp)) config.IListenerHandle {
+ return key.onChange(key, bus, func(old, new config.IParameterValue) {
+  fn(key.native(old), key.native(new))
+ })
+}
+
+//A key for values.StringList parameters
+type StringListKey struct {
+ typedKey
+}
+
+func NewStringListKey(name string) *StringListKey {
+ return &StringListKey{typedKey{name, reflect.TypeOf(values.StringList(nil))}}
+}
+
+func (key *StringListKey) native(v config.IParameterValue) []string {
+ if v == nil {
+  return nil
+ }
+ return []string(v.(values.StringList))
+}
+
+func (key *StringListKey) Get(bus config.IConfigBus) ([]string, error) {
+ value, err := key.get(key, bus)
+ return key.native(value), err
+}
+
+func (key *StringListKey) GetOr(bus config.IConfigBus, or []string) ([]string, error) {
+ value, err := key.Get(bus)
+ if isMissing(err) {
+  return or, nil
+ }
+ return value, err
+}
+
+func (key *StringListKey) Set(bus config.IConfigBus, value []string) {
+ bus.SetParameter(key, values.StringList(value))
+}
+
+func (key *StringListKey) OnChange(bus config.IConfigBus, fn func(old, new []string)) config.IListenerHandle {
+ return key.onChange(key, bus, func(old, new config.IParameterValue) {
+  fn(key.native(old), key.native(new))
+ })
+}
+
+//A key for values.StringMap parameters
+type StringMapKey struct {
+ typedKey
+}
+
+func NewStringMapKey(name string) *StringMapKey {
+ return &StringMapKey{typedKey{name, reflect.TypeOf(values.StringMap(nil))}}
+}
+
+func (key *StringMapKey) native(v config.IParameterValue) map[string]string {
+ if v == nil {
+  return nil
+ }
+ return map[string]string(v.(values.StringMap))
+}
+
+func (key *StringMapKey) Get(bus config.IConfigBus) (map[string]string, error) {
+ value, err := key.get(key, bus)
+ return key.native(value), err
+}
+
+func (key *StringMapKey) GetOr(bus config.IConfigBus, or map[string]string) (map[string]string, error) {
+ value, err := key.Get(bus)
+ if isMissing(err) {
+  return or, nil
+ }
+ return value, err
+}
+
+func (key *StringMapKey) Set(bus config.IConfigBus, value map[string]string) {
+ bus.SetParameter(key, values.StringMap(value))
+}
+
+func (key *StringMapKey) OnChange(bus config.IConfigBus, fn func(old, new map[string]string)) config.IListenerHandle {
+ return key.onChange(key, bus, func(old, new config.IParameterValue) {
+  fn(key.native(old), key.native(new))
+ })
+}
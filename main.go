@@ -1,8 +1,6 @@
 package go_figure
 
 import (
- "fmt"
-
  "github.com/Matthewacon/go-figure/config"
  "github.com/Matthewacon/go-figure/internal"
 )
@@ -13,8 +11,25 @@ func NewSynchronousConfig(env config.IEnvironment) config.IConfigBus {
  return cfg
 }
 
-//TODO
-func NewAsynchronousConfig(env config.IEnvironment) config.IConfigBus {
- panic(fmt.Errorf("unimplemented!\n"))
- return nil
+func NewAsynchronousConfig(env config.IEnvironment) config.IAsynchronousConfigBus {
+ cfg := internal.NewAsynchronousConfigBus()
+ env.SetConfig(cfg)
+ return cfg
+}
+
+//Creates a layered config bus with the given layers, lowest precedence first. Without any layers, the bus stacks
+//config.LAYER_DEFAULTS, LAYER_FILE, LAYER_ENVIRONMENT, LAYER_FLAGS and LAYER_OVERRIDES.
+func NewLayeredConfig(env config.IEnvironment, layers ...string) config.ILayeredConfigBus {
+ if len(layers) == 0 {
+  layers = []string{
+   config.LAYER_DEFAULTS,
+   config.LAYER_FILE,
+   config.LAYER_ENVIRONMENT,
+   config.LAYER_FLAGS,
+   config.LAYER_OVERRIDES,
+  }
+ }
+ cfg := internal.NewLayeredConfigBus(layers...)
+ env.SetConfig(cfg)
+ return cfg
 }
@@ -0,0 +1,81 @@
+package match
+
+import (
+ "fmt"
+ "path"
+ "reflect"
+ "strings"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//Common config.IKeyMatcher implementations for IConfigBus.AddGroupListener. Keys are matched by name, the name of a
+//key is its String().
+
+type keyMatcher struct {
+ name  string
+ match func(key config.IParameterKey) bool
+}
+
+func (matcher *keyMatcher) Match(key config.IParameterKey) bool {
+ return matcher.match(key)
+}
+
+func (matcher *keyMatcher) String() string {
+ return matcher.name
+}
+
+//Selects the keys accepted by an arbitrary predicate, the name describes the selected keys
+func Func(name string, predicate func(key config.IParameterKey) bool) config.IKeyMatcher {
+ if predicate == nil {
+  panic(fmt.Errorf("Cannot match keys with a nil predicate!\n"))
+ }
+ return &keyMatcher{name, predicate}
+}
+
+//Selects the keys whose name starts with the prefix, ie. Prefix("sql.") selects "sql.host" and "sql.pool.size"
+func Prefix(prefix string) config.IKeyMatcher {
+ return Func(prefix + "*", func(key config.IParameterKey) bool {
+  return strings.HasPrefix(key.String(), prefix)
+ })
+}
+
+//Selects the keys whose name matches the shell pattern, see path.Match. Since keys are not paths, '*' matches any
+//sequence of characters other than '/', dots included.
+func Glob(pattern string) (config.IKeyMatcher, error) {
+ if _, err := path.Match(pattern, ""); err != nil {
+  return nil, fmt.Errorf("Invalid key pattern '%s': %s\n", pattern, err.Error())
+ }
+ return Func(pattern, func(key config.IParameterKey) bool {
+  matched, _ := path.Match(pattern, key.String())
+  return matched
+ }), nil
+}
+
+//Selects the keys that have the same Go type as the prototype, ie. Type(metrics.IntKeyValue(0)) selects every
+//metrics.IntKeyValue
+func Type(prototype config.IParameterKey) config.IKeyMatcher {
+ if prototype == nil {
+  panic(fmt.Errorf("Cannot match keys by the type of a nil prototype!\n"))
+ }
+ keyType := reflect.TypeOf(prototype)
+ return Func(keyType.String(), func(key config.IParameterKey) bool {
+  return reflect.TypeOf(key) == keyType
+ })
+}
+
+//Selects the keys that any of the matchers select
+func Any(matchers ...config.IKeyMatcher) config.IKeyMatcher {
+ names := make([]string, len(matchers))
+ for i, matcher := range matchers {
+  names[i] = matcher.String()
+ }
+ return Func(strings.Join(names, "|"), func(key config.IParameterKey) bool {
+  for _, matcher := range matchers {
+   if matcher.Match(key) {
+    return true
+   }
+  }
+  return false
+ })
+}
@@ -0,0 +1,227 @@
+package metadata
+
+import (
+ "fmt"
+ "log"
+ "os"
+ "sync"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//Returned when a strict registry resolves a key that was never declared
+type UndeclaredKeyError struct {
+ Key config.IParameterKey
+}
+
+func (err *UndeclaredKeyError) Error() string {
+ return fmt.Sprintf("Key [%v] is not declared!\n", err.Key.Key())
+}
+
+//Returned when a key is resolved in an environment it is not allowed in
+type EnvironmentError struct {
+ Key         config.IParameterKey
+ Environment string
+ Allowed     []string
+}
+
+func (err *EnvironmentError) Error() string {
+ return fmt.Sprintf(
+  "Key [%v] may not be used in environment '%s', allowed environments: %v!\n",
+  err.Key.Key(),
+  err.Environment,
+  err.Allowed,
+ )
+}
+
+//Returned when the replacements of deprecated keys loop back on themselves
+type ReplacementCycleError struct {
+ Key config.IParameterKey
+}
+
+func (err *ReplacementCycleError) Error() string {
+ return fmt.Sprintf("Replacements of deprecated key [%v] form a cycle!\n", err.Key.Key())
+}
+
+//Central declarations of parameter keys, install it on a bus with IConfigBus.SetKeyRegistry. Accesses of deprecated
+//keys are forwarded to their replacement and logged once per key. Safe for concurrent use.
+type Registry struct {
+ mutex    sync.RWMutex
+ declared map[config.IParameterKey]*config.KeyMetadata
+ warned   map[config.IParameterKey]bool
+ logger   config.ILogger
+ //reject undeclared keys
+ strict      bool
+ environment string
+}
+
+//Logs to stderr until another logger is set
+func NewRegistry() *Registry {
+ return &Registry{
+  declared: map[config.IParameterKey]*config.KeyMetadata{},
+  warned: map[config.IParameterKey]bool{},
+  logger: log.New(os.Stderr, "go-figure: ", log.LstdFlags),
+ }
+}
+
+//Panics if the key is nil or already declared
+func (registry *Registry) Declare(metadata config.KeyMetadata) {
+ if metadata.Key == nil {
+  panic(fmt.Errorf("Cannot declare a nil key!\n"))
+ }
+ registry.mutex.Lock()
+ defer registry.mutex.Unlock()
+ if _, ok := registry.declared[metadata.Key]; ok {
+  panic(fmt.Errorf("Key [%v] is already declared!\n", metadata.Key.Key()))
+ }
+ metadata.Environments = append([]string(nil), metadata.Environments...)
+ registry.declared[metadata.Key] = &metadata
+}
+
+func (registry *Registry) Lookup(key config.IParameterKey) (config.KeyMetadata, bool) {
+ registry.mutex.RLock()
+ defer registry.mutex.RUnlock()
+ if metadata, ok := registry.declared[key]; ok {
+  return *metadata, true
+ }
+ return config.KeyMetadata{}, false
+}
+
+//Returns every declared key, in no particular order
+func (registry *Registry) Keys() []config.IParameterKey {
+ registry.mutex.RLock()
+ defer registry.mutex.RUnlock()
+ keys := make([]config.IParameterKey, 0, len(registry.declared))
+ for key := range registry.declared {
+  keys = append(keys, key)
+ }
+ return keys
+}
+
+//A nil logger discards deprecation warnings
+func (registry *Registry) SetLogger(logger config.ILogger) config.ILogger {
+ registry.mutex.Lock()
+ defer registry.mutex.Unlock()
+ prev := registry.logger
+ registry.logger = logger
+ return prev
+}
+
+//Whether undeclared keys are rejected with an *UndeclaredKeyError
+func (registry *Registry) SetStrict(strict bool) bool {
+ registry.mutex.Lock()
+ defer registry.mutex.Unlock()
+ prev := registry.strict
+ registry.strict = strict
+ return prev
+}
+
+//Sets the name of the environment the registry resolves keys for, ie. IEnvironment.String(). Keys that declare
+//their environments are rejected with an *EnvironmentError everywhere else, an empty name allows every key.
+func (registry *Registry) SetEnvironment(name string) string {
+ registry.mutex.Lock()
+ defer registry.mutex.Unlock()
+ prev := registry.environment
+ registry.environment = name
+ return prev
+}
+
+//config.IKeyRegistry
+func (registry *Registry) Resolve(key config.IParameterKey) (config.IParameterKey, error) {
+ registry.mutex.RLock()
+ metadata, ok := registry.declared[key]
+ if !ok {
+  strict := registry.strict
+  registry.mutex.RUnlock()
+  if strict {
+   return nil, &UndeclaredKeyError{key}
+  }
+  return key, nil
+ }
+ var deprecated []*config.KeyMetadata
+ for metadata.ReplacedBy != nil {
+  //every key is visited at most once, unless the replacements loop
+  if len(deprecated) > len(registry.declared) {
+   registry.mutex.RUnlock()
+   return nil, &ReplacementCycleError{key}
+  }
+  deprecated = append(deprecated, metadata)
+  replacement, ok := registry.declared[metadata.ReplacedBy]
+  if !ok {
+   //undeclared replacements are accepted, they are what the declaration asks for
+   metadata = &config.KeyMetadata{Key: metadata.ReplacedBy}
+   break
+  }
+  metadata = replacement
+ }
+ if metadata.Deprecated() {
+  deprecated = append(deprecated, metadata)
+ }
+ err := registry.checkEnvironment(metadata)
+ registry.mutex.RUnlock()
+ if err != nil {
+  return nil, err
+ }
+ registry.warn(deprecated)
+ return metadata.Key, nil
+}
+
+//Must be called while holding the mutex
+func (registry *Registry) checkEnvironment(metadata *config.KeyMetadata) error {
+ if registry.environment == "" || len(metadata.Environments) == 0 {
+  return nil
+ }
+ for _, environment := range metadata.Environments {
+  if environment == registry.environment {
+   return nil
+  }
+ }
+ return &EnvironmentError{metadata.Key, registry.environment, metadata.Environments}
+}
+
+//Logs every deprecated key that has not been logged before
+func (registry *Registry) warn(deprecated []*config.KeyMetadata) {
+ if len(deprecated) == 0 {
+  return
+ }
+ registry.mutex.Lock()
+ logger := registry.logger
+ var toLog []*config.KeyMetadata
+ for _, metadata := range deprecated {
+  if !registry.warned[metadata.Key] {
+   registry.warned[metadata.Key] = true
+   toLog = append(toLog, metadata)
+  }
+ }
+ registry.mutex.Unlock()
+ if logger == nil {
+  return
+ }
+ for _, metadata := range toLog {
+  message := fmt.Sprintf("Key [%v] is deprecated", metadata.Key.Key())
+  if metadata.ReplacedBy != nil {
+   message += fmt.Sprintf(", use [%v] instead", metadata.ReplacedBy.Key())
+  }
+  if metadata.Deprecation != "" {
+   message += ": " + metadata.Deprecation
+  }
+  logger.Printf("%s\n", message)
+ }
+}
+
+//sources.ISource, loads the declared defaults of every key that is not deprecated
+func (registry *Registry) Load() (config.Parameters, error) {
+ registry.mutex.RLock()
+ defer registry.mutex.RUnlock()
+ params := config.Parameters{}
+ for key, metadata := range registry.declared {
+  if metadata.Default != nil && !metadata.Deprecated() {
+   params[key] = metadata.Default
+  }
+ }
+ return params, nil
+}
+
+func (registry *Registry) String() string {
+ return "key metadata registry"
+}
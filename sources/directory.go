@@ -0,0 +1,66 @@
+package sources
+
+import (
+ "io/ioutil"
+ "os"
+ "path/filepath"
+ "strings"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//Loads registered parameters from a directory with one file per parameter, named after the parameter, ie. a
+//Kubernetes ConfigMap or Secret volume. Files are decoded as text with surrounding whitespace trimmed; hidden files,
+//such as the '..data' symlink of a ConfigMap mount, and files of unregistered parameters are skipped.
+type DirectorySource struct {
+ Path     string
+ Registry *Registry
+}
+
+func NewDirectorySource(path string, registry *Registry) *DirectorySource {
+ return &DirectorySource{path, registry}
+}
+
+//ISource
+func (src *DirectorySource) Load() (config.Parameters, error) {
+ entries, err := ioutil.ReadDir(src.Path)
+ if err != nil {
+  return nil, err
+ }
+ params := config.Parameters{}
+ for _, entry := range entries {
+  name := entry.Name()
+  if strings.HasPrefix(name, ".") {
+   continue
+  }
+  binding, ok := src.Registry.Lookup(name)
+  if !ok {
+   continue
+  }
+  path := filepath.Join(src.Path, name)
+  //follows symlinks, ConfigMap entries link into the '..data' directory
+  if info, err := os.Stat(path); err != nil || info.IsDir() {
+   continue
+  }
+  data, err := ioutil.ReadFile(path)
+  if err != nil {
+   return nil, err
+  }
+  raw := strings.TrimSpace(string(data))
+  value, err := binding.Decoder(raw)
+  if err != nil {
+   return nil, &DecodeError{path, raw, err}
+  }
+  params[binding.Key] = value
+ }
+ return params, nil
+}
+
+//Returns the directory the source reads, see watch.IWatchable
+func (src *DirectorySource) WatchPaths() []string {
+ return []string{src.Path}
+}
+
+func (src *DirectorySource) String() string {
+ return "directory (" + src.Path + ")"
+}
@@ -0,0 +1,73 @@
+package sources
+
+import (
+ "os"
+ "strings"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//Loads registered parameters from environment variables. The variable name of a parameter is derived from its
+//registered name: separators ('.', '-' and ' ') are replaced with underscores, the result is upper cased and joined
+//to the prefix, ie. parameter 'sql.max_connections' with prefix 'MYAPP' is read from 'MYAPP_SQL_MAX_CONNECTIONS'.
+type EnvironmentSource struct {
+ Prefix   string
+ Registry *Registry
+ //Returns the environment in the form "key=value", defaults to os.Environ
+ Environ func() []string
+}
+
+func NewEnvironmentSource(prefix string, registry *Registry) *EnvironmentSource {
+ return &EnvironmentSource{
+  Prefix: prefix,
+  Registry: registry,
+  Environ: os.Environ,
+ }
+}
+
+var variableNameReplacer = strings.NewReplacer(".", "_", "-", "_", " ", "_")
+
+//Returns the environment variable that the named parameter is read from
+func (src *EnvironmentSource) VariableName(name string) string {
+ variable := strings.ToUpper(variableNameReplacer.Replace(name))
+ if src.Prefix != "" {
+  variable = strings.TrimSuffix(src.Prefix, "_") + "_" + variable
+ }
+ return variable
+}
+
+//ISource
+//Variables that are not set are skipped, variables that are set but empty are decoded like any other value
+func (src *EnvironmentSource) Load() (config.Parameters, error) {
+ environ := os.Environ
+ if src.Environ != nil {
+  environ = src.Environ
+ }
+ variables := map[string]string{}
+ for _, variable := range environ() {
+  if i := strings.IndexByte(variable, '='); i > 0 {
+   variables[variable[:i]] = variable[i + 1:]
+  }
+ }
+ params := config.Parameters{}
+ for _, binding := range src.Registry.Bindings() {
+  name := src.VariableName(binding.Name)
+  raw, ok := variables[name]
+  if !ok {
+   continue
+  }
+  value, err := binding.Decoder(raw)
+  if err != nil {
+   return nil, &DecodeError{name, raw, err}
+  }
+  params[binding.Key] = value
+ }
+ return params, nil
+}
+
+func (src *EnvironmentSource) String() string {
+ if src.Prefix == "" {
+  return "environment"
+ }
+ return "environment (" + strings.TrimSuffix(src.Prefix, "_") + "_*)"
+}
@@ -0,0 +1,156 @@
+package sources
+
+import (
+ "flag"
+ "fmt"
+ "reflect"
+ "strings"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//Binds registered parameters to command-line flags. Flag names are derived from the registered names, see FlagName;
+//keys that implement config.IDescribedKey provide the usage of their flag, and keys that implement
+//config.IDefaultedKey provide its default. Flags of boolean parameters may be passed without a value. Load only
+//returns the flags that were explicitly set, so passing '--sql-max-connections 32' can be told apart from its default,
+//see Defaults and IsSet.
+type FlagSource struct {
+ FlagSet  *flag.FlagSet
+ Registry *Registry
+ //flag name -> flag
+ flags map[string]*parameterFlag
+}
+
+//flag.Value
+type parameterFlag struct {
+ *Binding
+ value config.IParameterValue
+ set   bool
+}
+
+func (f *parameterFlag) Set(raw string) error {
+ value, err := f.Decoder(raw)
+ if err != nil {
+  return err
+ }
+ f.value, f.set = value, true
+ return nil
+}
+
+func (f *parameterFlag) String() string {
+ //the flag package calls String on zero values
+ if f == nil || f.value == nil {
+  return ""
+ }
+ return f.value.String()
+}
+
+//Flags of boolean parameters may be passed without a value, ie. '--verbose'
+type boolParameterFlag struct {
+ *parameterFlag
+}
+
+func (f boolParameterFlag) IsBoolFlag() bool {
+ return true
+}
+
+//Implemented by keys whose values have a single type, ie. the keys of the keys package
+type valueTypedKey interface {
+ ValueType() reflect.Type
+}
+
+//Parameters are boolean if the values of their key are, keys without a value type are boolean if their default is
+func isBoolParameter(key config.IParameterKey, def config.IParameterValue) bool {
+ if typed, ok := key.(valueTypedKey); ok && typed.ValueType() != nil {
+  return typed.ValueType().Kind() == reflect.Bool
+ }
+ if def != nil {
+  _, ok := def.Value().(bool)
+  return ok
+ }
+ return false
+}
+
+var flagNameReplacer = strings.NewReplacer(".", "-", "_", "-", " ", "-")
+
+//Returns the flag name of the named parameter, ie. 'sql.max_connections' is bound to '--sql-max-connections'
+func FlagName(name string) string {
+ return strings.ToLower(flagNameReplacer.Replace(name))
+}
+
+//Defines a flag on the flag set for every given key, or for every registered parameter if no keys are given. Panics
+//if a key is not registered or if its flag is already defined, like flag.FlagSet.Var.
+func NewFlagSource(flagSet *flag.FlagSet, registry *Registry, keys ...config.IParameterKey) *FlagSource {
+ src := &FlagSource{flagSet, registry, map[string]*parameterFlag{}}
+ var bindings []*Binding
+ if len(keys) == 0 {
+  bindings = registry.Bindings()
+ }
+ for _, key := range keys {
+  binding, ok := registry.LookupKey(key)
+  if !ok {
+   panic(&UnregisteredKeyError{key})
+  }
+  bindings = append(bindings, binding)
+ }
+ for _, binding := range bindings {
+  src.bind(binding)
+ }
+ return src
+}
+
+func (src *FlagSource) bind(binding *Binding) {
+ name := FlagName(binding.Name)
+ f := &parameterFlag{Binding: binding}
+ usage := fmt.Sprintf("Sets parameter '%s'", binding.Name)
+ if described, ok := binding.Key.(config.IDescribedKey); ok {
+  usage = described.Description()
+ }
+ if defaulted, ok := binding.Key.(config.IDefaultedKey); ok {
+  f.value = defaulted.Default()
+ }
+ var value flag.Value = f
+ if isBoolParameter(binding.Key, f.value) {
+  value = boolParameterFlag{f}
+ }
+ src.FlagSet.Var(value, name, usage)
+ src.flags[name] = f
+}
+
+//ISource
+//Returns the parameters of the flags that were explicitly set, call after parsing the flag set
+func (src *FlagSource) Load() (config.Parameters, error) {
+ params := config.Parameters{}
+ for _, f := range src.flags {
+  if f.set {
+   params[f.Key] = f.value
+  }
+ }
+ return params, nil
+}
+
+//Returns the defaults of the bound keys that implement config.IDefaultedKey, ie. for the defaults layer of a layered
+//config bus
+func (src *FlagSource) Defaults() config.Parameters {
+ params := config.Parameters{}
+ for _, f := range src.flags {
+  if defaulted, ok := f.Key.(config.IDefaultedKey); ok && defaulted.Default() != nil {
+   params[f.Key] = defaulted.Default()
+  }
+ }
+ return params
+}
+
+//Reports whether the flag of the key was explicitly set
+func (src *FlagSource) IsSet(key config.IParameterKey) bool {
+ for _, f := range src.flags {
+  if f.Key == key {
+   return f.set
+  }
+ }
+ return false
+}
+
+func (src *FlagSource) String() string {
+ return "flags (" + src.FlagSet.Name() + ")"
+}
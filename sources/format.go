@@ -0,0 +1,90 @@
+package sources
+
+import (
+ "fmt"
+ "io/ioutil"
+ "path/filepath"
+ "strings"
+ "sync"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//Interface type for configuration file formats
+type IFormat interface {
+ //Parses a document into a tree of map[string]interface{}, []interface{} and scalar values, see DecodeTree
+ Decode(data []byte) (map[string]interface{}, error)
+ String() string
+}
+
+var (
+ formatMutex sync.RWMutex
+ formats = map[string]IFormat{}
+)
+
+//Associates a file extension, ie. ".yaml", with a format for NewFileSource. Registering an extension again replaces
+//its format.
+func RegisterFormat(extension string, format IFormat) {
+ formatMutex.Lock()
+ defer formatMutex.Unlock()
+ formats[strings.ToLower(extension)] = format
+}
+
+//Returns the format registered for the extension of the path
+func FormatFor(path string) (IFormat, bool) {
+ formatMutex.RLock()
+ defer formatMutex.RUnlock()
+ format, ok := formats[strings.ToLower(filepath.Ext(path))]
+ return format, ok
+}
+
+func init() {
+ RegisterFormat(".json", JSON)
+ RegisterFormat(".yaml", YAML)
+ RegisterFormat(".yml", YAML)
+ RegisterFormat(".toml", TOML)
+}
+
+//Loads registered parameters from a configuration file, see DecodeTree for how nested tables are mapped to parameter
+//names
+type FileSource struct {
+ Path     string
+ Format   IFormat
+ Registry *Registry
+}
+
+//Picks the format of the file from its extension, see RegisterFormat
+func NewFileSource(path string, registry *Registry) (*FileSource, error) {
+ format, ok := FormatFor(path)
+ if !ok {
+  return nil, fmt.Errorf("No format is registered for configuration file '%s'!\n", path)
+ }
+ return &FileSource{path, format, registry}, nil
+}
+
+//ISource
+func (src *FileSource) Load() (config.Parameters, error) {
+ data, err := ioutil.ReadFile(src.Path)
+ if err != nil {
+  return nil, err
+ }
+ return Decode(src.Format, src.Registry, data)
+}
+
+//Returns the file the source reads, see watch.IWatchable
+func (src *FileSource) WatchPaths() []string {
+ return []string{src.Path}
+}
+
+func (src *FileSource) String() string {
+ return src.Format.String() + " (" + src.Path + ")"
+}
+
+//Parses a document with the given format and decodes its registered parameters
+func Decode(format IFormat, registry *Registry, data []byte) (config.Parameters, error) {
+ tree, err := format.Decode(data)
+ if err != nil {
+  return nil, err
+ }
+ return DecodeTree(registry, tree)
+}
@@ -0,0 +1,56 @@
+package sources
+
+import (
+ "bytes"
+ "encoding/json"
+ "fmt"
+ "io"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//JSON documents, numbers are decoded as json.Number so integers are never rounded through a float64
+var JSON IFormat = jsonFormat{}
+
+type jsonFormat struct{}
+
+func (jsonFormat) Decode(data []byte) (map[string]interface{}, error) {
+ decoder := json.NewDecoder(bytes.NewReader(data))
+ decoder.UseNumber()
+ tree := map[string]interface{}{}
+ if err := decoder.Decode(&tree); err != nil {
+  return nil, fmt.Errorf("Failed to parse JSON document:\n%s\n", err.Error())
+ }
+ //the document is a single object, anything but whitespace after it is rejected
+ var trailing json.RawMessage
+ switch err := decoder.Decode(&trailing); err {
+ case io.EOF:
+  return tree, nil
+ case nil:
+  return nil, fmt.Errorf("JSON syntax error: unexpected data after the document!\n")
+ default:
+  return nil, fmt.Errorf("Failed to parse JSON document:\n%s\n", err.Error())
+ }
+}
+
+func (jsonFormat) String() string {
+ return "json"
+}
+
+func NewJSONSource(path string, registry *Registry) *FileSource {
+ return &FileSource{path, JSON, registry}
+}
+
+func DecodeJSON(registry *Registry, data []byte) (config.Parameters, error) {
+ return Decode(JSON, registry, data)
+}
+
+//Exports parameters, ie. the result of IConfigBus.GetParameters, as an indented JSON document that DecodeJSON reads
+//back into the same parameters
+func ExportJSON(registry *Registry, params config.Parameters) ([]byte, error) {
+ tree, err := EncodeTree(registry, params)
+ if err != nil {
+  return nil, err
+ }
+ return json.MarshalIndent(tree, "", " ")
+}
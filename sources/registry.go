@@ -0,0 +1,149 @@
+package sources
+
+import (
+ "encoding"
+ "fmt"
+ "reflect"
+ "sort"
+ "sync"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//Builds a parameter value from the raw representation of a parameter in a configuration source
+type Decoder func(raw interface{}) (config.IParameterValue, error)
+
+//Converts a parameter value back into its raw representation for exporting, the inverse of a Decoder
+type Encoder func(value config.IParameterValue) (interface{}, error)
+
+//Adapts a decoder for textual sources, such as environment variables, to a Decoder
+func TextDecoder(decode func(raw string) (config.IParameterValue, error)) Decoder {
+ return func(raw interface{}) (config.IParameterValue, error) {
+  switch raw := raw.(type) {
+  case string:
+   return decode(raw)
+  case time.Time:
+   return decode(raw.Format(time.RFC3339Nano))
+  case fmt.Stringer:
+   return decode(raw.String())
+  case map[string]interface{}, []interface{}, nil:
+   return nil, fmt.Errorf("Expected a textual value, received: %T\n", raw)
+  default:
+   return decode(fmt.Sprint(raw))
+  }
+ }
+}
+
+//Associates the name of a parameter in configuration sources with its key and codec
+type Binding struct {
+ Name string
+ Key  config.IParameterKey
+ Decoder
+ //Optional, see Encode for how values are exported without an encoder
+ Encoder
+}
+
+//Encodes the value with the binding's encoder. Without an encoder, values whose Value() is a bool, string or number of
+//a predeclared Go type are exported as is and any other value as its text, from encoding.TextMarshaler or String(),
+//so a text decoder reads it back.
+func (binding *Binding) Encode(value config.IParameterValue) (interface{}, error) {
+ if binding.Encoder != nil {
+  return binding.Encoder(value)
+ }
+ if raw := value.Value(); isNativeScalar(raw) {
+  return raw, nil
+ }
+ if marshaler, ok := value.(encoding.TextMarshaler); ok {
+  text, err := marshaler.MarshalText()
+  if err != nil {
+   return nil, err
+  }
+  return string(text), nil
+ }
+ return value.String(), nil
+}
+
+//Named types, ie. time.Duration, are not native even if their kind is, their numbers don't mean anything to decoders
+func isNativeScalar(raw interface{}) bool {
+ if raw == nil {
+  return false
+ }
+ t := reflect.TypeOf(raw)
+ if t.PkgPath() != "" {
+  return false
+ }
+ switch t.Kind() {
+ case reflect.Bool, reflect.String,
+  reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+  reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+  reflect.Float32, reflect.Float64:
+  return true
+ default:
+  return false
+ }
+}
+
+//Resolves parameter names, as they appear in configuration sources, to registered keys. Safe for concurrent use.
+type Registry struct {
+ mutex sync.RWMutex
+ names map[string]*Binding
+ keys  map[config.IParameterKey]*Binding
+}
+
+func NewRegistry() *Registry {
+ return &Registry{
+  names: map[string]*Binding{},
+  keys: map[config.IParameterKey]*Binding{},
+ }
+}
+
+//Panics if the name or key is already registered
+func (registry *Registry) Register(name string, key config.IParameterKey, decoder Decoder) *Binding {
+ return registry.RegisterCodec(name, key, decoder, nil)
+}
+
+//Like Register, with an encoder for exporting the parameter
+func (registry *Registry) RegisterCodec(name string, key config.IParameterKey, decoder Decoder, encoder Encoder) *Binding {
+ if decoder == nil {
+  panic(fmt.Errorf("Cannot register parameter '%s' without a decoder!\n", name))
+ }
+ registry.mutex.Lock()
+ defer registry.mutex.Unlock()
+ if _, ok := registry.names[name]; ok {
+  panic(fmt.Errorf("Parameter '%s' is already registered!\n", name))
+ }
+ if existing, ok := registry.keys[key]; ok {
+  panic(fmt.Errorf("Key [%v] is already registered as parameter '%s'!\n", key.Key(), existing.Name))
+ }
+ binding := &Binding{name, key, decoder, encoder}
+ registry.names[name] = binding
+ registry.keys[key] = binding
+ return binding
+}
+
+func (registry *Registry) Lookup(name string) (*Binding, bool) {
+ registry.mutex.RLock()
+ defer registry.mutex.RUnlock()
+ binding, ok := registry.names[name]
+ return binding, ok
+}
+
+func (registry *Registry) LookupKey(key config.IParameterKey) (*Binding, bool) {
+ registry.mutex.RLock()
+ defer registry.mutex.RUnlock()
+ binding, ok := registry.keys[key]
+ return binding, ok
+}
+
+//Returns all bindings, sorted by name
+func (registry *Registry) Bindings() []*Binding {
+ registry.mutex.RLock()
+ bindings := make([]*Binding, 0, len(registry.names))
+ for _, binding := range registry.names {
+  bindings = append(bindings, binding)
+ }
+ registry.mutex.RUnlock()
+ sort.Slice(bindings, func(i, j int) bool { return bindings[i].Name < bindings[j].Name })
+ return bindings
+}
@@ -0,0 +1,64 @@
+package sources
+
+import (
+ "fmt"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//Interface type for configuration sources
+type ISource interface {
+ //Reads the source and returns the parameters it defines
+ Load() (config.Parameters, error)
+ String() string
+}
+
+//Returned when a parameter could not be decoded from a source
+type DecodeError struct {
+ //The name of the parameter within the source, ie. an environment variable name
+ Name string
+ Raw  interface{}
+ Err  error
+}
+
+func (err *DecodeError) Error() string {
+ return fmt.Sprintf("Failed to decode parameter '%s' from '%v':\n%s\n", err.Name, err.Raw, err.Err.Error())
+}
+
+func (err *DecodeError) Unwrap() error {
+ return err.Err
+}
+
+//Anything that parameters can be applied to, ie. a config.IConfigBus or a config.IConfigLayer
+type IParameterSink interface {
+ TrySetParameters(params map[config.IParameterKey]config.IParameterValue) error
+}
+
+//Loads the source and applies its parameters to the bus with a single call to TrySetParameters, so the WRITE
+//listeners of every loaded parameter fire. Writes to a config.IConfigBus carry the String() of the source as their
+//origin. Nothing is applied if the source fails to load, or if a validator rejects any of its parameters.
+func Apply(bus IParameterSink, source ISource) error {
+ params, err := source.Load()
+ if err != nil {
+  return err
+ }
+ if cfg, ok := bus.(config.IConfigBus); ok {
+  bus = cfg.WithOrigin(config.WriteOrigin{Source: source.String()})
+ }
+ if len(params) > 0 {
+  return bus.TrySetParameters(params)
+ }
+ return nil
+}
+
+//Returns the loaded parameters that are missing from the current parameters or have a different value, see
+//config.ValuesEqual
+func Changed(current, loaded config.Parameters) config.Parameters {
+ changed := config.Parameters{}
+ for key, value := range loaded {
+  if prev, ok := current[key]; !ok || !config.ValuesEqual(prev, value) {
+   changed[key] = value
+  }
+ }
+ return changed
+}
@@ -0,0 +1,592 @@
+package sources
+
+import (
+ "fmt"
+ "math"
+ "regexp"
+ "strconv"
+ "strings"
+ "time"
+ "unicode/utf8"
+)
+
+//TOML v1.0.0 documents. Integers are decoded as int64, floats as float64 and date-times, local date-times, local
+//dates and local times as time.Time.
+var TOML IFormat = tomlFormat{}
+
+type tomlFormat struct{}
+
+func (tomlFormat) Decode(data []byte) (map[string]interface{}, error) {
+ parser := &tomlParser{data: string(data), root: &tomlTable{values: map[string]interface{}{}}}
+ if err := parser.parseDocument(); err != nil {
+  return nil, err
+ }
+ return parser.root.tree(), nil
+}
+
+func (tomlFormat) String() string {
+ return "toml"
+}
+
+//A table while the document is being parsed, tracks how the table was defined to reject redefinitions
+type tomlTable struct {
+ //*tomlTable, *tomlTableArray or values
+ values map[string]interface{}
+ //defined by a [table] header
+ header bool
+ //defined by a dotted key
+ dotted bool
+ //inline tables are immutable
+ inline bool
+}
+
+type tomlTableArray []*tomlTable
+
+func (table *tomlTable) tree() map[string]interface{} {
+ tree := make(map[string]interface{}, len(table.values))
+ for key, value := range table.values {
+  tree[key] = tomlTree(value)
+ }
+ return tree
+}
+
+func tomlTree(value interface{}) interface{} {
+ switch value := value.(type) {
+ case *tomlTable:
+  return value.tree()
+ case *tomlTableArray:
+  tables := make([]interface{}, len(*value))
+  for i, table := range *value {
+   tables[i] = table.tree()
+  }
+  return tables
+ case []interface{}:
+  for i, element := range value {
+   value[i] = tomlTree(element)
+  }
+  return value
+ default:
+  return value
+ }
+}
+
+func (table *tomlTable) seal() {
+ table.inline = true
+ for _, value := range table.values {
+  if value, ok := value.(*tomlTable); ok {
+   value.seal()
+  }
+ }
+}
+
+type tomlParser struct {
+ data    string
+ pos     int
+ root    *tomlTable
+ current *tomlTable
+}
+
+func (parser *tomlParser) errorf(format string, args ...interface{}) error {
+ line := 1 + strings.Count(parser.data[:parser.pos], "\n")
+ return fmt.Errorf("TOML syntax error on line %d: %s!\n", line, fmt.Sprintf(format, args...))
+}
+
+func (parser *tomlParser) eof() bool {
+ return parser.pos >= len(parser.data)
+}
+
+func (parser *tomlParser) peek() byte {
+ if parser.eof() {
+  return 0
+ }
+ return parser.data[parser.pos]
+}
+
+func (parser *tomlParser) consume(prefix string) bool {
+ if strings.HasPrefix(parser.data[parser.pos:], prefix) {
+  parser.pos += len(prefix)
+  return true
+ }
+ return false
+}
+
+func (parser *tomlParser) skipWhitespace() {
+ for c := parser.peek(); c == ' ' || c == '\t'; c = parser.peek() {
+  parser.pos++
+ }
+}
+
+func (parser *tomlParser) skipComment() {
+ if parser.peek() == '#' {
+  for !parser.eof() && parser.peek() != '\n' {
+   parser.pos++
+  }
+ }
+}
+
+//Skips whitespace, comments and newlines
+func (parser *tomlParser) skipBlank() {
+ for {
+  parser.skipWhitespace()
+  parser.skipComment()
+  if !parser.consume("\n") && !parser.consume("\r\n") {
+   return
+  }
+ }
+}
+
+func (parser *tomlParser) expectLineEnd() error {
+ parser.skipWhitespace()
+ parser.skipComment()
+ if parser.eof() || parser.consume("\n") || parser.consume("\r\n") {
+  return nil
+ }
+ return parser.errorf("expected the end of the line, received '%s'", parser.rest())
+}
+
+//The rest of the current line, for error messages
+func (parser *tomlParser) rest() string {
+ rest := parser.data[parser.pos:]
+ if i := strings.IndexAny(rest, "\r\n"); i >= 0 {
+  rest = rest[:i]
+ }
+ return rest
+}
+
+func (parser *tomlParser) parseDocument() error {
+ parser.current = parser.root
+ for {
+  parser.skipBlank()
+  if parser.eof() {
+   return nil
+  }
+  var err error
+  switch {
+  case parser.consume("[["):
+   err = parser.parseTableArrayHeader()
+  case parser.consume("["):
+   err = parser.parseTableHeader()
+  default:
+   err = parser.parseKeyValue(parser.current)
+  }
+  if err != nil {
+   return err
+  }
+  if err := parser.expectLineEnd(); err != nil {
+   return err
+  }
+ }
+}
+
+//Returns the table that a header's key is defined in, creating implicit super-tables
+func (parser *tomlParser) headerParent(keys []string) (*tomlTable, error) {
+ table := parser.root
+ for i, key := range keys[:len(keys) - 1] {
+  switch value := table.values[key].(type) {
+  case nil:
+   next := &tomlTable{values: map[string]interface{}{}}
+   table.values[key] = next
+   table = next
+  case *tomlTable:
+   if value.inline {
+    return nil, parser.errorf("cannot extend inline table '%s'", strings.Join(keys[:i + 1], PathSeparator))
+   }
+   table = value
+  case *tomlTableArray:
+   //the most recently defined table of the array
+   table = (*value)[len(*value) - 1]
+  default:
+   return nil, parser.errorf("key '%s' is not a table", strings.Join(keys[:i + 1], PathSeparator))
+  }
+ }
+ return table, nil
+}
+
+func (parser *tomlParser) parseTableHeader() error {
+ keys, err := parser.parseKey()
+ if err != nil {
+  return err
+ }
+ if !parser.consume("]") {
+  return parser.errorf("expected ']', received '%s'", parser.rest())
+ }
+ parent, err := parser.headerParent(keys)
+ if err != nil {
+  return err
+ }
+ key := keys[len(keys) - 1]
+ switch value := parent.values[key].(type) {
+ case nil:
+  table := &tomlTable{values: map[string]interface{}{}, header: true}
+  parent.values[key] = table
+  parser.current = table
+ case *tomlTable:
+  if value.header || value.dotted || value.inline {
+   return parser.errorf("table '%s' is defined more than once", strings.Join(keys, PathSeparator))
+  }
+  value.header = true
+  parser.current = value
+ default:
+  return parser.errorf("key '%s' is already defined", strings.Join(keys, PathSeparator))
+ }
+ return nil
+}
+
+func (parser *tomlParser) parseTableArrayHeader() error {
+ keys, err := parser.parseKey()
+ if err != nil {
+  return err
+ }
+ if !parser.consume("]]") {
+  return parser.errorf("expected ']]', received '%s'", parser.rest())
+ }
+ parent, err := parser.headerParent(keys)
+ if err != nil {
+  return err
+ }
+ key := keys[len(keys) - 1]
+ table := &tomlTable{values: map[string]interface{}{}, header: true}
+ switch value := parent.values[key].(type) {
+ case nil:
+  parent.values[key] = &tomlTableArray{table}
+ case *tomlTableArray:
+  *value = append(*value, table)
+ default:
+  return parser.errorf("key '%s' is not an array of tables", strings.Join(keys, PathSeparator))
+ }
+ parser.current = table
+ return nil
+}
+
+//Parses a key/value pair into the table, dotted keys define their intermediate tables
+func (parser *tomlParser) parseKeyValue(table *tomlTable) error {
+ keys, err := parser.parseKey()
+ if err != nil {
+  return err
+ }
+ if !parser.consume("=") {
+  return parser.errorf("expected '=' after key '%s', received '%s'", strings.Join(keys, PathSeparator), parser.rest())
+ }
+ parser.skipWhitespace()
+ value, err := parser.parseValue()
+ if err != nil {
+  return err
+ }
+ for i, key := range keys[:len(keys) - 1] {
+  switch next := table.values[key].(type) {
+  case nil:
+   created := &tomlTable{values: map[string]interface{}{}, dotted: true}
+   table.values[key] = created
+   table = created
+  case *tomlTable:
+   if next.header || next.inline {
+    return parser.errorf("cannot extend table '%s' with a dotted key", strings.Join(keys[:i + 1], PathSeparator))
+   }
+   table = next
+  default:
+   return parser.errorf("key '%s' is not a table", strings.Join(keys[:i + 1], PathSeparator))
+  }
+ }
+ key := keys[len(keys) - 1]
+ if _, ok := table.values[key]; ok {
+  return parser.errorf("key '%s' is defined more than once", strings.Join(keys, PathSeparator))
+ }
+ table.values[key] = value
+ return nil
+}
+
+func isTOMLBareKey(c byte) bool {
+ return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+//Parses a bare, quoted or dotted key and the whitespace that follows it
+func (parser *tomlParser) parseKey() ([]string, error) {
+ var keys []string
+ for {
+  parser.skipWhitespace()
+  var key string
+  var err error
+  switch c := parser.peek(); {
+  case c == '"':
+   key, err = parser.parseBasicString()
+  case c == '\'':
+   key, err = parser.parseLiteralString()
+  default:
+   start := parser.pos
+   for isTOMLBareKey(parser.peek()) {
+    parser.pos++
+   }
+   if start == parser.pos {
+    return nil, parser.errorf("expected a key, received '%s'", parser.rest())
+   }
+   key = parser.data[start:parser.pos]
+  }
+  if err != nil {
+   return nil, err
+  }
+  keys = append(keys, key)
+  parser.skipWhitespace()
+  if !parser.consume(".") {
+   return keys, nil
+  }
+ }
+}
+
+func (parser *tomlParser) parseValue() (interface{}, error) {
+ switch c := parser.peek(); {
+ case strings.HasPrefix(parser.data[parser.pos:], `"""`):
+  return parser.parseMultilineString('"')
+ case c == '"':
+  return parser.parseBasicString()
+ case strings.HasPrefix(parser.data[parser.pos:], "'''"):
+  return parser.parseMultilineString('\'')
+ case c == '\'':
+  return parser.parseLiteralString()
+ case c == '[':
+  return parser.parseArray()
+ case c == '{':
+  return parser.parseInlineTable()
+ case parser.eof():
+  return nil, parser.errorf("expected a value")
+ default:
+  return parser.parseScalar()
+ }
+}
+
+func (parser *tomlParser) parseBasicString() (string, error) {
+ parser.pos++
+ value := strings.Builder{}
+ for {
+  switch c := parser.peek(); {
+  case parser.eof() || c == '\n':
+   return "", parser.errorf("unterminated string")
+  case c == '"':
+   parser.pos++
+   return value.String(), nil
+  case c == '\\':
+   escaped, err := parser.parseEscape()
+   if err != nil {
+    return "", err
+   }
+   value.WriteString(escaped)
+  default:
+   value.WriteByte(c)
+   parser.pos++
+  }
+ }
+}
+
+func (parser *tomlParser) parseLiteralString() (string, error) {
+ parser.pos++
+ end := strings.IndexAny(parser.data[parser.pos:], "'\n")
+ if end < 0 || parser.data[parser.pos + end] != '\'' {
+  return "", parser.errorf("unterminated string")
+ }
+ value := parser.data[parser.pos:parser.pos + end]
+ parser.pos += end + 1
+ return value, nil
+}
+
+//Parses a multi-line basic (""") or literal (''') string
+func (parser *tomlParser) parseMultilineString(quote byte) (string, error) {
+ delimiter := strings.Repeat(string(quote), 3)
+ parser.pos += 3
+ //a newline immediately following the opening delimiter is trimmed
+ if !parser.consume("\n") {
+  parser.consume("\r\n")
+ }
+ value := strings.Builder{}
+ for {
+  if parser.eof() {
+   return "", parser.errorf("unterminated multi-line string")
+  }
+  if strings.HasPrefix(parser.data[parser.pos:], delimiter) {
+   //up to two quotes may precede the closing delimiter
+   quotes := 3
+   for quotes < 5 && parser.pos + quotes < len(parser.data) && parser.data[parser.pos + quotes] == quote {
+    quotes++
+   }
+   value.WriteString(strings.Repeat(string(quote), quotes - 3))
+   parser.pos += quotes
+   return value.String(), nil
+  }
+  c := parser.peek()
+  if c == '\\' && quote == '"' {
+   //a line ending backslash trims the whitespace and newlines that follow it
+   rest := strings.TrimLeft(parser.data[parser.pos + 1:], " \t")
+   if strings.HasPrefix(rest, "\n") || strings.HasPrefix(rest, "\r\n") {
+    parser.pos = len(parser.data) - len(strings.TrimLeft(rest, " \t\r\n"))
+    continue
+   }
+   escaped, err := parser.parseEscape()
+   if err != nil {
+    return "", err
+   }
+   value.WriteString(escaped)
+   continue
+  }
+  value.WriteByte(c)
+  parser.pos++
+ }
+}
+
+var tomlEscapes = map[byte]string{
+ 'b': "\b", 't': "\t", 'n': "\n", 'f': "\f", 'r': "\r", '"': "\"", '\\': "\\",
+}
+
+func (parser *tomlParser) parseEscape() (string, error) {
+ parser.pos++
+ c := parser.peek()
+ if escaped, ok := tomlEscapes[c]; ok {
+  parser.pos++
+  return escaped, nil
+ }
+ digits := map[byte]int{'u': 4, 'U': 8}[c]
+ if digits == 0 || parser.pos + digits >= len(parser.data) {
+  return "", parser.errorf("invalid escape sequence '\\%c'", c)
+ }
+ code, err := strconv.ParseUint(parser.data[parser.pos + 1:parser.pos + 1 + digits], 16, 32)
+ if err != nil || !utf8.ValidRune(rune(code)) {
+  return "", parser.errorf("invalid escape sequence '\\%s'", parser.data[parser.pos:parser.pos + 1 + digits])
+ }
+ parser.pos += 1 + digits
+ return string(rune(code)), nil
+}
+
+func (parser *tomlParser) parseArray() (interface{}, error) {
+ parser.pos++
+ array := []interface{}{}
+ for {
+  parser.skipBlank()
+  if parser.consume("]") {
+   return array, nil
+  }
+  value, err := parser.parseValue()
+  if err != nil {
+   return nil, err
+  }
+  array = append(array, value)
+  parser.skipBlank()
+  if parser.consume("]") {
+   return array, nil
+  }
+  if !parser.consume(",") {
+   return nil, parser.errorf("expected ',' or ']', received '%s'", parser.rest())
+  }
+ }
+}
+
+func (parser *tomlParser) parseInlineTable() (interface{}, error) {
+ parser.pos++
+ table := &tomlTable{values: map[string]interface{}{}}
+ parser.skipWhitespace()
+ if parser.consume("}") {
+  table.seal()
+  return table, nil
+ }
+ for {
+  if err := parser.parseKeyValue(table); err != nil {
+   return nil, err
+  }
+  parser.skipWhitespace()
+  if parser.consume("}") {
+   table.seal()
+   return table, nil
+  }
+  if !parser.consume(",") {
+   return nil, parser.errorf("expected ',' or '}', received '%s'", parser.rest())
+  }
+ }
+}
+
+var (
+ tomlInteger = regexp.MustCompile(`^[-+]?(0|[1-9](_?[0-9])*)$`)
+ tomlFloat   = regexp.MustCompile(`^[-+]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][-+]?[0-9](_?[0-9])*)?$`)
+ tomlPrefixed = map[string]*regexp.Regexp{
+  "0x": regexp.MustCompile(`^[0-9a-fA-F](_?[0-9a-fA-F])*$`),
+  "0o": regexp.MustCompile(`^[0-7](_?[0-7])*$`),
+  "0b": regexp.MustCompile(`^[01](_?[01])*$`),
+ }
+ tomlBases = map[string]int{"0x": 16, "0o": 8, "0b": 2}
+ tomlDate  = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}$`)
+ tomlDateTimeLayouts = []string{
+  "2006-01-02T15:04:05.999999999Z07:00",
+  "2006-01-02T15:04:05.999999999",
+  "2006-01-02",
+  "15:04:05.999999999",
+ }
+)
+
+func isTOMLScalar(c byte) bool {
+ return isTOMLBareKey(c) || c == '+' || c == '.' || c == ':'
+}
+
+//Parses booleans, numbers and date-times
+func (parser *tomlParser) parseScalar() (interface{}, error) {
+ start := parser.pos
+ for isTOMLScalar(parser.peek()) {
+  parser.pos++
+ }
+ token := parser.data[start:parser.pos]
+ //date-times may separate the date and time with a space
+ if tomlDate.MatchString(token) && parser.pos + 1 < len(parser.data) && parser.data[parser.pos] == ' ' {
+  if c := parser.data[parser.pos + 1]; c >= '0' && c <= '9' {
+   parser.pos++
+   for isTOMLScalar(parser.peek()) {
+    parser.pos++
+   }
+   token = parser.data[start:parser.pos]
+  }
+ }
+ switch token {
+ case "true":
+  return true, nil
+ case "false":
+  return false, nil
+ case "inf", "+inf":
+  return math.Inf(1), nil
+ case "-inf":
+  return math.Inf(-1), nil
+ case "nan", "+nan", "-nan":
+  return math.NaN(), nil
+ }
+ if len(token) > 2 {
+  if pattern, ok := tomlPrefixed[token[:2]]; ok {
+   if pattern.MatchString(token[2:]) {
+    if i, err := strconv.ParseInt(strings.Replace(token[2:], "_", "", -1), tomlBases[token[:2]], 64); err == nil {
+     return i, nil
+    }
+   }
+   return nil, parser.invalidValue(start, token)
+  }
+ }
+ switch {
+ case tomlInteger.MatchString(token):
+  if i, err := strconv.ParseInt(strings.Replace(token, "_", "", -1), 10, 64); err == nil {
+   return i, nil
+  }
+ case tomlFloat.MatchString(token):
+  if f, err := strconv.ParseFloat(strings.Replace(token, "_", "", -1), 64); err == nil {
+   return f, nil
+  }
+ case strings.ContainsAny(token, ":-"):
+  normalized := strings.ToUpper(token)
+  if len(normalized) > 10 && normalized[10] == ' ' {
+   normalized = normalized[:10] + "T" + normalized[11:]
+  }
+  for _, layout := range tomlDateTimeLayouts {
+   if t, err := time.Parse(layout, normalized); err == nil {
+    return t, nil
+   }
+  }
+ }
+ return nil, parser.invalidValue(start, token)
+}
+
+func (parser *tomlParser) invalidValue(start int, token string) error {
+ parser.pos = start
+ if token == "" {
+  return parser.errorf("invalid value '%s'", parser.rest())
+ }
+ return parser.errorf("invalid value '%s'", token)
+}
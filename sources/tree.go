@@ -0,0 +1,162 @@
+package sources
+
+import (
+ "errors"
+ "fmt"
+ "sort"
+ "strings"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//Separates the segments of nested parameter names, ie. {"sql": {"max_connections": 32}} defines the parameter
+//'sql.max_connections'
+const PathSeparator = "."
+
+//Returned when a source defines a parameter that is not registered
+type UnknownParameterError struct {
+ Path string
+}
+
+func (err *UnknownParameterError) Error() string {
+ return fmt.Sprintf("Unknown parameter '%s'!\n", err.Path)
+}
+
+//Returned when a parameter value cannot be exported because its key is not registered
+type UnregisteredKeyError struct {
+ Key config.IParameterKey
+}
+
+func (err *UnregisteredKeyError) Error() string {
+ return fmt.Sprintf("Key [%v] is not registered!\n", err.Key.Key())
+}
+
+//Returned when a parameter value could not be encoded for exporting
+type EncodeError struct {
+ Name  string
+ Value config.IParameterValue
+ Err   error
+}
+
+func (err *EncodeError) Error() string {
+ return fmt.Sprintf("Failed to encode parameter '%s' with value '%s':\n%s\n", err.Name, err.Value.String(), err.Err.Error())
+}
+
+func (err *EncodeError) Unwrap() error {
+ return err.Err
+}
+
+//Every error encountered while decoding or encoding a document
+type Errors []error
+
+//Lets errors.As match any of the errors
+func (errs Errors) As(target interface{}) bool {
+ for _, err := range errs {
+  if errors.As(err, target) {
+   return true
+  }
+ }
+ return false
+}
+
+func (errs Errors) Error() string {
+ messages := make([]string, len(errs))
+ for i, err := range errs {
+  messages[i] = err.Error()
+ }
+ return strings.Join(messages, "")
+}
+
+func joinPath(parent, name string) string {
+ if parent == "" {
+  return name
+ }
+ return parent + PathSeparator + name
+}
+
+//Decodes a document tree, as produced by a format decoder. Nested tables are mapped to dotted parameter names; a
+//table whose path is a registered parameter is handed to the parameter's decoder as a whole. Errors are collected
+//for every unknown parameter and every value that fails to decode, nothing is returned unless the whole document
+//decodes.
+func DecodeTree(registry *Registry, tree map[string]interface{}) (config.Parameters, error) {
+ params := config.Parameters{}
+ errs := Errors{}
+ decodeTable(registry, "", tree, params, &errs)
+ if len(errs) > 0 {
+  return nil, errs
+ }
+ return params, nil
+}
+
+func decodeTable(registry *Registry, parent string, table map[string]interface{}, params config.Parameters, errs *Errors) {
+ //sorted for deterministic error reporting
+ names := make([]string, 0, len(table))
+ for name := range table {
+  names = append(names, name)
+ }
+ sort.Strings(names)
+ for _, name := range names {
+  path := joinPath(parent, name)
+  node := table[name]
+  if binding, ok := registry.Lookup(path); ok {
+   value, err := binding.Decoder(node)
+   if err != nil {
+    *errs = append(*errs, &DecodeError{path, node, err})
+    continue
+   }
+   params[binding.Key] = value
+  } else if nested, ok := node.(map[string]interface{}); ok {
+   decodeTable(registry, path, nested, params, errs)
+  } else {
+   *errs = append(*errs, &UnknownParameterError{path})
+  }
+ }
+}
+
+//Encodes parameters into a document tree for a format encoder, the inverse of DecodeTree. Dotted parameter names are
+//nested into tables, except for parameters whose name extends the name of another parameter (ie. 'sql.timeout'
+//alongside 'sql'), which keep their full dotted name.
+func EncodeTree(registry *Registry, params config.Parameters) (map[string]interface{}, error) {
+ errs := Errors{}
+ encoded := map[string]interface{}{}
+ for key, value := range params {
+  binding, ok := registry.LookupKey(key)
+  if !ok {
+   errs = append(errs, &UnregisteredKeyError{key})
+   continue
+  }
+  raw, err := binding.Encode(value)
+  if err != nil {
+   errs = append(errs, &EncodeError{binding.Name, value, err})
+   continue
+  }
+  encoded[binding.Name] = raw
+ }
+ if len(errs) > 0 {
+  return nil, errs
+ }
+ tree := map[string]interface{}{}
+ for name, raw := range encoded {
+  segments := strings.Split(name, PathSeparator)
+  //parameters nested under another parameter keep their full dotted name
+  flat := false
+  for i := 1; i < len(segments) && !flat; i++ {
+   _, flat = encoded[strings.Join(segments[:i], PathSeparator)]
+  }
+  if flat {
+   tree[name] = raw
+   continue
+  }
+  table := tree
+  for _, segment := range segments[:len(segments) - 1] {
+   nested, ok := table[segment].(map[string]interface{})
+   if !ok {
+    nested = map[string]interface{}{}
+    table[segment] = nested
+   }
+   table = nested
+  }
+  table[segments[len(segments) - 1]] = raw
+ }
+ return tree, nil
+}
@@ -0,0 +1,689 @@
+package sources
+
+import (
+ "fmt"
+ "math"
+ "regexp"
+ "strconv"
+ "strings"
+ "unicode/utf8"
+)
+
+//YAML documents, see yamlParser for the supported subset of YAML 1.2
+var YAML IFormat = yamlFormat{}
+
+type yamlFormat struct{}
+
+func (yamlFormat) Decode(data []byte) (map[string]interface{}, error) {
+ parser, err := newYAMLParser(string(data))
+ if err != nil {
+  return nil, err
+ }
+ return parser.parseDocument()
+}
+
+func (yamlFormat) String() string {
+ return "yaml"
+}
+
+func yamlError(line int, format string, args ...interface{}) error {
+ return fmt.Errorf("YAML syntax error on line %d: %s!\n", line, fmt.Sprintf(format, args...))
+}
+
+type yamlLine struct {
+ number int
+ indent int
+ //the line without its indentation and comments, empty for blank lines
+ text string
+ raw  string
+ //the indentation contains tabs
+ tabbed bool
+}
+
+//Parses a single YAML document made of block and flow collections, and plain, quoted and block scalars. Plain
+//scalars are resolved with the YAML 1.2 core schema: null, booleans, int64 and float64, everything else is a string.
+//Anchors, aliases, tags, complex keys and multi-line plain or quoted scalars are not supported.
+type yamlParser struct {
+ lines []yamlLine
+ pos   int
+}
+
+func newYAMLParser(document string) (*yamlParser, error) {
+ parser := &yamlParser{}
+ started := false
+ for i, raw := range strings.Split(document, "\n") {
+  raw = strings.TrimSuffix(raw, "\r")
+  number := i + 1
+  indent := len(raw) - len(strings.TrimLeft(raw, " "))
+  content := raw[indent:]
+  text := strings.TrimRight(stripYAMLComment(content), " \t")
+  line := yamlLine{
+   number: number,
+   indent: indent,
+   text: text,
+   raw: raw,
+   tabbed: strings.HasPrefix(text, "\t"),
+  }
+  if line.tabbed {
+   line.text = strings.TrimLeft(text, " \t")
+  }
+  if indent == 0 && !started && strings.HasPrefix(text, "%") {
+   //directives
+   continue
+  }
+  if indent == 0 && (text == "---" || strings.HasPrefix(text, "--- ")) {
+   if started {
+    return nil, yamlError(number, "multiple documents are not supported")
+   }
+   started = true
+   if strings.TrimSpace(text[3:]) != "" {
+    return nil, yamlError(number, "content on the document start marker is not supported")
+   }
+   continue
+  }
+  if indent == 0 && text == "..." {
+   break
+  }
+  if text != "" {
+   started = true
+  }
+  parser.lines = append(parser.lines, line)
+ }
+ return parser, nil
+}
+
+//Strips the comment from the content of a line, '#' starts a comment at the start of the line or after whitespace
+//when it is not quoted
+func stripYAMLComment(content string) string {
+ var quote byte
+ for i := 0; i < len(content); i++ {
+  c := content[i]
+  switch {
+  case quote == '"' && c == '\\':
+   i++
+  case quote != 0:
+   if c == quote {
+    quote = 0
+   }
+  case c == '"' || c == '\'':
+   //quotes only start a scalar at the start of a token, ie. not in it's
+   if i == 0 || strings.IndexByte(" \t[{,:", content[i - 1]) >= 0 {
+    quote = c
+   }
+  case c == '#':
+   if i == 0 || content[i - 1] == ' ' || content[i - 1] == '\t' {
+    return content[:i]
+   }
+  }
+ }
+ return content
+}
+
+//Returns the next non-blank line, if any
+func (parser *yamlParser) peek() (*yamlLine, bool) {
+ for parser.pos < len(parser.lines) && parser.lines[parser.pos].text == "" {
+  parser.pos++
+ }
+ if parser.pos == len(parser.lines) {
+  return nil, false
+ }
+ return &parser.lines[parser.pos], true
+}
+
+func (parser *yamlParser) parseDocument() (map[string]interface{}, error) {
+ line, ok := parser.peek()
+ if !ok {
+  return map[string]interface{}{}, nil
+ }
+ root, err := parser.parseBlock(line.indent)
+ if err != nil {
+  return nil, err
+ }
+ if line, ok := parser.peek(); ok {
+  return nil, yamlError(line.number, "unexpected content '%s'", line.text)
+ }
+ tree, ok := root.(map[string]interface{})
+ if !ok {
+  return nil, yamlError(line.number, "the document must be a mapping")
+ }
+ return tree, nil
+}
+
+func isYAMLSequenceEntry(text string) bool {
+ return text == "-" || strings.HasPrefix(text, "- ") || strings.HasPrefix(text, "-\t")
+}
+
+//Splits a mapping entry into its key and the remaining text, ok is false if the text is not a mapping entry
+func splitYAMLMappingEntry(number int, text string) (key, rest string, ok bool, err error) {
+ if text == "" || strings.IndexByte("[{", text[0]) >= 0 {
+  return "", "", false, nil
+ }
+ if text[0] == '"' || text[0] == '\'' {
+  var n int
+  if key, n, err = parseYAMLQuoted(number, text); err != nil {
+   return "", "", false, err
+  }
+  after := strings.TrimLeft(text[n:], " \t")
+  if !strings.HasPrefix(after, ":") || (len(after) > 1 && after[1] != ' ' && after[1] != '\t') {
+   return "", "", false, nil
+  }
+  return key, strings.TrimSpace(after[1:]), true, nil
+ }
+ for i := 0; i < len(text); i++ {
+  if text[i] == ':' && (i + 1 == len(text) || text[i + 1] == ' ' || text[i + 1] == '\t') {
+   key = strings.TrimRight(text[:i], " \t")
+   if err = checkYAMLIndicator(number, key); err != nil {
+    return "", "", false, err
+   }
+   return key, strings.TrimSpace(text[i + 1:]), true, nil
+  }
+ }
+ return "", "", false, nil
+}
+
+func checkYAMLIndicator(number int, text string) error {
+ if text == "" {
+  return nil
+ }
+ switch text[0] {
+ case '&', '*', '!':
+  return yamlError(number, "anchors, aliases and tags are not supported")
+ case '?':
+  if len(text) == 1 || text[1] == ' ' {
+   return yamlError(number, "complex keys are not supported")
+  }
+ case '@', '`':
+  return yamlError(number, "plain scalars cannot start with the reserved indicator '%c'", text[0])
+ }
+ return nil
+}
+
+//Parses the node that starts on the next line, which is indented by exactly indent
+func (parser *yamlParser) parseBlock(indent int) (interface{}, error) {
+ line, _ := parser.peek()
+ if line.tabbed {
+  return nil, yamlError(line.number, "tabs are not allowed in indentation")
+ }
+ if isYAMLSequenceEntry(line.text) {
+  return parser.parseSequence(indent)
+ }
+ _, _, ok, err := splitYAMLMappingEntry(line.number, line.text)
+ if err != nil {
+  return nil, err
+ }
+ if ok {
+  return parser.parseMapping(indent)
+ }
+ parser.pos++
+ return parser.parseInline(line, line.text)
+}
+
+func (parser *yamlParser) parseMapping(indent int) (interface{}, error) {
+ mapping := map[string]interface{}{}
+ for {
+  line, ok := parser.peek()
+  if !ok || line.indent < indent {
+   break
+  }
+  if line.tabbed {
+   return nil, yamlError(line.number, "tabs are not allowed in indentation")
+  }
+  if line.indent > indent {
+   return nil, yamlError(line.number, "unexpected indentation")
+  }
+  key, rest, ok, err := splitYAMLMappingEntry(line.number, line.text)
+  if err != nil {
+   return nil, err
+  }
+  if !ok {
+   return nil, yamlError(line.number, "expected a mapping entry, received '%s'", line.text)
+  }
+  if _, ok := mapping[key]; ok {
+   return nil, yamlError(line.number, "duplicate key '%s'", key)
+  }
+  parser.pos++
+  if mapping[key], err = parser.parseValue(line, indent, rest, true); err != nil {
+   return nil, err
+  }
+ }
+ return mapping, nil
+}
+
+func (parser *yamlParser) parseSequence(indent int) (interface{}, error) {
+ sequence := []interface{}{}
+ for {
+  line, ok := parser.peek()
+  if !ok || line.indent < indent {
+   break
+  }
+  if line.tabbed {
+   return nil, yamlError(line.number, "tabs are not allowed in indentation")
+  }
+  if line.indent > indent {
+   return nil, yamlError(line.number, "unexpected indentation")
+  }
+  if !isYAMLSequenceEntry(line.text) {
+   //the end of a sequence that is the value of a mapping entry at the same indentation
+   break
+  }
+  rest := strings.TrimLeft(line.text[1:], " \t")
+  _, _, nested, err := splitYAMLMappingEntry(line.number, rest)
+  if err != nil {
+   return nil, err
+  }
+  var item interface{}
+  if nested || isYAMLSequenceEntry(rest) {
+   //a compact collection, ie. '- key: value', continues at the indentation of its first entry
+   line.indent += len(line.text) - len(rest)
+   line.text = rest
+   item, err = parser.parseBlock(line.indent)
+  } else {
+   parser.pos++
+   item, err = parser.parseValue(line, indent, rest, false)
+  }
+  if err != nil {
+   return nil, err
+  }
+  sequence = append(sequence, item)
+ }
+ return sequence, nil
+}
+
+//Parses the value of a mapping entry or sequence item, given the rest of its line. Sequences may be the value of a
+//mapping entry at the same indentation.
+func (parser *yamlParser) parseValue(line *yamlLine, indent int, rest string, mappingEntry bool) (interface{}, error) {
+ switch {
+ case rest == "":
+  next, ok := parser.peek()
+  if ok && next.indent > indent {
+   return parser.parseBlock(next.indent)
+  }
+  if ok && mappingEntry && next.indent == indent && isYAMLSequenceEntry(next.text) {
+   return parser.parseSequence(indent)
+  }
+  return nil, nil
+ case rest[0] == '|' || rest[0] == '>':
+  return parser.parseBlockScalar(line, indent, rest)
+ }
+ //mappings must start on their own line, 'a: b: c' is not the string 'b: c'
+ if _, _, nested, err := splitYAMLMappingEntry(line.number, rest); err == nil && nested {
+  return nil, yamlError(line.number, "mapping values are not allowed here")
+ }
+ return parser.parseInline(line, rest)
+}
+
+//Parses a flow collection or a scalar, flow collections may continue over the following lines
+func (parser *yamlParser) parseInline(line *yamlLine, text string) (interface{}, error) {
+ if text[0] == '[' || text[0] == '{' {
+  for yamlFlowDepth(text) > 0 {
+   next, ok := parser.peek()
+   if !ok {
+    return nil, yamlError(line.number, "unterminated flow collection")
+   }
+   text += " " + next.text
+   parser.pos++
+  }
+ }
+ flow := &yamlFlowParser{text: text, number: line.number}
+ var value interface{}
+ var err error
+ if text[0] == '[' || text[0] == '{' {
+  value, err = flow.parseNode()
+ } else {
+  value, err = flow.parseScalar(false)
+ }
+ if err != nil {
+  return nil, err
+ }
+ flow.skipSpace()
+ if flow.pos != len(text) {
+  return nil, yamlError(line.number, "unexpected content '%s'", text[flow.pos:])
+ }
+ return value, nil
+}
+
+//Returns the number of unclosed flow collections in the text
+func yamlFlowDepth(text string) int {
+ depth := 0
+ var quote byte
+ for i := 0; i < len(text); i++ {
+  c := text[i]
+  switch {
+  case quote == '"' && c == '\\':
+   i++
+  case quote != 0:
+   if c == quote {
+    quote = 0
+   }
+  case c == '"' || c == '\'':
+   quote = c
+  case c == '[' || c == '{':
+   depth++
+  case c == ']' || c == '}':
+   depth--
+  }
+ }
+ return depth
+}
+
+//Parses a literal (|) or folded (>) block scalar
+func (parser *yamlParser) parseBlockScalar(line *yamlLine, indent int, header string) (interface{}, error) {
+ folded := header[0] == '>'
+ chomping := byte(0)
+ explicit := 0
+ for _, c := range header[1:] {
+  switch {
+  case (c == '-' || c == '+') && chomping == 0:
+   chomping = byte(c)
+  case c >= '1' && c <= '9' && explicit == 0:
+   explicit = int(c - '0')
+  default:
+   return nil, yamlError(line.number, "invalid block scalar header '%s'", header)
+  }
+ }
+ blockIndent := indent + explicit
+ if explicit == 0 {
+  blockIndent = -1
+ }
+ var lines []string
+ for parser.pos < len(parser.lines) {
+  raw := parser.lines[parser.pos].raw
+  if strings.TrimSpace(raw) == "" {
+   lines = append(lines, "")
+   parser.pos++
+   continue
+  }
+  spaces := len(raw) - len(strings.TrimLeft(raw, " "))
+  if blockIndent < 0 {
+   blockIndent = spaces
+  }
+  if spaces < blockIndent || spaces <= indent {
+   break
+  }
+  lines = append(lines, raw[blockIndent:])
+  parser.pos++
+ }
+ trailing := 0
+ for len(lines) > 0 && lines[len(lines) - 1] == "" {
+  lines = lines[:len(lines) - 1]
+  trailing++
+ }
+ if len(lines) == 0 {
+  if chomping == '+' {
+   return strings.Repeat("\n", trailing), nil
+  }
+  return "", nil
+ }
+ var value string
+ if folded {
+  value = lines[0]
+  for i := 1; i < len(lines); i++ {
+   prev, current := lines[i - 1], lines[i]
+   switch {
+   case current == "":
+    value += "\n"
+   case prev == "":
+    value += current
+   case strings.HasPrefix(prev, " ") || strings.HasPrefix(current, " "):
+    //more indented lines are not folded
+    value += "\n" + current
+   default:
+    value += " " + current
+   }
+  }
+ } else {
+  value = strings.Join(lines, "\n")
+ }
+ switch chomping {
+ case '-':
+  return value, nil
+ case '+':
+  return value + "\n" + strings.Repeat("\n", trailing), nil
+ default:
+  return value + "\n", nil
+ }
+}
+
+//Parses flow collections and scalars within a single (joined) line
+type yamlFlowParser struct {
+ text   string
+ pos    int
+ number int
+}
+
+func (flow *yamlFlowParser) skipSpace() {
+ for flow.pos < len(flow.text) && (flow.text[flow.pos] == ' ' || flow.text[flow.pos] == '\t') {
+  flow.pos++
+ }
+}
+
+func (flow *yamlFlowParser) parseNode() (interface{}, error) {
+ flow.skipSpace()
+ if flow.pos == len(flow.text) {
+  return nil, yamlError(flow.number, "unexpected end of flow collection")
+ }
+ switch flow.text[flow.pos] {
+ case '[':
+  return flow.parseSequence()
+ case '{':
+  return flow.parseMapping()
+ default:
+  return flow.parseScalar(true)
+ }
+}
+
+func (flow *yamlFlowParser) parseSequence() (interface{}, error) {
+ flow.pos++
+ sequence := []interface{}{}
+ for {
+  flow.skipSpace()
+  if flow.pos < len(flow.text) && flow.text[flow.pos] == ']' {
+   flow.pos++
+   return sequence, nil
+  }
+  item, err := flow.parseNode()
+  if err != nil {
+   return nil, err
+  }
+  sequence = append(sequence, item)
+  if err := flow.parseSeparator(']'); err != nil {
+   return nil, err
+  }
+ }
+}
+
+func (flow *yamlFlowParser) parseMapping() (interface{}, error) {
+ flow.pos++
+ mapping := map[string]interface{}{}
+ for {
+  flow.skipSpace()
+  if flow.pos < len(flow.text) && flow.text[flow.pos] == '}' {
+   flow.pos++
+   return mapping, nil
+  }
+  key, err := flow.parseKey()
+  if err != nil {
+   return nil, err
+  }
+  if _, ok := mapping[key]; ok {
+   return nil, yamlError(flow.number, "duplicate key '%s'", key)
+  }
+  flow.skipSpace()
+  var value interface{}
+  if flow.pos < len(flow.text) && flow.text[flow.pos] == ':' {
+   flow.pos++
+   flow.skipSpace()
+   if flow.pos < len(flow.text) && flow.text[flow.pos] != ',' && flow.text[flow.pos] != '}' {
+    if value, err = flow.parseNode(); err != nil {
+     return nil, err
+    }
+   }
+  }
+  mapping[key] = value
+  if err := flow.parseSeparator('}'); err != nil {
+   return nil, err
+  }
+ }
+}
+
+//Keys are never resolved, ie. {1: a} has the key "1"
+func (flow *yamlFlowParser) parseKey() (string, error) {
+ if flow.pos < len(flow.text) && (flow.text[flow.pos] == '"' || flow.text[flow.pos] == '\'') {
+  key, n, err := parseYAMLQuoted(flow.number, flow.text[flow.pos:])
+  flow.pos += n
+  return key, err
+ }
+ plain := flow.scanPlain()
+ if plain == "" {
+  return "", yamlError(flow.number, "expected a key")
+ }
+ return plain, checkYAMLIndicator(flow.number, plain)
+}
+
+//Consumes the ',' between the entries of a flow collection, or its closing bracket
+func (flow *yamlFlowParser) parseSeparator(closing byte) error {
+ flow.skipSpace()
+ if flow.pos == len(flow.text) {
+  return yamlError(flow.number, "expected ',' or '%c'", closing)
+ }
+ switch flow.text[flow.pos] {
+ case ',':
+  flow.pos++
+  return nil
+ case closing:
+  //left for the collection to consume
+  return nil
+ default:
+  return yamlError(flow.number, "expected ',' or '%c', received '%s'", closing, flow.text[flow.pos:])
+ }
+}
+
+//Plain scalars in flow collections end at flow indicators and mapping values
+func (flow *yamlFlowParser) scanPlain() string {
+ start := flow.pos
+ for flow.pos < len(flow.text) {
+  c := flow.text[flow.pos]
+  if strings.IndexByte(",[]{}", c) >= 0 {
+   break
+  }
+  if c == ':' && (flow.pos + 1 == len(flow.text) || strings.IndexByte(" \t,[]{}", flow.text[flow.pos + 1]) >= 0) {
+   break
+  }
+  flow.pos++
+ }
+ return strings.TrimRight(flow.text[start:flow.pos], " \t")
+}
+
+func (flow *yamlFlowParser) parseScalar(inFlow bool) (interface{}, error) {
+ if c := flow.text[flow.pos]; c == '"' || c == '\'' {
+  value, n, err := parseYAMLQuoted(flow.number, flow.text[flow.pos:])
+  flow.pos += n
+  return value, err
+ }
+ var plain string
+ if inFlow {
+  plain = flow.scanPlain()
+ } else {
+  plain = flow.text[flow.pos:]
+  flow.pos = len(flow.text)
+ }
+ if err := checkYAMLIndicator(flow.number, plain); err != nil {
+  return nil, err
+ }
+ return resolveYAMLScalar(plain), nil
+}
+
+var (
+ yamlInt   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+ yamlFloat = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+//Resolves a plain scalar with the YAML 1.2 core schema, integers that overflow an int64 are left as strings
+func resolveYAMLScalar(plain string) interface{} {
+ switch plain {
+ case "", "~", "null", "Null", "NULL":
+  return nil
+ case "true", "True", "TRUE":
+  return true
+ case "false", "False", "FALSE":
+  return false
+ case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF":
+  return math.Inf(1)
+ case "-.inf", "-.Inf", "-.INF":
+  return math.Inf(-1)
+ case ".nan", ".NaN", ".NAN":
+  return math.NaN()
+ }
+ var i int64
+ var err error
+ switch {
+ case strings.HasPrefix(plain, "0x"):
+  i, err = strconv.ParseInt(plain[2:], 16, 64)
+ case strings.HasPrefix(plain, "0o"):
+  i, err = strconv.ParseInt(plain[2:], 8, 64)
+ case yamlInt.MatchString(plain):
+  i, err = strconv.ParseInt(plain, 10, 64)
+ case yamlFloat.MatchString(plain):
+  if f, err := strconv.ParseFloat(plain, 64); err == nil {
+   return f
+  }
+  return plain
+ default:
+  return plain
+ }
+ if err != nil {
+  return plain
+ }
+ return i
+}
+
+//Parses the single or double quoted scalar at the start of the text, returning its value and length
+func parseYAMLQuoted(number int, text string) (string, int, error) {
+ quote := text[0]
+ value := strings.Builder{}
+ for i := 1; i < len(text); i++ {
+  c := text[i]
+  switch {
+  case c == quote && quote == '\'' && i + 1 < len(text) && text[i + 1] == '\'':
+   value.WriteByte('\'')
+   i++
+  case c == quote:
+   return value.String(), i + 1, nil
+  case c == '\\' && quote == '"':
+   if i + 1 == len(text) {
+    return "", 0, yamlError(number, "unterminated escape sequence")
+   }
+   i++
+   escaped, n, err := parseYAMLEscape(number, text[i:])
+   if err != nil {
+    return "", 0, err
+   }
+   value.WriteString(escaped)
+   i += n - 1
+  default:
+   value.WriteByte(c)
+  }
+ }
+ return "", 0, yamlError(number, "unterminated quoted scalar")
+}
+
+var yamlEscapes = map[byte]string{
+ '0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n", 'v': "\v", 'f': "\f", 'r': "\r", 'e': "\x1b",
+ ' ': " ", '"': "\"", '/': "/", '\\': "\\", 'N': "\u0085", '_': "\u00a0", 'L': "\u2028", 'P': "\u2029",
+}
+
+//Parses the escape sequence that follows a backslash, returning its value and length
+func parseYAMLEscape(number int, text string) (string, int, error) {
+ if escaped, ok := yamlEscapes[text[0]]; ok {
+  return escaped, 1, nil
+ }
+ digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[text[0]]
+ if digits == 0 || len(text) <= digits {
+  return "", 0, yamlError(number, "invalid escape sequence '\\%c'", text[0])
+ }
+ code, err := strconv.ParseUint(text[1:digits + 1], 16, 32)
+ if err != nil || !utf8.ValidRune(rune(code)) {
+  return "", 0, yamlError(number, "invalid escape sequence '\\%s'", text[:digits + 1])
+ }
+ return string(rune(code)), digits + 1, nil
+}
@@ -0,0 +1,104 @@
+package validate
+
+import (
+ "fmt"
+ "reflect"
+ "regexp"
+ "strings"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//Common config.ParameterValidator implementations. Any function with the signature of a config.ParameterValidator
+//is a custom validator.
+
+//Accepts a value only if every validator accepts it, validators run in order
+func All(validators ...config.ParameterValidator) config.ParameterValidator {
+ return func(key config.IParameterKey, value config.IParameterValue) error {
+  for _, validator := range validators {
+   if err := validator(key, value); err != nil {
+    return err
+   }
+  }
+  return nil
+ }
+}
+
+//Returns the numeric underlying value of the parameter value
+func number(value config.IParameterValue) (float64, error) {
+ if value == nil {
+  return 0, fmt.Errorf("Expected a numeric value, received: nil!\n")
+ }
+ v := reflect.ValueOf(value.Value())
+ switch v.Kind() {
+ case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+  return float64(v.Int()), nil
+ case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+  return float64(v.Uint()), nil
+ case reflect.Float32, reflect.Float64:
+  return v.Float(), nil
+ default:
+  return 0, fmt.Errorf("Expected a numeric value, received: %T!\n", value.Value())
+ }
+}
+
+//Accepts values whose numeric underlying value is within [min, max], ie. values.Int or values.Duration (in
+//nanoseconds)
+func Range(min, max float64) config.ParameterValidator {
+ return func(key config.IParameterKey, value config.IParameterValue) error {
+  n, err := number(value)
+  if err != nil {
+   return err
+  }
+  if n < min || n > max {
+   return fmt.Errorf("Expected a value within [%v, %v], received: %v!\n", min, max, n)
+  }
+  return nil
+ }
+}
+
+//Accepts values whose numeric underlying value is at least min
+func Min(min float64) config.ParameterValidator {
+ return func(key config.IParameterKey, value config.IParameterValue) error {
+  n, err := number(value)
+  if err != nil {
+   return err
+  }
+  if n < min {
+   return fmt.Errorf("Expected a value of at least %v, received: %v!\n", min, n)
+  }
+  return nil
+ }
+}
+
+//Accepts values whose String() matches the pattern
+func Matches(pattern *regexp.Regexp) config.ParameterValidator {
+ return func(key config.IParameterKey, value config.IParameterValue) error {
+  if value == nil || !pattern.MatchString(value.String()) {
+   return fmt.Errorf("Expected a value matching '%s', received: '%v'!\n", pattern.String(), value)
+  }
+  return nil
+ }
+}
+
+//Accepts values whose String() is one of the allowed strings
+func OneOf(allowed ...string) config.ParameterValidator {
+ return func(key config.IParameterKey, value config.IParameterValue) error {
+  if value != nil {
+   for _, s := range allowed {
+    if value.String() == s {
+     return nil
+    }
+   }
+  }
+  return fmt.Errorf("Expected one of [%s], received: '%v'!\n", strings.Join(allowed, ", "), value)
+ }
+}
+
+//Rejects nil values
+func NonNil(key config.IParameterKey, value config.IParameterValue) error {
+ if value == nil {
+  return fmt.Errorf("Expected a value, received: nil!\n")
+ }
+ return nil
+}
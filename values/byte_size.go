@@ -0,0 +1,101 @@
+package values
+
+import (
+ "fmt"
+ "math"
+ "strconv"
+ "strings"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//A number of bytes, parsed from sizes with decimal (kB, MB, ...) or binary (KiB, MiB, ...) units, ie. "512MiB"
+type ByteSize uint64
+
+const (
+ BYTE ByteSize = 1
+ KB = 1000 * BYTE
+ MB = 1000 * KB
+ GB = 1000 * MB
+ TB = 1000 * GB
+ PB = 1000 * TB
+ KIB = 1024 * BYTE
+ MIB = 1024 * KIB
+ GIB = 1024 * MIB
+ TIB = 1024 * GIB
+ PIB = 1024 * TIB
+)
+
+//Largest first, binary units before decimal units of the same magnitude
+var byteSizeUnits = []struct {
+ name string
+ size ByteSize
+}{
+ {"PiB", PIB}, {"PB", PB},
+ {"TiB", TIB}, {"TB", TB},
+ {"GiB", GIB}, {"GB", GB},
+ {"MiB", MIB}, {"MB", MB},
+ {"KiB", KIB}, {"kB", KB},
+}
+
+//Units are case insensitive and may be separated from the number by whitespace, sizes without a unit are bytes.
+//Fractional sizes are rounded down to whole bytes, ie. "1.5KiB" is 1536 bytes.
+func ParseByteSize(raw string) (config.IParameterValue, error) {
+ text := strings.TrimSpace(raw)
+ i := strings.IndexFunc(text, func(r rune) bool {
+  return (r < '0' || r > '9') && r != '.'
+ })
+ number, unit := text, ""
+ if i >= 0 {
+  number, unit = text[:i], strings.TrimSpace(text[i:])
+ }
+ size := BYTE
+ if unit != "" && !strings.EqualFold(unit, "B") {
+  found := false
+  for _, u := range byteSizeUnits {
+   if strings.EqualFold(unit, u.name) {
+    size, found = u.size, true
+    break
+   }
+  }
+  if !found {
+   return nil, fmt.Errorf("Unknown byte size unit '%s' in '%s'!\n", unit, raw)
+  }
+ }
+ if n, err := strconv.ParseUint(number, 10, 64); err == nil {
+  if n > math.MaxUint64 / uint64(size) {
+   return nil, fmt.Errorf("Byte size '%s' overflows!\n", raw)
+  }
+  return ByteSize(n) * size, nil
+ }
+ f, err := strconv.ParseFloat(number, 64)
+ if err != nil || f < 0 {
+  return nil, fmt.Errorf("Invalid byte size '%s'!\n", raw)
+ }
+ bytes := f * float64(size)
+ if bytes >= math.MaxUint64 {
+  return nil, fmt.Errorf("Byte size '%s' overflows!\n", raw)
+ }
+ return ByteSize(bytes), nil
+}
+
+func (v ByteSize) Value() interface{} { return uint64(v) }
+
+//Uses the largest unit that divides the size exactly, ie. "512MiB", "5MB" or "1500B"
+func (v ByteSize) String() string {
+ if v != 0 {
+  for _, u := range byteSizeUnits {
+   if v % u.size == 0 {
+    return strconv.FormatUint(uint64(v / u.size), 10) + u.name
+   }
+  }
+ }
+ return strconv.FormatUint(uint64(v), 10) + "B"
+}
+
+func (v ByteSize) MarshalText() ([]byte, error) { return []byte(v.String()), nil }
+
+func (v ByteSize) Equal(other config.IParameterValue) bool {
+ o, ok := other.(ByteSize)
+ return ok && v == o
+}
@@ -0,0 +1,161 @@
+package values
+
+import (
+ "strconv"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//Built-in config.IParameterValue implementations. Every type has a parser with the signature of a text decoder, ie.
+//sources.TextDecoder(values.ParseInt), a canonical String() that its parser reads back, a MarshalText method that
+//returns the same text, so exporters and encoding/json can write them losslessly, and an Equal method that implements
+//config.IEqualValue.
+//Value() returns the underlying Go type, ie. int64 for Int, so bound struct fields convert naturally.
+
+type String string
+
+func ParseString(raw string) (config.IParameterValue, error) {
+ return String(raw), nil
+}
+
+func (v String) Value() interface{} { return string(v) }
+func (v String) String() string     { return string(v) }
+
+func (v String) MarshalText() ([]byte, error) { return []byte(v.String()), nil }
+
+func (v String) Equal(other config.IParameterValue) bool {
+ o, ok := other.(String)
+ return ok && v == o
+}
+
+type Bool bool
+
+func ParseBool(raw string) (config.IParameterValue, error) {
+ b, err := strconv.ParseBool(raw)
+ if err != nil {
+  return nil, err
+ }
+ return Bool(b), nil
+}
+
+func (v Bool) Value() interface{} { return bool(v) }
+func (v Bool) String() string     { return strconv.FormatBool(bool(v)) }
+
+func (v Bool) MarshalText() ([]byte, error) { return []byte(v.String()), nil }
+
+func (v Bool) Equal(other config.IParameterValue) bool {
+ o, ok := other.(Bool)
+ return ok && v == o
+}
+
+type Int int64
+
+//Accepts base prefixes, ie. 0x10
+func ParseInt(raw string) (config.IParameterValue, error) {
+ i, err := strconv.ParseInt(raw, 0, 64)
+ if err != nil {
+  return nil, err
+ }
+ return Int(i), nil
+}
+
+func (v Int) Value() interface{} { return int64(v) }
+func (v Int) String() string     { return strconv.FormatInt(int64(v), 10) }
+
+func (v Int) MarshalText() ([]byte, error) { return []byte(v.String()), nil }
+
+func (v Int) Equal(other config.IParameterValue) bool {
+ o, ok := other.(Int)
+ return ok && v == o
+}
+
+type Uint uint64
+
+//Accepts base prefixes, ie. 0x10
+func ParseUint(raw string) (config.IParameterValue, error) {
+ u, err := strconv.ParseUint(raw, 0, 64)
+ if err != nil {
+  return nil, err
+ }
+ return Uint(u), nil
+}
+
+func (v Uint) Value() interface{} { return uint64(v) }
+func (v Uint) String() string     { return strconv.FormatUint(uint64(v), 10) }
+
+func (v Uint) MarshalText() ([]byte, error) { return []byte(v.String()), nil }
+
+func (v Uint) Equal(other config.IParameterValue) bool {
+ o, ok := other.(Uint)
+ return ok && v == o
+}
+
+type Float float64
+
+func ParseFloat(raw string) (config.IParameterValue, error) {
+ f, err := strconv.ParseFloat(raw, 64)
+ if err != nil {
+  return nil, err
+ }
+ return Float(f), nil
+}
+
+func (v Float) Value() interface{} { return float64(v) }
+func (v Float) String() string     { return strconv.FormatFloat(float64(v), 'g', -1, 64) }
+
+func (v Float) MarshalText() ([]byte, error) { return []byte(v.String()), nil }
+
+//NaN is never equal to anything, like float64
+func (v Float) Equal(other config.IParameterValue) bool {
+ o, ok := other.(Float)
+ return ok && v == o
+}
+
+type Duration time.Duration
+
+//Parses durations like time.ParseDuration, ie. "1m30s"
+func ParseDuration(raw string) (config.IParameterValue, error) {
+ d, err := time.ParseDuration(raw)
+ if err != nil {
+  return nil, err
+ }
+ return Duration(d), nil
+}
+
+func (v Duration) Value() interface{} { return time.Duration(v) }
+func (v Duration) String() string     { return time.Duration(v).String() }
+
+func (v Duration) MarshalText() ([]byte, error) { return []byte(v.String()), nil }
+
+func (v Duration) Equal(other config.IParameterValue) bool {
+ o, ok := other.(Duration)
+ return ok && v == o
+}
+
+//Instants are equal when they are the same instant, regardless of their location
+type Time struct {
+ time.Time
+}
+
+//Parses RFC 3339 date-times, ie. "1979-05-27T07:32:00Z", or dates, ie. "1979-05-27", which are midnight UTC
+func ParseTime(raw string) (config.IParameterValue, error) {
+ t, err := time.Parse(time.RFC3339Nano, raw)
+ if err != nil {
+  var dateErr error
+  if t, dateErr = time.Parse("2006-01-02", raw); dateErr != nil {
+   return nil, err
+  }
+ }
+ return Time{t}, nil
+}
+
+func (v Time) Value() interface{} { return v.Time }
+func (v Time) String() string     { return v.Format(time.RFC3339Nano) }
+
+func (v Time) MarshalText() ([]byte, error) { return []byte(v.String()), nil }
+
+func (v Time) Equal(other config.IParameterValue) bool {
+ o, ok := other.(Time)
+ return ok && v.Time.Equal(o.Time)
+}
@@ -0,0 +1,279 @@
+package values
+
+import (
+ "fmt"
+ "net/url"
+ "regexp"
+ "sort"
+ "strings"
+ "unicode"
+
+ "github.com/Matthewacon/go-figure/config"
+)
+
+//An absolute URL
+type URL struct {
+ *url.URL
+}
+
+//Rejects relative URLs, since configured endpoints without a scheme are almost always mistakes
+func ParseURL(raw string) (config.IParameterValue, error) {
+ u, err := url.Parse(raw)
+ if err != nil {
+  return nil, err
+ }
+ if !u.IsAbs() {
+  return nil, fmt.Errorf("URL '%s' is not absolute!\n", raw)
+ }
+ return URL{u}, nil
+}
+
+func (v URL) Value() interface{} { return v.URL }
+
+func (v URL) String() string {
+ if v.URL == nil {
+  return ""
+ }
+ return v.URL.String()
+}
+
+func (v URL) MarshalText() ([]byte, error) { return []byte(v.String()), nil }
+
+func (v URL) Equal(other config.IParameterValue) bool {
+ o, ok := other.(URL)
+ return ok && v.String() == o.String()
+}
+
+type Regexp struct {
+ *regexp.Regexp
+}
+
+func ParseRegexp(raw string) (config.IParameterValue, error) {
+ r, err := regexp.Compile(raw)
+ if err != nil {
+  return nil, err
+ }
+ return Regexp{r}, nil
+}
+
+func (v Regexp) Value() interface{} { return v.Regexp }
+
+func (v Regexp) String() string {
+ if v.Regexp == nil {
+  return ""
+ }
+ return v.Regexp.String()
+}
+
+func (v Regexp) MarshalText() ([]byte, error) { return []byte(v.String()), nil }
+
+//Expressions are equal when their sources are equal
+func (v Regexp) Equal(other config.IParameterValue) bool {
+ o, ok := other.(Regexp)
+ return ok && v.String() == o.String()
+}
+
+//Commas and '=' in the elements of lists and maps are escaped with a backslash, as are backslashes and the whitespace
+//at either end of an element, which is trimmed otherwise. Backslashes that don't escape anything are kept as is, so
+//unescaped text like "C:\dir" reads back unchanged.
+func escapeElement(element, separators string) string {
+ start := strings.IndexFunc(element, func(r rune) bool { return !unicode.IsSpace(r) })
+ end := strings.LastIndexFunc(element, func(r rune) bool { return !unicode.IsSpace(r) })
+ if start < 0 {
+  start = len(element)
+ }
+ var escaped strings.Builder
+ for i, r := range element {
+  if r == '\\' || strings.ContainsRune(separators, r) || (unicode.IsSpace(r) && (i < start || i > end)) {
+   escaped.WriteByte('\\')
+  }
+  escaped.WriteRune(r)
+ }
+ return escaped.String()
+}
+
+func isEscapable(r rune) bool {
+ return r == '\\' || r == ',' || r == '=' || unicode.IsSpace(r)
+}
+
+//Splits the text around unescaped separators into at most n escaped fields, or every field if n < 0
+func splitEscaped(raw string, separator rune, n int) []string {
+ var fields []string
+ start, escaped := 0, false
+ for i, r := range raw {
+  switch {
+  case escaped:
+   escaped = false
+  case r == '\\':
+   escaped = true
+  case r == separator && n != len(fields) + 1:
+   fields = append(fields, raw[start:i])
+   start = i + len(string(r))
+  }
+ }
+ return append(fields, raw[start:])
+}
+
+//Unescapes a field and trims its unescaped surrounding whitespace
+func unescapeElement(field string) string {
+ runes := []rune(field)
+ var element []rune
+ //the length of the element up to and including its last escaped rune, which is never trimmed
+ kept := 0
+ for i := 0; i < len(runes); i++ {
+  r := runes[i]
+  if r == '\\' && i + 1 < len(runes) && isEscapable(runes[i + 1]) {
+   i++
+   element = append(element, runes[i])
+   kept = len(element)
+   continue
+  }
+  if len(element) == 0 && unicode.IsSpace(r) {
+   continue
+  }
+  element = append(element, r)
+ }
+ end := len(element)
+ for end > kept && unicode.IsSpace(element[end - 1]) {
+  end--
+ }
+ return string(element[:end])
+}
+
+//A comma separated list, surrounding whitespace of the elements is trimmed. A list with a single empty element is
+//formatted like an empty list.
+type StringList []string
+
+func ParseStringList(raw string) (config.IParameterValue, error) {
+ list := StringList{}
+ if strings.TrimSpace(raw) == "" {
+  return list, nil
+ }
+ for _, element := range splitEscaped(raw, ',', -1) {
+  list = append(list, unescapeElement(element))
+ }
+ return list, nil
+}
+
+//Decodes comma separated text or a list of scalars from a document, for use as a sources.Decoder
+func DecodeStringList(raw interface{}) (config.IParameterValue, error) {
+ switch raw := raw.(type) {
+ case string:
+  return ParseStringList(raw)
+ case []string:
+  return append(StringList{}, raw...), nil
+ case []interface{}:
+  list := make(StringList, len(raw))
+  for i, element := range raw {
+   switch element.(type) {
+   case map[string]interface{}, []interface{}, nil:
+    return nil, fmt.Errorf("Expected a scalar list element, received: %T\n", element)
+   }
+   list[i] = fmt.Sprint(element)
+  }
+  return list, nil
+ default:
+  return nil, fmt.Errorf("Expected a list, received: %T\n", raw)
+ }
+}
+
+func (v StringList) Value() interface{} { return []string(v) }
+
+func (v StringList) String() string {
+ elements := make([]string, len(v))
+ for i, element := range v {
+  elements[i] = escapeElement(element, ",")
+ }
+ return strings.Join(elements, ",")
+}
+
+func (v StringList) MarshalText() ([]byte, error) { return []byte(v.String()), nil }
+
+func (v StringList) Equal(other config.IParameterValue) bool {
+ o, ok := other.(StringList)
+ if !ok || len(v) != len(o) {
+  return false
+ }
+ for i := range v {
+  if v[i] != o[i] {
+   return false
+  }
+ }
+ return true
+}
+
+//Comma separated key=value pairs, surrounding whitespace of keys and values is trimmed. Keys and values are escaped like
+//the elements of a StringList.
+type StringMap map[string]string
+
+func ParseStringMap(raw string) (config.IParameterValue, error) {
+ m := StringMap{}
+ if strings.TrimSpace(raw) == "" {
+  return m, nil
+ }
+ for _, pair := range splitEscaped(raw, ',', -1) {
+  kv := splitEscaped(pair, '=', 2)
+  if len(kv) != 2 {
+   return nil, fmt.Errorf("Expected a 'key=value' pair, received: '%s'\n", pair)
+  }
+  m[unescapeElement(kv[0])] = unescapeElement(kv[1])
+ }
+ return m, nil
+}
+
+//Decodes key=value pairs or a table of scalars from a document, for use as a sources.Decoder
+func DecodeStringMap(raw interface{}) (config.IParameterValue, error) {
+ switch raw := raw.(type) {
+ case string:
+  return ParseStringMap(raw)
+ case map[string]string:
+  m := make(StringMap, len(raw))
+  for k, v := range raw {
+   m[k] = v
+  }
+  return m, nil
+ case map[string]interface{}:
+  m := make(StringMap, len(raw))
+  for k, v := range raw {
+   switch v.(type) {
+   case map[string]interface{}, []interface{}, nil:
+    return nil, fmt.Errorf("Expected a scalar value for key '%s', received: %T\n", k, v)
+   }
+   m[k] = fmt.Sprint(v)
+  }
+  return m, nil
+ default:
+  return nil, fmt.Errorf("Expected a table, received: %T\n", raw)
+ }
+}
+
+func (v StringMap) Value() interface{} { return map[string]string(v) }
+
+//Pairs are sorted by key
+func (v StringMap) String() string {
+ keys := make([]string, 0, len(v))
+ for k := range v {
+  keys = append(keys, k)
+ }
+ sort.Strings(keys)
+ pairs := make([]string, len(keys))
+ for i, k := range keys {
+  pairs[i] = escapeElement(k, ",=") + "=" + escapeElement(v[k], ",=")
+ }
+ return strings.Join(pairs, ",")
+}
+
+func (v StringMap) MarshalText() ([]byte, error) { return []byte(v.String()), nil }
+
+func (v StringMap) Equal(other config.IParameterValue) bool {
+ o, ok := other.(StringMap)
+ if !ok || len(v) != len(o) {
+  return false
+ }
+ for k, value := range v {
+  if ov, ok := o[k]; !ok || ov != value {
+   return false
+  }
+ }
+ return true
+}
@@ -0,0 +1,158 @@
+//go:build linux
+// +build linux
+
+package watch
+
+import (
+ "errors"
+ "os"
+ "path/filepath"
+ "strings"
+ "syscall"
+ "unsafe"
+)
+
+const inotifyMask = syscall.IN_ONLYDIR |
+ syscall.IN_CREATE |
+ syscall.IN_DELETE |
+ syscall.IN_MODIFY |
+ syscall.IN_CLOSE_WRITE |
+ syscall.IN_MOVED_FROM |
+ syscall.IN_MOVED_TO |
+ syscall.IN_ATTRIB |
+ syscall.IN_DELETE_SELF |
+ syscall.IN_MOVE_SELF
+
+//Watched directories that are deleted or moved, ie. replaced by renaming another directory over their path, are
+//watched again under their path, through their parent directory until the path exists again
+const parentMask = syscall.IN_ONLYDIR | syscall.IN_MASK_ADD | syscall.IN_CREATE | syscall.IN_MOVED_TO
+
+//Watches directories with inotify. The inotify descriptor is non-blocking, so reads park on the runtime poller and
+//closing the file interrupts them.
+type inotify struct {
+ file *os.File
+ //watch descriptor -> directory
+ dirs map[int32]string
+ //directories that were deleted or moved and are not watched again yet, only accessed by run
+ lost map[string]bool
+ done chan struct{}
+}
+
+//Adds a watch through the file, so the descriptor cannot be closed while the watch is added
+func (watcher *inotify) addWatch(path string, mask uint32) (int32, error) {
+ conn, err := watcher.file.SyscallConn()
+ if err != nil {
+  return 0, err
+ }
+ var wd int
+ if cerr := conn.Control(func(fd uintptr) {
+  wd, err = syscall.InotifyAddWatch(int(fd), path, mask)
+ }); cerr != nil {
+  return 0, cerr
+ }
+ if err != nil {
+  return 0, &os.PathError{Op: "inotify_add_watch", Path: path, Err: err}
+ }
+ return int32(wd), nil
+}
+
+func (watcher *inotify) removeWatch(wd int32) {
+ if conn, err := watcher.file.SyscallConn(); err == nil {
+  conn.Control(func(fd uintptr) {
+   //fails for deleted directories, their watch is already gone
+   syscall.InotifyRmWatch(int(fd), uint32(wd))
+  })
+ }
+}
+
+//Must only be called by run once the watch of the directory reported IN_DELETE_SELF or IN_MOVE_SELF
+func (watcher *inotify) rewatch(wd int32, dir string, notify notifyFunc, fail func(err error)) {
+ delete(watcher.dirs, wd)
+ //moved directories are still watched under their new path
+ watcher.removeWatch(wd)
+ watcher.lost[dir] = true
+ if _, err := watcher.addWatch(filepath.Dir(dir), parentMask); err != nil {
+  fail(err)
+ }
+ //the path may already exist again, before its parent was watched
+ watcher.recover(notify)
+}
+
+//Watches the lost directories that exist again, must only be called by run
+func (watcher *inotify) recover(notify notifyFunc) {
+ for dir := range watcher.lost {
+  if wd, err := watcher.addWatch(dir, inotifyMask); err == nil {
+   watcher.dirs[wd] = dir
+   delete(watcher.lost, dir)
+   notify(dir, "")
+  }
+ }
+}
+
+func newNotifier(dirs []string, notify notifyFunc, fail func(err error)) (notifier, error) {
+ fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+ if err != nil {
+  return nil, os.NewSyscallError("inotify_init1", err)
+ }
+ watcher := &inotify{
+  file: os.NewFile(uintptr(fd), "inotify"),
+  dirs: map[int32]string{},
+  lost: map[string]bool{},
+  done: make(chan struct{}),
+ }
+ for _, dir := range dirs {
+  wd, err := watcher.addWatch(dir, inotifyMask)
+  if err != nil {
+   watcher.file.Close()
+   return nil, err
+  }
+  watcher.dirs[wd] = dir
+ }
+ go watcher.run(notify, fail)
+ return watcher, nil
+}
+
+func (watcher *inotify) run(notify notifyFunc, fail func(err error)) {
+ defer close(watcher.done)
+ //room for at least 64 events with maximum length names
+ buffer := make([]byte, 64 * (syscall.SizeofInotifyEvent + 256))
+ for {
+  n, err := watcher.file.Read(buffer)
+  if err != nil {
+   if !errors.Is(err, os.ErrClosed) {
+    fail(err)
+   }
+   return
+  }
+  for offset := 0; offset + syscall.SizeofInotifyEvent <= n; {
+   event := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+   start := offset + syscall.SizeofInotifyEvent
+   offset = start + int(event.Len)
+   name := strings.TrimRight(string(buffer[start:offset]), "\x00")
+   if event.Mask & syscall.IN_Q_OVERFLOW != 0 {
+    //events were dropped, anything may have changed
+    for _, dir := range watcher.dirs {
+     notify(dir, "")
+    }
+    watcher.recover(notify)
+    continue
+   }
+   if dir, ok := watcher.dirs[event.Wd]; ok {
+    notify(dir, name)
+    if event.Mask & (syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF) != 0 {
+     watcher.rewatch(event.Wd, dir, notify, fail)
+     continue
+    }
+   }
+   if len(watcher.lost) > 0 && event.Mask & (syscall.IN_CREATE | syscall.IN_MOVED_TO) != 0 {
+    watcher.recover(notify)
+   }
+  }
+ }
+}
+
+func (watcher *inotify) close() error {
+ err := watcher.file.Close()
+ <-watcher.done
+ return err
+}
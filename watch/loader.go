@@ -0,0 +1,89 @@
+package watch
+
+import (
+ "fmt"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/sources"
+)
+
+//Loads a set of sources into a bus, remembering what was loaded so parameters that the sources stop defining can be
+//removed by the next load. Not safe for concurrent use.
+type loader struct {
+ sources []sources.ISource
+ loaded  config.Parameters
+}
+
+func newLoader(srcs []sources.ISource) loader {
+ return loader{srcs, config.Parameters{}}
+}
+
+//Loads every source, later sources taking precedence over earlier ones, and applies the parameters that differ from
+//the bus's current parameters with a single transaction, every write carrying the source that defined the parameter
+//as its origin. The current parameters are read from a Snapshot, so reloads raise no READ events. Parameters that
+//the previous load applied and that are no longer defined by any source are removed by the same transaction, unless
+//they have been changed on the bus since. Nothing is applied if any source fails to load, if a validator rejects any
+//of the parameters or if the bus rejects the transaction.
+func (l *loader) load(bus config.IConfigBus) (config.Parameters, []config.IParameterKey, error) {
+ loaded := config.Parameters{}
+ origins := map[config.IParameterKey]*config.WriteOrigin{}
+ for _, src := range l.sources {
+  params, err := src.Load()
+  if err != nil {
+   return nil, nil, &ReloadError{src, err}
+  }
+  origin := &config.WriteOrigin{Source: src.String()}
+  for key, value := range params {
+   loaded[key] = value
+   origins[key] = origin
+  }
+ }
+ current := bus.Snapshot().GetParameters()
+ changed := sources.Changed(current, loaded)
+ stale := config.Parameters{}
+ for key, value := range l.loaded {
+  if _, ok := loaded[key]; !ok {
+   stale[key] = value
+  }
+ }
+ //parameters that were changed on the bus since they were loaded are left alone
+ modified := sources.Changed(current, stale)
+ removed := []config.IParameterKey{}
+ for key := range stale {
+  if _, ok := modified[key]; !ok {
+   removed = append(removed, key)
+  }
+ }
+ if len(changed) > 0 || len(removed) > 0 {
+  tx := bus.Begin()
+  for key, value := range changed {
+   tx.SetOrigin(origins[key])
+   tx.SetParameter(key, value)
+  }
+  //no source defines the removed parameters anymore
+  tx.SetOrigin(nil)
+  for _, key := range removed {
+   tx.RemoveParameter(key)
+  }
+  if err := commit(tx); err != nil {
+   return nil, nil, err
+  }
+ }
+ l.loaded = loaded
+ return changed, removed, nil
+}
+
+//Returns the panics of the bus, ie. of a closed asynchronous bus, as errors so they don't take down the goroutine that
+//reloads
+func commit(tx config.ITransaction) (err error) {
+ defer func() {
+  if p := recover(); p != nil {
+   if perr, ok := p.(error); ok {
+    err = perr
+   } else {
+    err = fmt.Errorf("%v\n", p)
+   }
+  }
+ }()
+ return tx.Commit()
+}
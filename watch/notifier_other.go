@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package watch
+
+//Platforms without inotify poll for changes
+func newNotifier(dirs []string, notify notifyFunc, fail func(err error)) (notifier, error) {
+ return newPoller(dirs, DEFAULT_POLL_INTERVAL, notify, fail)
+}
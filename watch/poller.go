@@ -0,0 +1,86 @@
+package watch
+
+import (
+ "io/ioutil"
+ "os"
+ "time"
+)
+
+//The observable state of a directory entry, symlinks are not followed
+type entryState struct {
+ modTime time.Time
+ size    int64
+ mode    os.FileMode
+ target  string
+}
+
+func scanDirectory(dir string) (map[string]entryState, error) {
+ entries, err := ioutil.ReadDir(dir)
+ if err != nil {
+  return nil, err
+ }
+ states := make(map[string]entryState, len(entries))
+ for _, entry := range entries {
+  state := entryState{entry.ModTime(), entry.Size(), entry.Mode(), ""}
+  if entry.Mode() & os.ModeSymlink != 0 {
+   state.target, _ = os.Readlink(dir + string(os.PathSeparator) + entry.Name())
+  }
+  states[entry.Name()] = state
+ }
+ return states, nil
+}
+
+//Notifies about entries that were added, removed or changed since the previous scan
+type poller struct {
+ stop chan struct{}
+ done chan struct{}
+}
+
+func newPoller(dirs []string, interval time.Duration, notify notifyFunc, fail func(err error)) (notifier, error) {
+ snapshots := make([]map[string]entryState, len(dirs))
+ for i, dir := range dirs {
+  snapshot, err := scanDirectory(dir)
+  if err != nil {
+   return nil, err
+  }
+  snapshots[i] = snapshot
+ }
+ p := &poller{make(chan struct{}), make(chan struct{})}
+ go func() {
+  defer close(p.done)
+  ticker := time.NewTicker(interval)
+  defer ticker.Stop()
+  for {
+   select {
+   case <-p.stop:
+    return
+   case <-ticker.C:
+   }
+   for i, dir := range dirs {
+    snapshot, err := scanDirectory(dir)
+    if err != nil {
+     fail(err)
+     continue
+    }
+    for name, state := range snapshot {
+     if prev, ok := snapshots[i][name]; !ok || prev != state {
+      notify(dir, name)
+     }
+    }
+    for name := range snapshots[i] {
+     if _, ok := snapshot[name]; !ok {
+      notify(dir, name)
+     }
+    }
+    snapshots[i] = snapshot
+   }
+  }
+ }()
+ return p, nil
+}
+
+func (p *poller) close() error {
+ close(p.stop)
+ <-p.done
+ return nil
+}
@@ -0,0 +1,117 @@
+package watch
+
+import (
+ "os"
+ "os/signal"
+ "sync"
+ "sync/atomic"
+ "syscall"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/sources"
+)
+
+//Reloads a set of sources into the config bus of an environment whenever the process receives a signal, SIGHUP by
+//default. Every reload loads all sources before applying anything, see loader.load, and is applied to the bus the
+//environment returns at that time.
+type SignalReloader struct {
+ //Optional, invoked on the reloader's goroutine after every signal triggered reload, err is nil on success. The
+ //handler may stop the reloader.
+ Handler func(err error)
+ env     config.IEnvironment
+ signals chan os.Signal
+ done    chan struct{}
+ //accessed atomically
+ reloads, failures uint64
+ handling          int32
+ //guards everything below and serializes reloads
+ mutex   sync.Mutex
+ loader  loader
+ started bool
+}
+
+func NewSignalReloader(env config.IEnvironment, srcs ...sources.ISource) *SignalReloader {
+ return &SignalReloader{
+  env: env,
+  loader: newLoader(srcs),
+ }
+}
+
+//Starts listening for the signals, syscall.SIGHUP if none are given. A reloader can only be started once.
+func (reloader *SignalReloader) Start(signals ...os.Signal) {
+ reloader.mutex.Lock()
+ defer reloader.mutex.Unlock()
+ if reloader.started {
+  return
+ }
+ reloader.started = true
+ if len(signals) == 0 {
+  signals = []os.Signal{syscall.SIGHUP}
+ }
+ reloader.signals = make(chan os.Signal, 1)
+ reloader.done = make(chan struct{})
+ signal.Notify(reloader.signals, signals...)
+ go func(signals chan os.Signal) {
+  defer close(reloader.done)
+  for range signals {
+   reloader.mutex.Lock()
+   //a signal that was pending when the reloader stopped
+   if reloader.signals == nil {
+    reloader.mutex.Unlock()
+    return
+   }
+   err := reloader.reload()
+   reloader.mutex.Unlock()
+   if reloader.Handler != nil {
+    atomic.StoreInt32(&reloader.handling, 1)
+    reloader.Handler(err)
+    atomic.StoreInt32(&reloader.handling, 0)
+   }
+  }
+ }(reloader.signals)
+}
+
+//Reloads the sources immediately, counting the result like a signal triggered reload
+func (reloader *SignalReloader) Reload() error {
+ reloader.mutex.Lock()
+ defer reloader.mutex.Unlock()
+ return reloader.reload()
+}
+
+//Must be called while holding the mutex
+func (reloader *SignalReloader) reload() error {
+ _, _, err := reloader.loader.load(reloader.env.GetConfig())
+ if err != nil {
+  atomic.AddUint64(&reloader.failures, 1)
+ } else {
+  atomic.AddUint64(&reloader.reloads, 1)
+ }
+ return err
+}
+
+//Returns the number of successful reloads
+func (reloader *SignalReloader) Reloads() uint64 {
+ return atomic.LoadUint64(&reloader.reloads)
+}
+
+//Returns the number of failed reloads
+func (reloader *SignalReloader) Failures() uint64 {
+ return atomic.LoadUint64(&reloader.failures)
+}
+
+//Stops listening for signals, a reload that is in progress completes first. Waits for the Handler to return, unless
+//the Handler is running while Stop is called, since the Handler may be the caller.
+func (reloader *SignalReloader) Stop() {
+ reloader.mutex.Lock()
+ signals := reloader.signals
+ reloader.signals = nil
+ reloader.mutex.Unlock()
+ if signals == nil {
+  return
+ }
+ signal.Stop(signals)
+ close(signals)
+ if atomic.LoadInt32(&reloader.handling) == 0 {
+  <-reloader.done
+ }
+}
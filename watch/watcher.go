@@ -0,0 +1,204 @@
+package watch
+
+import (
+ "fmt"
+ "os"
+ "path/filepath"
+ "sort"
+ "strings"
+ "sync"
+ "time"
+
+ "github.com/Matthewacon/go-figure/config"
+ "github.com/Matthewacon/go-figure/sources"
+)
+
+const (
+ DEFAULT_DEBOUNCE = 100 * time.Millisecond
+ DEFAULT_POLL_INTERVAL = time.Second
+)
+
+//Interface type for sources that read files or directories
+type IWatchable interface {
+ sources.ISource
+ //Returns the files and directories that the source reads
+ WatchPaths() []string
+}
+
+//Returned when a source fails to load during a reload
+type ReloadError struct {
+ Source sources.ISource
+ Err    error
+}
+
+func (err *ReloadError) Error() string {
+ return fmt.Sprintf("Failed to reload '%s':\n%s\n", err.Source.String(), err.Err.Error())
+}
+
+func (err *ReloadError) Unwrap() error {
+ return err.Err
+}
+
+//Reports changes to the entries of watched directories, name is empty when any entry may have changed
+type notifyFunc func(dir, name string)
+
+type notifier interface {
+ //Stops watching, no notifications are delivered once close returns
+ close() error
+}
+
+//Watches the files and directories of its sources and reloads them into a config bus when they change. Files are
+//watched through their parent directory, so files that are replaced rather than modified, ie. by editors that save
+//to a temporary file and rename it over the original, or by the '..data' symlink swap of a Kubernetes ConfigMap
+//mount, are picked up as well. Watched directories that are replaced are watched again under their path.
+//
+//Every reload only applies the parameters that changed, so WRITE listeners fire exactly for what changed; a reload
+//that fails leaves the bus untouched, see loader.load.
+type Watcher struct {
+ //Quiet period after the last change before reloading, defaults to DEFAULT_DEBOUNCE
+ Debounce time.Duration
+ //Polls the watched directories at this interval instead of using inotify, ie. for network file systems where
+ //inotify does not report remote changes. Platforms without inotify always poll, at DEFAULT_POLL_INTERVAL unless set.
+ PollInterval time.Duration
+ //Optional, invoked on the watcher's goroutine when a reload fails
+ ErrorHandler func(err error)
+ //Optional, invoked on the watcher's goroutine after every successful reload with the parameters that were applied
+ //and removed
+ ReloadHandler func(changed config.Parameters, removed []config.IParameterKey)
+ bus     config.IConfigBus
+ sources []IWatchable
+ //guards everything below and serializes reloads
+ mutex    sync.Mutex
+ loader   loader
+ timer    *time.Timer
+ notifier notifier
+ closed   bool
+ //watched directory -> names of the entries that trigger a reload, an empty name matches any entry
+ targets map[string][]string
+}
+
+func NewWatcher(bus config.IConfigBus, watched ...IWatchable) *Watcher {
+ srcs := make([]sources.ISource, len(watched))
+ for i, src := range watched {
+  srcs[i] = src
+ }
+ return &Watcher{
+  bus: bus,
+  sources: watched,
+  loader: newLoader(srcs),
+ }
+}
+
+//Loads the sources into the bus, then starts watching them. Nothing is watched if the initial load fails.
+func (watcher *Watcher) Start() error {
+ watcher.mutex.Lock()
+ defer watcher.mutex.Unlock()
+ if watcher.notifier != nil || watcher.closed {
+  return fmt.Errorf("Watcher has already been started!\n")
+ }
+ if err := watcher.reload(); err != nil {
+  return err
+ }
+ watcher.targets = map[string][]string{}
+ for _, src := range watcher.sources {
+  for _, path := range src.WatchPaths() {
+   if info, err := os.Stat(path); err == nil && info.IsDir() {
+    watcher.targets[path] = append(watcher.targets[path], "")
+   } else {
+    dir := filepath.Dir(path)
+    watcher.targets[dir] = append(watcher.targets[dir], filepath.Base(path))
+   }
+  }
+ }
+ dirs := make([]string, 0, len(watcher.targets))
+ for dir := range watcher.targets {
+  dirs = append(dirs, dir)
+ }
+ sort.Strings(dirs)
+ debounce := watcher.Debounce
+ if debounce <= 0 {
+  debounce = DEFAULT_DEBOUNCE
+ }
+ watcher.timer = time.AfterFunc(debounce, watcher.reloadChanged)
+ watcher.timer.Stop()
+ var err error
+ notify := func(dir, name string) {
+  if watcher.isTarget(dir, name) {
+   watcher.timer.Reset(debounce)
+  }
+ }
+ if watcher.PollInterval > 0 {
+  watcher.notifier, err = newPoller(dirs, watcher.PollInterval, notify, watcher.handleError)
+ } else {
+  watcher.notifier, err = newNotifier(dirs, notify, watcher.handleError)
+ }
+ if err != nil {
+  watcher.timer.Stop()
+  watcher.notifier = nil
+ }
+ return err
+}
+
+//Reports whether a change to the named entry of a watched directory affects any source, hidden entries always do
+//since they may be the target of a symlink, ie. '..data'
+func (watcher *Watcher) isTarget(dir, name string) bool {
+ for _, target := range watcher.targets[dir] {
+  if target == "" || name == "" || target == name || strings.HasPrefix(name, "..") {
+   return true
+  }
+ }
+ return false
+}
+
+func (watcher *Watcher) handleError(err error) {
+ if watcher.ErrorHandler != nil {
+  watcher.ErrorHandler(err)
+ }
+}
+
+func (watcher *Watcher) reloadChanged() {
+ watcher.mutex.Lock()
+ if watcher.closed {
+  watcher.mutex.Unlock()
+  return
+ }
+ err := watcher.reload()
+ watcher.mutex.Unlock()
+ if err != nil {
+  watcher.handleError(err)
+ }
+}
+
+//Reloads the sources immediately
+func (watcher *Watcher) Reload() error {
+ watcher.mutex.Lock()
+ defer watcher.mutex.Unlock()
+ return watcher.reload()
+}
+
+//Must be called while holding the mutex
+func (watcher *Watcher) reload() error {
+ changed, removed, err := watcher.loader.load(watcher.bus)
+ if err != nil {
+  return err
+ }
+ if watcher.ReloadHandler != nil {
+  watcher.ReloadHandler(changed, removed)
+ }
+ return nil
+}
+
+//Stops watching, a reload that is in progress completes first
+func (watcher *Watcher) Close() error {
+ watcher.mutex.Lock()
+ watcher.closed = true
+ notifier := watcher.notifier
+ if watcher.timer != nil {
+  watcher.timer.Stop()
+ }
+ watcher.mutex.Unlock()
+ if notifier != nil {
+  return notifier.close()
+ }
+ return nil
+}